@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	HTTP_ROUTER "github.com/ezep02/rodeo/internal/router"
@@ -60,10 +66,34 @@ func main() {
 		return
 	}
 
+	// # Contexto del servidor, se cancela con SIGINT/SIGTERM y detiene los jobs en segundo plano
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// # Inicia el router
-	r := HTTP_ROUTER.NewRouter(cnn, cld, redisClient)
+	r := HTTP_ROUTER.NewRouter(ctx, cnn, cld, redisClient)
 
 	PORT := 9090
-	log.Printf("Servidor iniciado en %d", PORT)
-	r.Run(":" + fmt.Sprintf("%d", PORT))
+	srv := &http.Server{
+		Addr:    ":" + fmt.Sprintf("%d", PORT),
+		Handler: r,
+	}
+
+	go func() {
+		log.Printf("Servidor iniciado en %d", PORT)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error iniciando el servidor: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Apagando servidor...")
+
+	// # Espera a que terminen las requests en curso
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error apagando el servidor: %v", err)
+	}
 }
@@ -57,9 +57,48 @@ CREATE TABLE slots (
     barber_id BIGINT UNSIGNED NOT NULL,
     start DATETIME NOT NULL,
     end DATETIME NOT NULL,
+    auto_generated BOOLEAN NOT NULL DEFAULT FALSE, -- creado a partir del horario semanal
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    CONSTRAINT fk_barber_id FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE
+    deleted_at TIMESTAMP NULL DEFAULT NULL,        -- baja logica de turnos con historial de reservas
+    CONSTRAINT fk_barber_id FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE INDEX uq_slot_barber_start (barber_id, start),
+    INDEX idx_slot_start (start, barber_id),      -- busqueda de turnos libres entre barberos
+    INDEX idx_slot_deleted_at (deleted_at)
+);
+
+-- Ausencias de un barbero o cierres del local (barber_id NULL), no se pueden reservar turnos dentro
+CREATE TABLE time_offs (
+    id SERIAL PRIMARY KEY,
+    barber_id BIGINT UNSIGNED DEFAULT NULL,
+    start DATETIME NOT NULL,
+    end DATETIME NOT NULL,
+    reason VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_time_off_barber FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_time_off_range (start, end)
+);
+
+-- Horario semanal de cada barbero (un registro por dia), a partir del cual se generan los slots
+CREATE TABLE schedules (
+    id SERIAL PRIMARY KEY,
+    barber_id BIGINT UNSIGNED NOT NULL,
+    weekday TINYINT NOT NULL,                 -- 0 = domingo ... 6 = sabado
+    start_time CHAR(5) NOT NULL,              -- HH:MM
+    end_time CHAR(5) NOT NULL,                -- HH:MM
+    slot_minutes INT NOT NULL DEFAULT 30,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_schedule_barber FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE INDEX uq_schedule_barber_weekday (barber_id, weekday)
+);
+
+CREATE TABLE schedule_breaks (
+    id SERIAL PRIMARY KEY,
+    schedule_id BIGINT UNSIGNED NOT NULL,
+    start_time CHAR(5) NOT NULL,              -- HH:MM
+    end_time CHAR(5) NOT NULL,                -- HH:MM
+    CONSTRAINT fk_schedule_break_schedule FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE
 );
 
 -- GOOGLE CALENDAR START
@@ -92,6 +131,7 @@ CREATE TABLE services (
     name VARCHAR(100) NOT NULL,
     description TEXT,
     price DECIMAL(10,2) NOT NULL,
+    duration_minutes INT NOT NULL DEFAULT 30,
     is_active BOOLEAN DEFAULT TRUE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
@@ -146,30 +186,78 @@ CREATE TABLE promotions (
 
 
 -- PAYMENT AND BOOKING START
+-- Reservas recurrentes: el mismo barbero y horario cada interval_weeks semanas, hasta count turnos o hasta until
+CREATE TABLE booking_series (
+    id SERIAL PRIMARY KEY,
+    client_id BIGINT UNSIGNED NOT NULL,
+    barber_id BIGINT UNSIGNED NOT NULL,
+    start DATETIME NOT NULL,                      -- primer turno, fija el dia y la hora
+    interval_weeks INT NOT NULL,
+    count INT NOT NULL DEFAULT 0,                 -- 0 si la serie termina en until
+    until DATETIME NULL DEFAULT NULL,
+    payment_mode ENUM('por_turno', 'prepago') NOT NULL,
+    status ENUM('activa', 'cancelada') NOT NULL DEFAULT 'activa',
+    payment_url TEXT,                             -- checkout de la serie prepaga
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_series_client FOREIGN KEY (client_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_series_barber FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE,
+
+    INDEX idx_series_client (client_id, created_at)
+);
+
+-- Reserva de varias personas abonada en un unico checkout, cada asistente tiene su propia reserva
+CREATE TABLE booking_groups (
+    id SERIAL PRIMARY KEY,
+    client_id BIGINT UNSIGNED NOT NULL,
+    payment_url TEXT,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_group_client FOREIGN KEY (client_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 CREATE TABLE bookings (
     id SERIAL PRIMARY KEY,
     slot_id BIGINT UNSIGNED NOT NULL,
     client_id BIGINT UNSIGNED NOT NULL,
     
     -- Estado de la reserva (no financiero)
-    status ENUM('pendiente_pago', 'confirmado', 'cancelado', 'rechazado', 'completado', 'reprogramado') NOT NULL DEFAULT 'pendiente_pago',
+    status ENUM('pendiente_pago', 'confirmado', 'pagado', 'cancelado', 'rechazado', 'completado', 'reprogramado', 'expirado', 'en_curso', 'ausente') NOT NULL DEFAULT 'pendiente_pago',
     
     total_amount DECIMAL(10,2) DEFAULT 0,
     google_event_id VARCHAR(255),
     
     coupon_code VARCHAR(12) DEFAULT NULL,
     discount_amount DECIMAL(10,2) DEFAULT 0,
+    series_id BIGINT UNSIGNED DEFAULT NULL,   -- serie recurrente a la que pertenece
+    group_id BIGINT UNSIGNED DEFAULT NULL,    -- reserva grupal abonada en un unico checkout
+    attendee_name VARCHAR(100),               -- persona atendida, si no es el cliente
     
     expires_at TIMESTAMP NULL DEFAULT NULL,
+    flagged_at TIMESTAMP NULL DEFAULT NULL,   -- el turno termino sin marcarse completado o ausente
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    -- slot_id solo mientras la reserva ocupa el turno, NULL en cualquier otro estado
+    active_slot_id BIGINT UNSIGNED AS (
+        CASE WHEN status IN ('pendiente_pago', 'confirmado', 'pagado', 'reprogramado', 'en_curso', 'completado', 'ausente') THEN slot_id END
+    ) STORED,
     
     CONSTRAINT fk_booking_slot FOREIGN KEY (slot_id) REFERENCES slots(id) ON DELETE CASCADE,
     CONSTRAINT fk_booking_client FOREIGN KEY (client_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_series FOREIGN KEY (series_id) REFERENCES booking_series(id) ON DELETE SET NULL,
+    CONSTRAINT fk_booking_group FOREIGN KEY (group_id) REFERENCES booking_groups(id) ON DELETE SET NULL,
     
     INDEX idx_booking_client (client_id),
+    INDEX idx_booking_series (series_id),
+    INDEX idx_booking_group (group_id),
     INDEX idx_booking_slot (slot_id),
-    INDEX idx_booking_status (status)
+    INDEX idx_booking_status (status),
+    INDEX idx_booking_flagged (flagged_at, status),
+    UNIQUE INDEX uq_booking_active_slot (active_slot_id)
 );
 
 CREATE TABLE payments (
@@ -183,16 +271,30 @@ CREATE TABLE payments (
     status ENUM('pendiente','aprobado','rechazado','reembolsado') NOT NULL DEFAULT 'pendiente',
     
     mercado_pago_id VARCHAR(255) DEFAULT NULL,   -- ID en Mercado Pago
+    preference_id VARCHAR(255) DEFAULT NULL,     -- checkout (preferencia) en Mercado Pago
     payment_url TEXT DEFAULT NULL,               -- URL de preferencia / checkout
     paid_at DATETIME DEFAULT NULL,               -- fecha de confirmación de pago
     
+    kind ENUM('cobro','reembolso') NOT NULL DEFAULT 'cobro',  -- las devoluciones son movimientos propios
+    refund_of BIGINT UNSIGNED DEFAULT NULL,                   -- cobro devuelto, solo para reembolsos
+    concept ENUM('reserva','recargo','saldo') NOT NULL DEFAULT 'reserva',  -- seña/total, recargo o resto en el local
+    recorded_by BIGINT UNSIGNED DEFAULT NULL,                 -- barbero que registro el cobro en el local
+    
+    receipt_url TEXT DEFAULT NULL,                 -- comprobante de transferencia (Cloudinary)
+    receipt_uploaded_at DATETIME DEFAULT NULL,
+    review_note VARCHAR(255) NOT NULL DEFAULT '',  -- motivo del rechazo del comprobante
+    
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     
     CONSTRAINT fk_payment_booking FOREIGN KEY (booking_id) REFERENCES bookings(id) ON DELETE CASCADE,
+    CONSTRAINT fk_payment_refund_of FOREIGN KEY (refund_of) REFERENCES payments(id) ON DELETE CASCADE,
+    CONSTRAINT fk_payment_recorded_by FOREIGN KEY (recorded_by) REFERENCES users(id) ON DELETE SET NULL,
     
     INDEX idx_payment_booking (booking_id),
+    INDEX idx_payment_refund_of (refund_of, kind),
     INDEX idx_payment_status (status),
+    INDEX idx_payment_receipt (status, receipt_uploaded_at),
     INDEX idx_mercado_pago_id (mercado_pago_id)
 );
 
@@ -212,7 +314,189 @@ CREATE TABLE booking_services (
     INDEX idx_booking_service_service (service_id)
 );
 
+-- Avisos a los clientes (reprogramaciones y cancelaciones de la barberia)
+CREATE TABLE notifications (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    booking_id BIGINT UNSIGNED DEFAULT NULL,
+    type VARCHAR(40) NOT NULL,
+    message VARCHAR(255) NOT NULL,
+    read_at DATETIME DEFAULT NULL,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_notification_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_notification_booking FOREIGN KEY (booking_id) REFERENCES bookings(id) ON DELETE CASCADE,
+
+    INDEX idx_notification_user (user_id, created_at)
+);
+
+-- Historial de cambios de estado de cada reserva (from_status vacio = creacion)
+CREATE TABLE booking_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    booking_id BIGINT UNSIGNED NOT NULL,
+    from_status VARCHAR(20) NOT NULL DEFAULT '',
+    to_status VARCHAR(20) NOT NULL,
+    actor_role ENUM('cliente', 'barbero', 'admin', 'sistema') NOT NULL,
+    actor_id BIGINT UNSIGNED DEFAULT NULL,           -- NULL cuando el cambio lo hizo el sistema
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_booking_event_booking FOREIGN KEY (booking_id) REFERENCES bookings(id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_event_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+
+    INDEX idx_booking_event_booking (booking_id, created_at)
+);
+
+-- Turnos que ocupa cada reserva (el inicial y los consecutivos segun la duracion de los servicios)
+CREATE TABLE booking_slots (
+    id SERIAL PRIMARY KEY,
+    booking_id BIGINT UNSIGNED NOT NULL,
+    slot_id BIGINT UNSIGNED NOT NULL,
+    
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    CONSTRAINT fk_booking_slot_booking FOREIGN KEY (booking_id) REFERENCES bookings(id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_slot_slot FOREIGN KEY (slot_id) REFERENCES slots(id) ON DELETE CASCADE,
+    
+    UNIQUE INDEX uq_booking_slot (booking_id, slot_id),
+    INDEX idx_booking_slot_slot (slot_id)
+);
+
+
+
+-- Lista de espera: turnos liberados se ofrecen en orden de llegada y quedan retenidos hasta expires_at
+CREATE TABLE waitlist_entries (
+    id SERIAL PRIMARY KEY,
+    client_id BIGINT UNSIGNED NOT NULL,
+    barber_id BIGINT UNSIGNED DEFAULT NULL,   -- NULL = cualquier barbero
+    date_from DATETIME NOT NULL,
+    date_to DATETIME NOT NULL,                -- exclusivo
+    status ENUM('esperando', 'ofrecido', 'atendido', 'cancelado') NOT NULL DEFAULT 'esperando',
+    
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    
+    CONSTRAINT fk_waitlist_client FOREIGN KEY (client_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_waitlist_barber FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE,
+    
+    INDEX idx_waitlist_status (status, created_at)
+);
+
+CREATE TABLE waitlist_services (
+    id SERIAL PRIMARY KEY,
+    waitlist_entry_id BIGINT UNSIGNED NOT NULL,
+    service_id BIGINT UNSIGNED NOT NULL,
+    
+    CONSTRAINT fk_waitlist_service_entry FOREIGN KEY (waitlist_entry_id) REFERENCES waitlist_entries(id) ON DELETE CASCADE,
+    CONSTRAINT fk_waitlist_service_service FOREIGN KEY (service_id) REFERENCES services(id) ON DELETE CASCADE
+);
+
+CREATE TABLE waitlist_offers (
+    id SERIAL PRIMARY KEY,
+    waitlist_entry_id BIGINT UNSIGNED NOT NULL,
+    slot_id BIGINT UNSIGNED NOT NULL,
+    status ENUM('ofrecido', 'aceptado', 'vencido', 'rechazado') NOT NULL DEFAULT 'ofrecido',
+    expires_at DATETIME NOT NULL,
+    
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    
+    CONSTRAINT fk_waitlist_offer_entry FOREIGN KEY (waitlist_entry_id) REFERENCES waitlist_entries(id) ON DELETE CASCADE,
+    CONSTRAINT fk_waitlist_offer_slot FOREIGN KEY (slot_id) REFERENCES slots(id) ON DELETE CASCADE,
+    
+    INDEX idx_waitlist_offer_slot (slot_id, status),
+    INDEX idx_waitlist_offer_expires (status, expires_at)
+);
+
+-- Notificaciones de Mercado Pago: registro de procesadas (event_id unico) y cola de reintentos
+CREATE TABLE webhook_events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(100) NOT NULL,
+    topic ENUM('pago', 'reprogramacion') NOT NULL,
+    resource_id VARCHAR(255) NOT NULL,              -- id del pago en el proveedor
+    status ENUM('pendiente', 'procesado', 'fallido') NOT NULL DEFAULT 'pendiente',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at DATETIME DEFAULT NULL,          -- proximo reintento de las pendientes
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    UNIQUE INDEX uq_webhook_event (event_id),
+    INDEX idx_webhook_retry (status, next_attempt_at)
+);
+
+-- Discrepancias entre los pagos locales y el proveedor detectadas por la conciliacion
+CREATE TABLE payment_discrepancies (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    payment_id BIGINT UNSIGNED NOT NULL,
+    booking_id BIGINT UNSIGNED NOT NULL,
+    provider_id VARCHAR(255) NOT NULL,              -- id del pago en el proveedor
+    type ENUM('pago_aprobado', 'monto_distinto', 'pago_duplicado', 'pago_devuelto', 'reserva_inactiva') NOT NULL,
+    local_status VARCHAR(50) NOT NULL,
+    provider_status VARCHAR(50) NOT NULL,
+    local_amount DECIMAL(10,2) NOT NULL,
+    provider_amount DECIMAL(10,2) NOT NULL,
+    status ENUM('reparado', 'revision') NOT NULL,   -- reparada automaticamente o pendiente de un administrador
+    detail TEXT,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE INDEX uq_discrepancy (payment_id, provider_id, type),
+    INDEX idx_discrepancy_status (status, created_at)
+);
+
+-- Politica de cancelacion y reprogramacion por tramos de horas de anticipacion
+-- (barber_id o service_id NULL = regla general, payment_type '' = cualquier tipo de pago)
+CREATE TABLE policy_rules (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    action ENUM('cancelacion', 'reprogramacion') NOT NULL,
+    barber_id BIGINT UNSIGNED DEFAULT NULL,
+    service_id BIGINT UNSIGNED DEFAULT NULL,
+    payment_type ENUM('', 'total', 'parcial') DEFAULT '',
+    min_hours INT NOT NULL DEFAULT 0,       -- desde (inclusive)
+    max_hours INT DEFAULT NULL,             -- hasta (exclusive), NULL = sin limite
+    outcome ENUM('cupon', 'reembolso', 'pierde_sena', 'recargo', 'sin_cargo') NOT NULL,
+    percentage INT NOT NULL DEFAULT 0,
+    allow_choice BOOLEAN DEFAULT FALSE,     -- el cliente puede elegir cupon o reembolso
+    message VARCHAR(255) DEFAULT '',
+    is_active BOOLEAN DEFAULT TRUE,
+
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    CONSTRAINT fk_policy_barber FOREIGN KEY (barber_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_policy_service FOREIGN KEY (service_id) REFERENCES services(id) ON DELETE CASCADE,
+
+    INDEX idx_policy_action (action, is_active)
+);
+
+-- Politica inicial, equivalente a la politica por defecto
+INSERT INTO policy_rules (action, payment_type, min_hours, max_hours, outcome, percentage, message) VALUES
+    ('cancelacion', 'total', 0, 24, 'cupon', 50, 'La cancelación está dentro de las 24 horas. Recibirás un cupón del 50%.'),
+    ('cancelacion', 'parcial', 0, 24, 'pierde_sena', 0, 'La cancelación está dentro de las 24 horas. Perderás la seña abonada.'),
+    ('cancelacion', 'total', 24, NULL, 'cupon', 75, 'La cancelación está fuera de las 24 horas. Recibirás un cupón del 75%.'),
+    ('cancelacion', 'parcial', 24, NULL, 'cupon', 25, 'La cancelación está fuera de las 24 horas. Recibirás un cupón del 25%.'),
+    ('reprogramacion', 'total', 0, 24, 'recargo', 25, 'La reprogramación es dentro de las 24 horas. Se aplicará un recargo del 25%.'),
+    ('reprogramacion', 'parcial', 0, 24, 'recargo', 50, 'La reprogramación es dentro de las 24 horas. Se aplicará un recargo del 50%.'),
+    ('reprogramacion', '', 24, NULL, 'sin_cargo', 0, 'Podés reprogramar sin costo hasta 24 horas antes del turno.');
+
+-- Politica de ausencias, una unica fila para todo el local
+CREATE TABLE no_show_policies (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    outcome ENUM('pierde_sena', 'cupon') NOT NULL DEFAULT 'pierde_sena',  -- que pasa con lo abonado
+    percentage INT NOT NULL DEFAULT 0,      -- porcentaje de lo abonado devuelto como cupon
+    prepay_after INT NOT NULL DEFAULT 0,    -- ausencias a partir de las cuales se exige el pago total, 0 = nunca
+    window_days INT NOT NULL DEFAULT 0,     -- dias hacia atras en que se cuentan las ausencias, 0 = siempre
+    message VARCHAR(255) DEFAULT '',
+
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
 
+INSERT INTO no_show_policies (id, outcome, prepay_after, window_days, message) VALUES
+    (1, 'pierde_sena', 2, 180, 'No te presentaste al turno, perdiste la seña abonada.');
 
 -- PAYMENT AND BOOKING END
 
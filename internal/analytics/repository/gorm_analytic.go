@@ -55,14 +55,20 @@ func (r *GormAnalyticRepository) NewClientRate(ctx context.Context) (*analytics.
 	return newClients, nil
 }
 
+// Cobros aprobados (o devueltos luego) y devoluciones confirmadas, que restan en el mes en que se confirmaron
+const (
+	revenueSQL   = "(kind = 'cobro' AND status IN ('aprobado', 'reembolsado')) OR (kind = 'reembolso' AND status = 'reembolsado')"
+	netAmountSQL = "CASE WHEN kind = 'reembolso' THEN -amount ELSE amount END"
+)
+
 func (r *GormAnalyticRepository) MonthlyRevenue(ctx context.Context) (*analytics.MonthlyRevenue, error) {
 	var monthlyRevenue = &analytics.MonthlyRevenue{}
 
-	// Calcular total global de ingresos aprobados
+	// Calcular total global de ingresos aprobados, descontando las devoluciones confirmadas
 	if err := r.db.WithContext(ctx).
 		Table("payments").
-		Select("COALESCE(SUM(amount), 0)").
-		Where("status = ?", "aprobado").
+		Select("COALESCE(SUM("+netAmountSQL+"), 0)").
+		Where(revenueSQL).
 		Scan(&monthlyRevenue.TotalRevenue).Error; err != nil {
 		return nil, err
 	}
@@ -77,8 +83,8 @@ func (r *GormAnalyticRepository) MonthlyRevenue(ctx context.Context) (*analytics
 
 	if err := r.db.WithContext(ctx).
 		Table("payments").
-		Select("DATE_FORMAT(paid_at, '%Y-%m') AS month, COALESCE(SUM(amount), 0) AS total_revenue").
-		Where("status = ?", "aprobado").
+		Select("DATE_FORMAT(paid_at, '%Y-%m') AS month, COALESCE(SUM("+netAmountSQL+"), 0) AS total_revenue").
+		Where(revenueSQL).
 		Group("month").
 		Order("month ASC").
 		Scan(&monthStats).Error; err != nil {
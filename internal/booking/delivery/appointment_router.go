@@ -1,20 +1,33 @@
 package delivery
 
 import (
+	"context"
 	"log"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/delivery/http"
 	"github.com/ezep02/rodeo/internal/booking/delivery/sse"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 	"github.com/ezep02/rodeo/internal/booking/repository"
 	"github.com/ezep02/rodeo/internal/booking/usecases"
+	policyRepository "github.com/ezep02/rodeo/internal/policy/repository"
+	policyUsecase "github.com/ezep02/rodeo/internal/policy/usecase"
+	pricingRepository "github.com/ezep02/rodeo/internal/pricing/repository"
+	pricingUsecase "github.com/ezep02/rodeo/internal/pricing/usecase"
+	usersRepository "github.com/ezep02/rodeo/internal/users/repository"
+
+	"github.com/cloudinary/cloudinary-go/v2"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
-func NewAppointmentRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client) {
+// Los jobs en segundo plano se detienen al cancelar ctx (apagado del servidor). Devuelve el servicio de
+// reservas para que el modulo de turnos aplique sus flujos a las reservas de un turno modificado
+func NewAppointmentRoutes(ctx context.Context, r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client, cloud *cloudinary.Cloudinary) *usecases.BookingService {
 
 	log.Println("[APPOINTMENT ROUTES] Setting up appointment routes")
 
@@ -30,23 +43,73 @@ func NewAppointmentRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client)
 	paymentRepo := repository.NewGormPaymentRepo(cnn, redis)
 	paymentSvc := usecases.NewPaymentService(paymentRepo)
 
+	// Discrepancias con el proveedor, las registran la conciliacion y los pagos que no confirman su reserva
+	reconRepo := repository.NewGormReconciliationRepo(cnn, redis)
+
+	// Proveedor de pagos (Mercado Pago o fake local)
+	secret := webhookSecret()
+	gateway := newPaymentGateway(secret)
+
+	// Motor de precios compartido con el catalogo
+	pricingRepo := pricingRepository.NewGormPricingRepo(cnn, redis)
+	pricingSvc := pricingUsecase.NewPricingService(pricingRepo)
+
+	// Politica de cancelacion y reprogramacion, editable por administradores
+	policyRepo := policyRepository.NewGormPolicyRepo(cnn, redis)
+	policySvc := policyUsecase.NewPolicyService(policyRepo)
+
+	// Lista de espera (los turnos liberados se ofrecen al siguiente cliente)
+	waitlistRepo := repository.NewGormWaitlistRepo(cnn, redis)
+	waitlistSvc := usecases.NewWaitlistService(waitlistRepo, waitlistHold())
+
 	// Respositorios y casos de uso de Bookings
 	bookingRepo := repository.NewGormBookingRepo(cnn, redis)
-	bookingSvc := usecases.NewBookingService(bookingRepo, paymentRepo, couponRepo)
+	// Avisos a los clientes, guardados y anunciados por el hub SSE
+	notificationRepo := repository.NewGormNotificationRepo(cnn, redis)
+	notificationSvc := usecases.NewNotificationService(notificationRepo, sseHub)
+
+	bookingSvc := usecases.NewBookingService(bookingRepo, paymentRepo, couponRepo, reconRepo, gateway, pricingSvc, waitlistSvc, policySvc, notificationSvc)
 
 	// Respositorios y casos de uso de Servicios
 	svcRepo := repository.NewGormServiceRepo(cnn, redis)
 	serviceSvc := usecases.NewServicesService(svcRepo)
 
-	// Repositorio y casos de usos de Mep
-	mepSvc := usecases.NewMepService(bookingRepo, paymentRepo, svcRepo)
+	// Repositorio y casos de uso del checkout
+	checkoutRepo := repository.NewGormCheckoutRepo(cnn, redis)
+	checkoutSvc := usecases.NewCheckoutService(checkoutRepo, bookingRepo, pricingSvc, couponSvc, policySvc, bookingExpiry())
+
+	// Reservas recurrentes, reservan sus turnos por adelantado con el checkout
+	seriesRepo := repository.NewGormSeriesRepo(cnn, redis)
+	seriesSvc := usecases.NewSeriesService(seriesRepo, checkoutRepo, bookingRepo, gateway, pricingSvc, checkoutSvc, bookingSvc)
+
+	// Comprobantes de transferencia, guardados en Cloudinary
+	receiptStorage := usersRepository.NewCloudinaryCloudRepo(cloud, redis)
+	receiptSvc := usecases.NewReceiptService(paymentRepo, bookingRepo, receiptStorage, bookingSvc)
+
+	// Job para vencer las reservas que no fueron pagadas a tiempo, sus turnos quedan libres
+	bookingSvc.StartExpiryJob(ctx, time.Minute)
+
+	// Job para reintentar las devoluciones de citas canceladas que el proveedor no llego a recibir
+	bookingSvc.StartRefundRetryJob(ctx, 5*time.Minute)
+
+	// Job para marcar las citas que terminaron sin cerrarse como completadas o ausentes
+	bookingSvc.StartUnclosedJob(ctx, 15*time.Minute)
+
+	// Notificaciones del proveedor, registradas para procesarse una vez y reintentarse si fallan
+	webhookRepo := repository.NewGormWebhookRepo(cnn, redis)
+	webhookSvc := usecases.NewWebhookService(webhookRepo, gateway, bookingSvc, paymentSvc, seriesSvc)
+	webhookSvc.StartWebhookRetryJob(ctx, time.Minute)
 
-	// Job para cancelar las reservas que no fueron pagados aun
-	bookingRepo.StartBookingCleanupJob(15 * time.Minute)
+	// Conciliacion con el proveedor, repara los pagos cuya notificacion se perdio antes de que venzan
+	reconSvc := usecases.NewReconciliationService(paymentRepo, reconRepo, bookingRepo, gateway, bookingSvc, paymentSvc, seriesSvc)
+	reconSvc.StartReconciliationJob(ctx, 5*time.Minute)
+
+	// Job para vencer ofertas de la lista de espera y ofrecer turnos liberados
+	waitlistSvc.StartWaitlistJob(ctx, time.Minute)
 
 	booking := r.Group("/appointment")
 	{
-		bookingHandler := http.NewBookingHandler(bookingSvc, paymentSvc, couponSvc, serviceSvc)
+		bookingHandler := http.NewBookingHandler(bookingSvc, paymentSvc, couponSvc, serviceSvc, checkoutSvc)
 
 		booking.GET("/upcoming/:date/:barber", bookingHandler.Upcoming)
 		booking.GET("/stats/:id", bookingHandler.StatsByBarberID)
@@ -54,6 +117,9 @@ func NewAppointmentRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client)
 		booking.PUT("/mark-as-paid/:id", bookingHandler.MarkAsPaid)
 		booking.PUT("/mark-as-rejected/:id", bookingHandler.MarkAsRejected)
 
+		// Cotizacion previa al pago (no crea reserva ni pago)
+		booking.POST("/quote", bookingHandler.Quote)
+
 		// Crear una reserva sin mercado pago (creada cuando se la opcion de pago con alias es seleccionada)
 		booking.POST("/", bookingHandler.Create)
 
@@ -69,6 +135,57 @@ func NewAppointmentRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client)
 
 		// Obtener payment de una reserva
 		booking.GET("/payment/:id", bookingHandler.BookingPayment)
+
+		// Historial de cambios de estado
+		booking.GET("/timeline/:id", bookingHandler.Timeline)
+
+		// Atencion del turno: llegada, completada o ausencia del cliente
+		booking.PUT("/check-in/:id", bookingHandler.CheckIn)
+		booking.PUT("/complete/:id", bookingHandler.Complete)
+		booking.PUT("/no-show/:id", bookingHandler.NoShow)
+		booking.GET("/unclosed", bookingHandler.Unclosed)
+
+		// Cambios iniciados por la barberia, sin penalidad para el cliente
+		shopHandler := http.NewShopHandler(bookingSvc)
+		booking.PUT("/shop/cancel/:id", shopHandler.Cancel)
+		booking.PUT("/shop/reschedule/:id", shopHandler.Reschedule)
+		booking.POST("/shop/reschedule/bulk", shopHandler.BulkReschedule)
+
+		// Reservas recurrentes
+		seriesHandler := http.NewSeriesHandler(seriesSvc)
+		booking.POST("/series", seriesHandler.Create)
+		booking.GET("/series/me", seriesHandler.Mine)
+		booking.GET("/series/:id", seriesHandler.Get)
+		booking.PUT("/series/:id/cancel", seriesHandler.Cancel)
+		booking.PUT("/series/:id/occurrence/:booking/cancel", seriesHandler.CancelOccurrence)
+
+		// Avisos al cliente
+		notificationHandler := http.NewNotificationHandler(notificationSvc)
+		booking.GET("/notifications/me", notificationHandler.Mine)
+		booking.PUT("/notifications/:id/read", notificationHandler.MarkRead)
+
+		// Registro de pagos con saldo y cobro del resto en el local
+		booking.GET("/ledger/:id", bookingHandler.Ledger)
+		booking.POST("/ledger/:id/payment", bookingHandler.RecordChairPayment)
+
+		// Comprobantes de transferencia y cola de revision
+		receiptHandler := http.NewReceiptHandler(receiptSvc)
+		booking.POST("/receipt/:id", receiptHandler.Upload)
+		booking.GET("/receipt/pending", receiptHandler.Pending)
+		booking.PUT("/receipt/:id/approve", receiptHandler.Approve)
+		booking.PUT("/receipt/:id/reject", receiptHandler.Reject)
+
+		// Conciliacion de pagos con el proveedor
+		reconHandler := http.NewReconciliationHandler(reconSvc)
+		booking.POST("/reconciliation/run", reconHandler.Run)
+		booking.GET("/reconciliation/discrepancies", reconHandler.Discrepancies)
+
+		// Lista de espera
+		waitlistHandler := http.NewWaitlistHandler(waitlistSvc)
+		booking.POST("/waitlist", waitlistHandler.Join)
+		booking.GET("/waitlist/me", waitlistHandler.Mine)
+		booking.DELETE("/waitlist/:id", waitlistHandler.Leave)
+		booking.PUT("/waitlist/offer/:id/decline", waitlistHandler.Decline)
 	}
 
 	// Rutas de cupones
@@ -76,12 +193,81 @@ func NewAppointmentRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client)
 	// Mercado Pago
 	mercado_pago := r.Group("/mercado_pago")
 	{
-		mepHandler := http.NewMepaHandler(bookingSvc, paymentSvc, couponSvc, serviceSvc, mepSvc)
+		mepHandler := http.NewMepaHandler(bookingSvc, paymentSvc, couponSvc, serviceSvc, checkoutSvc, gateway, webhookSvc, secret)
 		mercado_pago.POST("/", mepHandler.CreatePreference)
+		mercado_pago.POST("/group", mepHandler.CreateGroupPreference)
 		mercado_pago.POST("/notification", mepHandler.HandleNotification)
 		mercado_pago.POST("/notification/reschedule", mepHandler.RescheduleWithSurcharge)
+
+		// Pantalla de pago simulada, solo disponible con el proveedor fake
+		if payer, ok := gateway.(http.FakePayer); ok {
+			fakeHandler := http.NewFakeGatewayHandler(payer)
+			mercado_pago.GET("/fake/checkout/:id", fakeHandler.Checkout)
+		}
 	}
 
 	// Conexion SSE streaming de datos
 	r.GET("/stream", sseHandler.Handle)
+
+	return bookingSvc
+}
+
+// Selecciona el proveedor de pagos segun PAYMENT_GATEWAY ("fake" para desarrollo sin red)
+func newPaymentGateway(secret string) payments.Gateway {
+
+	if os.Getenv("PAYMENT_GATEWAY") == "fake" {
+		baseURL := os.Getenv("NGROK_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:9090"
+		}
+
+		log.Println("[APPOINTMENT ROUTES] Using fake payment gateway")
+		return repository.NewFakeGateway(baseURL, secret)
+	}
+
+	gateway, err := repository.NewMercadoPagoGateway(os.Getenv("MP_ACCESS_TOKEN"))
+	if err != nil {
+		log.Fatalf("Error iniciando Mercado Pago: %v", err)
+	}
+
+	return gateway
+}
+
+// Secreto con el que se firman las notificaciones (MP_WEBHOOK_SECRET). Con el proveedor fake
+// se usa uno de desarrollo si no esta configurado
+func webhookSecret() string {
+
+	secret := os.Getenv("MP_WEBHOOK_SECRET")
+	if secret != "" {
+		return secret
+	}
+
+	if os.Getenv("PAYMENT_GATEWAY") == "fake" {
+		return "fake-webhook-secret"
+	}
+
+	log.Fatal("Falta MP_WEBHOOK_SECRET para validar las notificaciones de Mercado Pago")
+	return ""
+}
+
+// Tiempo para pagar por Mercado Pago antes de que la reserva venza, configurable con BOOKING_EXPIRY_MINUTES
+func bookingExpiry() time.Duration {
+
+	minutes, err := strconv.Atoi(os.Getenv("BOOKING_EXPIRY_MINUTES"))
+	if err != nil || minutes <= 0 {
+		return usecases.DefaultBookingExpiry
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// Ventana en la que un turno ofrecido queda retenido, configurable con WAITLIST_HOLD_MINUTES
+func waitlistHold() time.Duration {
+
+	minutes, err := strconv.Atoi(os.Getenv("WAITLIST_HOLD_MINUTES"))
+	if err != nil || minutes <= 0 {
+		return usecases.DefaultWaitlistHold
+	}
+
+	return time.Duration(minutes) * time.Minute
 }
@@ -1,12 +1,14 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/coupon"
 	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 	"github.com/ezep02/rodeo/internal/booking/usecases"
 	"github.com/ezep02/rodeo/pkg/jwt"
@@ -18,6 +20,7 @@ type BookingHandler struct {
 	paymentSvc  *usecases.PaymentService
 	couponSvc   *usecases.CouponService
 	servicesSvc *usecases.ServicesService
+	checkoutSvc *usecases.CheckoutService
 }
 
 func NewBookingHandler(
@@ -25,8 +28,9 @@ func NewBookingHandler(
 	paymentSvc *usecases.PaymentService,
 	couponSvc *usecases.CouponService,
 	servicesSvc *usecases.ServicesService,
+	checkoutSvc *usecases.CheckoutService,
 ) *BookingHandler {
-	return &BookingHandler{bookingSvc, paymentSvc, couponSvc, servicesSvc}
+	return &BookingHandler{bookingSvc, paymentSvc, couponSvc, servicesSvc, checkoutSvc}
 }
 
 func (b *BookingHandler) Upcoming(c *gin.Context) {
@@ -155,6 +159,12 @@ type CreateBookingRequest struct {
 	CouponCode        string `json:"coupon_code"`
 }
 
+// La cotizacion indica ademas el metodo de pago, las transferencias no se devuelven por el proveedor
+type QuoteRequest struct {
+	CreateBookingRequest
+	Method string `json:"method"` // mercadopago (por defecto) o transferencia
+}
+
 func (b *BookingHandler) Create(c *gin.Context) {
 
 	var (
@@ -175,48 +185,58 @@ func (b *BookingHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// 2. Crear booking
-	totalAmount, err := b.servicesSvc.GetTotalPriceByIDs(c.Request.Context(), req.ServicesID)
+	// 3. Crear reserva, pago y servicios en una misma transaccion
+	created, err := b.checkoutSvc.Checkout(c.Request.Context(), usecases.CheckoutRequest{
+		SlotID:            req.SlotID,
+		ServicesID:        req.ServicesID,
+		PaymentPercentage: req.PaymentPercentage,
+		CouponCode:        req.CouponCode,
+		Method:            "transferencia",
+	}, authenticated.ID)
+
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "no fue posible recuperar los servicios"})
+		c.JSON(bookingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
-	// 3. Crear booking
-	booking := &booking.Booking{
-		SlotID:      req.SlotID,
-		ClientID:    authenticated.ID,
-		Status:      "pendiente_pago",
-		TotalAmount: totalAmount,
-	}
+	c.JSON(http.StatusOK, created.Payment)
+}
+
+func (b *BookingHandler) Quote(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		req        QuoteRequest
+	)
 
-	if err := b.bookingSvc.CreateBooking(c, booking); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear reserva"})
+	// 1. Verificar sesion del usuario
+	authenticated, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 3. Crear payment (seña o total)
-	paymentAmount := totalAmount
-	paymentType := "total"
-	if req.PaymentPercentage < 100 {
-		paymentAmount = paymentAmount * float64(req.PaymentPercentage) / 100
-		paymentType = "seña"
+	// 2. Parsear request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
 	}
 
-	payment := &payments.Payment{
-		BookingID: booking.ID,
-		Amount:    paymentAmount,
-		Type:      paymentType,
-		Method:    "transferencia",
-		Status:    "pendiente",
-	}
+	// 3. Cotizar
+	quote, err := b.checkoutSvc.Quote(c.Request.Context(), usecases.CheckoutRequest{
+		SlotID:            req.SlotID,
+		ServicesID:        req.ServicesID,
+		PaymentPercentage: req.PaymentPercentage,
+		CouponCode:        req.CouponCode,
+		Method:            req.Method,
+	}, authenticated.ID)
 
-	if err := b.paymentSvc.CreatePayment(c, payment); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear pago"})
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, payment)
+	c.JSON(http.StatusOK, quote)
 }
 
 func (b *BookingHandler) MarkAsPaid(c *gin.Context) {
@@ -246,7 +266,11 @@ func (b *BookingHandler) MarkAsPaid(c *gin.Context) {
 	}
 
 	// 3. Marcar como pagado
-	if err := b.bookingSvc.MarkAsPaid(c.Request.Context(), uint(id)); err != nil {
+	if err := b.bookingSvc.MarkAsPaid(c.Request.Context(), uint(id), booking.NewActor(booking.ActorAdmin, authenticated.ID)); err != nil {
+		if booking.IsTransitionError(err) || errors.Is(err, booking.ErrBookingExpired) {
+			c.JSON(bookingErrorStatus(err, http.StatusConflict), gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no fue posible marcar la reserva como pagada"})
 		return
 	}
@@ -281,7 +305,11 @@ func (b *BookingHandler) MarkAsRejected(c *gin.Context) {
 	}
 
 	// 3. Marcar como rechazado
-	if err := b.bookingSvc.MarkAsRejected(c.Request.Context(), uint(id)); err != nil {
+	if err := b.bookingSvc.MarkAsRejected(c.Request.Context(), uint(id), booking.NewActor(booking.ActorAdmin, authenticated.ID), "pago rechazado por un administrador"); err != nil {
+		if booking.IsTransitionError(err) {
+			c.JSON(bookingErrorStatus(err, http.StatusConflict), gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "no fue posible marcar la reserva como rechazada"})
 		return
 	}
@@ -317,3 +345,230 @@ func (b *BookingHandler) BookingPayment(c *gin.Context) {
 
 	c.JSON(http.StatusOK, paymentInfo)
 }
+
+// Devuelve el codigo HTTP correspondiente a los errores de reserva del turno
+func bookingErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, booking.ErrSlotTaken), errors.Is(err, booking.ErrSlotTooShort), errors.Is(err, booking.ErrSlotUnavailable):
+		return http.StatusConflict
+	case errors.Is(err, booking.ErrSlotNotFound), errors.Is(err, booking.ErrSeriesNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, booking.ErrSeriesEmpty):
+		return http.StatusConflict
+	case errors.Is(err, booking.ErrCompensationNotAllowed), errors.Is(err, payments.ErrNotRefundable), errors.Is(err, booking.ErrPrepaymentRequired):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, payments.ErrExceedsBalance), errors.Is(err, payments.ErrNothingDue):
+		return http.StatusConflict
+	case errors.Is(err, booking.ErrInvalidTransition), errors.Is(err, booking.ErrBookingExpired):
+		return http.StatusConflict
+	case errors.Is(err, booking.ErrTransitionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, coupon.ErrCouponUnavailable), errors.Is(err, coupon.ErrCouponInUse):
+		return http.StatusConflict
+	default:
+		return fallback
+	}
+}
+
+// Registro de pagos de la reserva con su saldo pendiente
+func (b *BookingHandler) Ledger(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	ledger, err := b.bookingSvc.Ledger(c.Request.Context(), uint(id), existing.ID, existing.IsAdmin)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ledger)
+}
+
+type ChairPaymentRequest struct {
+	Amount float64 `json:"amount"`
+	Method string  `json:"method"` // efectivo, tarjeta o transferencia
+}
+
+// El barbero registra el saldo abonado en el local
+func (b *BookingHandler) RecordChairPayment(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+		req        ChairPaymentRequest
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsBarber && !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene autorizacion"})
+		return
+	}
+
+	// 2. Parsear datos
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	// 3. Registrar el cobro
+	ledger, err := b.bookingSvc.RecordChairPayment(c.Request.Context(), uint(id), existing.ID, existing.IsAdmin, req.Amount, req.Method)
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ledger)
+}
+
+// Historial de cambios de estado de la reserva
+func (b *BookingHandler) Timeline(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	events, err := b.bookingSvc.Timeline(c.Request.Context(), uint(id), existing.ID, existing.IsAdmin)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// El barbero registra que el cliente se presento
+func (b *BookingHandler) CheckIn(c *gin.Context) {
+
+	existing, id, ok := staffRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := b.bookingSvc.CheckIn(c.Request.Context(), id, existing.ID, existing.IsAdmin); err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "llegada del cliente registrada"})
+}
+
+// El barbero marca la cita como completada
+func (b *BookingHandler) Complete(c *gin.Context) {
+
+	existing, id, ok := staffRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := b.bookingSvc.Complete(c.Request.Context(), id, existing.ID, existing.IsAdmin); err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "cita completada"})
+}
+
+// El barbero marca que el cliente no se presento, se aplica la politica de ausencias
+func (b *BookingHandler) NoShow(c *gin.Context) {
+
+	existing, id, ok := staffRequest(c)
+	if !ok {
+		return
+	}
+
+	res, err := b.bookingSvc.MarkNoShow(c.Request.Context(), id, existing.ID, existing.IsAdmin)
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Citas cuyo turno termino sin marcarse completadas o ausentes
+func (b *BookingHandler) Unclosed(c *gin.Context) {
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := b.bookingSvc.Unclosed(c.Request.Context(), existing.ID, existing.IsAdmin, existing.IsBarber)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// Valida que la sesion sea de un barbero o administrador y parsea el id de la cita
+func staffRequest(c *gin.Context) (*jwt.VerifyTokenRes, uint, bool) {
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, 0, false
+	}
+
+	if !existing.IsBarber && !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene autorizacion"})
+		return nil, 0, false
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return nil, 0, false
+	}
+
+	return existing, uint(id), true
+}
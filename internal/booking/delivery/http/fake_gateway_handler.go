@@ -0,0 +1,45 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/gin-gonic/gin"
+)
+
+// Proveedor de pagos capaz de simular que el cliente pago un checkout
+type FakePayer interface {
+	Pay(ctx context.Context, checkoutID, status string) (*payments.ProviderPayment, error)
+}
+
+// Endpoints de desarrollo que reemplazan la pantalla de pago de Mercado Pago
+type FakeGatewayHandler struct {
+	payer FakePayer
+}
+
+func NewFakeGatewayHandler(payer FakePayer) *FakeGatewayHandler {
+	return &FakeGatewayHandler{payer}
+}
+
+// Simula el pago de un checkout, por defecto aprobado (?status=rechazado para rechazarlo)
+func (h *FakeGatewayHandler) Checkout(c *gin.Context) {
+
+	var (
+		checkoutID = c.Param("id")
+		status     = c.DefaultQuery("status", "aprobado")
+	)
+
+	if checkoutID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "falta el id del checkout"})
+		return
+	}
+
+	paymentInfo, err := h.payer.Pay(c.Request.Context(), checkoutID, status)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, paymentInfo)
+}
@@ -8,13 +8,13 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 	"github.com/ezep02/rodeo/internal/booking/usecases"
 	"github.com/ezep02/rodeo/pkg/jwt"
 	"github.com/gin-gonic/gin"
-	"github.com/mercadopago/sdk-go/pkg/config"
-	"github.com/mercadopago/sdk-go/pkg/payment"
-	"github.com/mercadopago/sdk-go/pkg/preference"
 )
 
 type MepaHandler struct {
@@ -22,7 +22,11 @@ type MepaHandler struct {
 	paymentSvc  *usecases.PaymentService
 	couponSvc   *usecases.CouponService
 	servicesSvc *usecases.ServicesService
-	mepSvc      *usecases.MepService
+	checkoutSvc *usecases.CheckoutService
+	gateway     payments.Gateway
+
+	webhookSvc    *usecases.WebhookService
+	webhookSecret string
 }
 
 func NewMepaHandler(
@@ -30,8 +34,11 @@ func NewMepaHandler(
 	paymentSvc *usecases.PaymentService,
 	couponSvc *usecases.CouponService,
 	servicesSvc *usecases.ServicesService,
-	mepSvc *usecases.MepService) *MepaHandler {
-	return &MepaHandler{bookingSvc, paymentSvc, couponSvc, servicesSvc, mepSvc}
+	checkoutSvc *usecases.CheckoutService,
+	gateway payments.Gateway,
+	webhookSvc *usecases.WebhookService,
+	webhookSecret string) *MepaHandler {
+	return &MepaHandler{bookingSvc, paymentSvc, couponSvc, servicesSvc, checkoutSvc, gateway, webhookSvc, webhookSecret}
 }
 
 type CreatePreferenceRequest struct {
@@ -44,16 +51,10 @@ type CreatePreferenceRequest struct {
 func (h *MepaHandler) CreatePreference(c *gin.Context) {
 	var (
 		req              CreatePreferenceRequest
-		MP_ACCESS_TOKEN  = os.Getenv("MP_ACCESS_TOKEN")
 		AUTH_TOKEN       = os.Getenv("AUTH_TOKEN")
 		notification_url = os.Getenv("NGROK_URL")
 	)
 
-	if MP_ACCESS_TOKEN == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "falta mp acces token"})
-		return
-	}
-
 	if AUTH_TOKEN == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "falta auth token"})
 		return
@@ -77,202 +78,231 @@ func (h *MepaHandler) CreatePreference(c *gin.Context) {
 		return
 	}
 
-	// Almacenar temporalmente los datos de la preferencia
-	booking, payment, totalAmount, err := h.mepSvc.CreateMpPreference(c.Request.Context(), usecases.MepaPreference{
+	// Crear reserva, pago y servicios en una misma transaccion
+	created, err := h.checkoutSvc.Checkout(c.Request.Context(), usecases.CheckoutRequest{
 		SlotID:            req.SlotID,
 		ServicesID:        req.ServicesID,
 		PaymentPercentage: req.PaymentPercentage,
 		CouponCode:        req.CouponCode,
+		Method:            "mercadopago",
 	}, authenticatedUser.ID)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(bookingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
-	// 4. Configurar Mercado Pago
-	cfg, err := config.New(MP_ACCESS_TOKEN)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al configurar Mercado Pago"})
-		return
-	}
-	client := preference.NewClient(cfg)
-
-	mpRequest := preference.Request{
-		Items: []preference.ItemRequest{
-			{
-				Title:     "Tus servicios",
-				UnitPrice: totalAmount,
-				Quantity:  int(len(req.ServicesID)),
-			},
-		},
-		Payer: &preference.PayerRequest{
-			Name:    authenticatedUser.Name,
-			Surname: authenticatedUser.Surname,
-		},
+	// 4. Crear checkout en el proveedor de pagos
+	checkout, err := h.gateway.CreateCheckout(c.Request.Context(), payments.CheckoutRequest{
+		Title:           "Tus servicios",
+		Amount:          created.Payment.Amount,
+		Quantity:        1,
+		PayerName:       authenticatedUser.Name,
+		PayerSurname:    authenticatedUser.Surname,
 		NotificationURL: fmt.Sprintf("%s/api/v1/mercado_pago/notification", notification_url),
+		BackURL:         "http://localhost:5173",
 		Metadata: map[string]any{
-			"booking_id":         booking.ID,
-			"payment_id":         payment.ID,
+			"booking_id":         created.Booking.ID,
+			"payment_id":         created.Payment.ID,
 			"slot_id":            req.SlotID,
 			"user_id":            authenticatedUser.ID,
 			"payment_percentage": req.PaymentPercentage,
 		},
-		BackURLs: &preference.BackURLsRequest{
-			Success: "http://localhost:5173",
-		},
-		Expires: false,
-	}
-
-	preferenceRes, err := client.Create(c.Request.Context(), mpRequest)
+		ExternalReference: payments.ExternalReference(created.Payment.ID),
+		ExpiresAt:         created.Booking.ExpiresAt,
+	})
 	if err != nil {
-		log.Println("[DEBUG]", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear preferencia en Mercado Pago"})
+		h.checkoutSvc.Abort(context.WithoutCancel(c.Request.Context()), []uint{created.Booking.ID}, checkoutFailed)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 5. Guardar URL de preferencia en payment
-	payment.PaymentURL = &preferenceRes.InitPoint
-	if err := h.paymentSvc.UpdatePayment(c, payment); err != nil {
+	// 5. Guardar URL y id de preferencia en payment, sin ellos el pago no puede asociarse a la reserva
+	created.Payment.PaymentURL = &checkout.InitPoint
+	created.Payment.PreferenceID = &checkout.ID
+	if err := h.paymentSvc.UpdatePayment(c, created.Payment); err != nil {
+		h.checkoutSvc.Abort(context.WithoutCancel(c.Request.Context()), []uint{created.Booking.ID}, checkoutFailed)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando pago"})
 		return
 	}
 
-	c.JSON(http.StatusOK, preferenceRes.InitPoint)
+	c.JSON(http.StatusOK, checkout.InitPoint)
 }
 
-func (h *MepaHandler) HandleNotification(c *gin.Context) {
+// Reserva a varias personas, cada una con sus servicios y su turno, con un unico pago
+func (h *MepaHandler) CreateGroupPreference(c *gin.Context) {
 	var (
-		payload         map[string]any
-		MP_ACCESS_TOKEN = os.Getenv("MP_ACCESS_TOKEN")
+		req              usecases.GroupCheckoutRequest
+		AUTH_TOKEN       = os.Getenv("AUTH_TOKEN")
+		notification_url = os.Getenv("NGROK_URL")
 	)
 
-	log.Println("[MP Payment is here]")
+	if AUTH_TOKEN == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "falta auth token"})
+		return
+	}
 
-	// 2. Decodificar payload enviado por mp
-	if err := json.NewDecoder(c.Request.Body).Decode(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON inválido"})
+	if notification_url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "falta url de notificacion"})
 		return
 	}
 
-	// 3. Recuperar del payload el campo id almacenado dentro de data
-	data, ok := payload["data"].(map[string]any)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Campo 'data' inválido"})
+	// Parsear request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	paymentStr := fmt.Sprintf("%v", data["id"])
-	mpPaymentID, err := strconv.ParseInt(paymentStr, 10, 64)
+	// Validar sesión del usuario
+	authenticatedUser, err := jwt.VerifyUserSession(c, AUTH_TOKEN)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de pago inválido"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 4. Inicializar el cliente de Mercado Pago
-	cfg, err := config.New(MP_ACCESS_TOKEN)
+	// Crear las reservas, pagos y servicios de todos los asistentes en una misma transaccion
+	created, err := h.checkoutSvc.GroupCheckout(c.Request.Context(), req, authenticatedUser.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo configurar el cliente"})
+		c.JSON(bookingErrorStatus(err, http.StatusInternalServerError), gin.H{"error": err.Error()})
 		return
 	}
 
-	// 5. Consultar pago utilizanodo el ID
-	paymentClient := payment.NewClient(cfg)
-
-	paymentInfo, err := paymentClient.Get(context.Background(), int(mpPaymentID))
+	// Un unico checkout en el proveedor por el pago de todos los asistentes
+	checkout, err := h.gateway.CreateCheckout(c.Request.Context(), payments.CheckoutRequest{
+		Title:           fmt.Sprintf("Reserva para %d personas", len(created.Attendees)),
+		Amount:          created.AmountDue,
+		Quantity:        1,
+		PayerName:       authenticatedUser.Name,
+		PayerSurname:    authenticatedUser.Surname,
+		NotificationURL: fmt.Sprintf("%s/api/v1/mercado_pago/notification", notification_url),
+		BackURL:         "http://localhost:5173",
+		Metadata: map[string]any{
+			"group_id":           created.Group.ID,
+			"user_id":            authenticatedUser.ID,
+			"payment_percentage": req.PaymentPercentage,
+		},
+		ExternalReference: payments.GroupReference(created.Group.ID),
+		ExpiresAt:         created.Attendees[0].Booking.ExpiresAt,
+	})
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Pago no encontrado"})
+		h.checkoutSvc.Abort(context.WithoutCancel(c.Request.Context()), groupBookingIDs(created), checkoutFailed)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 	// Leer metadata
-	bookingID := uint(paymentInfo.Metadata["booking_id"].(float64))
-	paymentID := uint(paymentInfo.Metadata["payment_id"].(float64))
+	// Guardar la URL y el id de preferencia en el grupo y en los pagos de los asistentes
+	if err := h.checkoutSvc.SetGroupCheckout(c.Request.Context(), created.Group.ID, checkout); err != nil {
+		h.checkoutSvc.Abort(context.WithoutCancel(c.Request.Context()), groupBookingIDs(created), checkoutFailed)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando el grupo"})
+		return
+	}
 
-	// Actualizar en base
-	if paymentInfo.Status == "approved" {
+	created.Group.PaymentURL = &checkout.InitPoint
+	created.InitPoint = checkout.InitPoint
 
-		go func(bookingID, paymentID uint) {
-			ctx := context.Background()
-			// 1. Actualizar payment
-			if err := h.paymentSvc.MarkAsPaid(ctx, paymentID, paymentInfo.Order.ID); err != nil {
-				log.Println("Err", err.Error())
-				log.Println("payment fallo actualizando status a pagado")
-			}
+	c.JSON(http.StatusOK, created)
+}
 
-			if err := h.bookingSvc.MarkAsPaid(ctx, bookingID); err != nil {
-				log.Println("Err", err.Error())
-				log.Println("booking fallo actualizando status a confirmado")
-			}
+// Motivo con el que vencen las reservas cuyo pago no pudo crearse en el proveedor
+const checkoutFailed = "no fue posible crear el pago en el proveedor"
 
-		}(bookingID, paymentID)
+func groupBookingIDs(group *booking.GroupCheckout) []uint {
+	ids := make([]uint, 0, len(group.Attendees))
+	for _, attendee := range group.Attendees {
+		ids = append(ids, attendee.Booking.ID)
 	}
+	return ids
+}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+func (h *MepaHandler) HandleNotification(c *gin.Context) {
+	h.notification(c, payments.TopicPayment)
 }
 
 func (h *MepaHandler) RescheduleWithSurcharge(c *gin.Context) {
+	h.notification(c, payments.TopicReschedule)
+}
+
+// Valida la firma de la notificacion y la registra para procesarla una unica vez
+func (h *MepaHandler) notification(c *gin.Context, topic string) {
 
 	var (
-		payload         map[string]any
-		MP_ACCESS_TOKEN = os.Getenv("MP_ACCESS_TOKEN")
+		payload map[string]any
 	)
 
-	// 2. Decodificar payload enviado por mp
+	// 1. Decodificar payload enviado por mp
 	if err := json.NewDecoder(c.Request.Body).Decode(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON inválido"})
 		return
 	}
 
-	// 3. Recuperar del payload el campo id almacenado dentro de data
-	data, ok := payload["data"].(map[string]any)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Campo 'data' inválido"})
+	// Solo se procesan los avisos de pagos, el resto (merchant_order, etc.) se confirma para que no se reenvien
+	if kind := notificationType(c, payload); kind != "payment" {
+		c.JSON(http.StatusOK, gin.H{"status": "ignorada"})
 		return
 	}
 
-	paymentStr := fmt.Sprintf("%v", data["id"])
-	mpPaymentID, err := strconv.ParseInt(paymentStr, 10, 64)
-	if err != nil {
+	// 2. Recuperar el id del pago, Mercado Pago lo envia en la query y en data.id
+	providerPaymentID := c.Query("data.id")
+	if providerPaymentID == "" {
+		if data, ok := payload["data"].(map[string]any); ok {
+			providerPaymentID = notificationPaymentID(data)
+		}
+	}
+
+	if providerPaymentID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de pago inválido"})
 		return
 	}
 
-	// 4. Inicializar el cliente de Mercado Pago
-	cfg, err := config.New(MP_ACCESS_TOKEN)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo configurar el cliente"})
+	// 3. Validar la firma y que la notificacion no este vencida
+	requestID := c.GetHeader("x-request-id")
+	if err := payments.VerifySignature(h.webhookSecret, c.GetHeader("x-signature"), requestID, providerPaymentID, time.Now()); err != nil {
+		log.Println("[WEBHOOK]", err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 5. Consultar pago utilizanodo el ID
-	paymentClient := payment.NewClient(cfg)
+	// 4. Registrar y procesar, las entregas repetidas no hacen nada
+	eventID := notificationPaymentID(payload)
+	if eventID == "" {
+		eventID = requestID
+	}
 
-	paymentInfo, err := paymentClient.Get(context.Background(), int(mpPaymentID))
+	processed, err := h.webhookSvc.Handle(c.Request.Context(), fmt.Sprintf("%s:%s", topic, eventID), topic, providerPaymentID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Pago no encontrado"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Leer metadata
-	bookingID := uint(paymentInfo.Metadata["booking_id"].(float64))
-	slotID := uint(paymentInfo.Metadata["slot_id"].(float64))
-
-	log.Println("[RESCHEDULE SLOT ID]", slotID)
-	log.Println("[RESCHEDULE BOOKINGS ID]", bookingID)
-
-	// Actualizar en base
-	if paymentInfo.Status == "approved" {
+	if !processed {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicada"})
+		return
+	}
 
-		go func(bookingID, slotID uint) {
-			ctx := context.Background()
-			// 1. Realizar reprogramacion
-			if err := h.bookingSvc.RescheduleWithSurcharge(ctx, bookingID, slotID); err != nil {
-				log.Println("[RESCHEDULE WITH SURCHARGE ERR]", err)
-			}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
 
-		}(bookingID, slotID)
+// Tipo de aviso, los webhooks lo envian como type y las notificaciones IPN como topic
+func notificationType(c *gin.Context, payload map[string]any) string {
+	for _, key := range []string{"type", "topic"} {
+		if kind, ok := payload[key].(string); ok && kind != "" {
+			return kind
+		}
+		if kind := c.Query(key); kind != "" {
+			return kind
+		}
 	}
+	return ""
+}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+// Extrae el id del pago de la notificacion, que puede llegar como string o como numero
+func notificationPaymentID(data map[string]any) string {
+	switch id := data["id"].(type) {
+	case string:
+		return id
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	default:
+		return ""
+	}
 }
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Los avisos que no son de pagos se confirman sin validarse ni procesarse, los de pagos siguen a la firma
+func TestNotificationSkipsNonPaymentTopics(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.POST("/notification", NewMepaHandler(nil, nil, nil, nil, nil, nil, nil, "secreto").HandleNotification)
+
+	cases := []struct {
+		name   string
+		query  string
+		body   string
+		status int
+		want   string
+	}{
+		{"merchant order por webhook", "", `{"type":"merchant_order","data":{"id":"123"}}`, http.StatusOK, "ignorada"},
+		{"merchant order por ipn", "?topic=merchant_order&id=123", `{}`, http.StatusOK, "ignorada"},
+		{"sin tipo", "", `{"data":{"id":"123"}}`, http.StatusOK, "ignorada"},
+		{"pago por webhook", "", `{"type":"payment","data":{"id":"123"}}`, http.StatusUnauthorized, "error"},
+		{"pago por query", "?type=payment&data.id=123", `{}`, http.StatusUnauthorized, "error"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/notification"+tc.query, strings.NewReader(tc.body)))
+
+			if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.want) {
+				t.Fatalf("se esperaba %d con %q, se obtuvo %d %s", tc.status, tc.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
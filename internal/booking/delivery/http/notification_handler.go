@@ -0,0 +1,68 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/notification"
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHandler struct {
+	notificationSvc *usecases.NotificationService
+}
+
+func NewNotificationHandler(notificationSvc *usecases.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationSvc}
+}
+
+// Avisos del usuario autenticado
+func (h *NotificationHandler) Mine(c *gin.Context) {
+
+	// 1. Verificar sesion del usuario
+	user, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.notificationSvc.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar las notificaciones"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+
+	// 1. Verificar sesion del usuario
+	user, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	if err := h.notificationSvc.MarkRead(c.Request.Context(), uint(id), user.ID); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, notification.ErrNotificationNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notificacion leida"})
+}
@@ -0,0 +1,260 @@
+//go:build integration
+
+package http
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/delivery/sse"
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/repository"
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	policyRepository "github.com/ezep02/rodeo/internal/policy/repository"
+	policyUsecase "github.com/ezep02/rodeo/internal/policy/usecase"
+	pricingRepository "github.com/ezep02/rodeo/internal/pricing/repository"
+	pricingUsecase "github.com/ezep02/rodeo/internal/pricing/usecase"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Prueba contra MySQL con el esquema de elrodeodb.sql cargado, se ejecuta con
+//
+//	TEST_MYSQL_DSN="user:pass@tcp(localhost:3306)/elrodeodb?parseTime=true&loc=Local" go test -tags integration ./internal/booking/delivery/http/
+//
+// Redis es opcional (TEST_REDIS_ADDR), sin el las politicas se leen de la base
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN no esta definido")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("no fue posible conectar a la base de pruebas: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+// Crea un usuario de prueba, al eliminarlo se eliminan en cascada sus turnos, servicios y reservas
+func createTestUser(t *testing.T, db *gorm.DB, prefix string, isBarber bool) uint {
+	t.Helper()
+
+	name := fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+
+	if err := db.Exec("INSERT INTO users (name, password, email, username, is_barber) VALUES (?, ?, ?, ?, ?)",
+		name, "x", name+"@test.local", name, isBarber).Error; err != nil {
+		t.Fatalf("no fue posible crear el usuario de prueba: %v", err)
+	}
+
+	var id uint
+	if err := db.Raw("SELECT id FROM users WHERE username = ?", name).Scan(&id).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = ?", id) })
+
+	return id
+}
+
+// Servicio de 30 minutos del barbero
+func createTestService(t *testing.T, db *gorm.DB, barberID uint) uint {
+	t.Helper()
+
+	if err := db.Exec("INSERT INTO services (barber_id, name, price, duration_minutes) VALUES (?, ?, ?, ?)",
+		barberID, "Corte", 1000, 30).Error; err != nil {
+		t.Fatalf("no fue posible crear el servicio de prueba: %v", err)
+	}
+
+	var id uint
+	if err := db.Raw("SELECT id FROM services WHERE barber_id = ? ORDER BY id DESC LIMIT 1", barberID).Scan(&id).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+const notificationPath = "/api/v1/mercado_pago/notification"
+
+// Checkout por el handler, pago en el FakeGateway y notificacion firmada de vuelta al handler:
+// la reserva queda confirmada y la misma notificacion reenviada se informa duplicada sin procesarse
+func TestCheckoutNotificationRoundTrip(t *testing.T) {
+
+	db := openTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	barberID := createTestUser(t, db, "barber", true)
+	clientID := createTestUser(t, db, "client", false)
+	serviceID := createTestService(t, db, barberID)
+
+	start := time.Now().Add(240 * time.Hour).Truncate(time.Hour)
+	slot := booking.Slot{BarberID: barberID, Start: start, End: start.Add(30 * time.Minute)}
+	if err := db.Create(&slot).Error; err != nil {
+		t.Fatalf("no fue posible crear el turno de prueba: %v", err)
+	}
+
+	// 1. Servidor con las rutas de Mercado Pago, guarda la respuesta de cada notificacion
+	var (
+		engine    = gin.New()
+		mu        sync.Mutex
+		responses []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, r)
+
+		if r.URL.Path == notificationPath {
+			mu.Lock()
+			responses = append(responses, rec.Body.String())
+			mu.Unlock()
+		}
+
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	t.Setenv("AUTH_TOKEN", "rodeo_test_session")
+	t.Setenv("NGROK_URL", srv.URL)
+
+	const secret = "test-webhook-secret"
+	gateway := repository.NewFakeGateway(srv.URL, secret)
+	mep := newTestMepaHandler(db, gateway, secret)
+
+	engine.POST("/api/v1/mercado_pago/", mep.CreatePreference)
+	engine.POST(notificationPath, mep.HandleNotification)
+
+	// 2. Checkout con seña del 50%
+	token, err := jwt.GenerateToken(jwt.User{ID: clientID, Name: "Cliente"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(CreatePreferenceRequest{SlotID: slot.ID, ServicesID: []uint{serviceID}, PaymentPercentage: 50})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/mercado_pago/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "rodeo_test_session", Value: token})
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var initPoint string
+	if err := json.NewDecoder(res.Body).Decode(&initPoint); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("el checkout deberia devolver la url de pago, respondio %d (%v)", res.StatusCode, err)
+	}
+
+	var created booking.Booking
+	if err := db.Where("client_id = ? AND slot_id = ?", clientID, slot.ID).Take(&created).Error; err != nil {
+		t.Fatalf("no se encontro la reserva del checkout: %v", err)
+	}
+
+	// 3. El cliente paga, el FakeGateway notifica al handler con la firma de Mercado Pago
+	paid, err := gateway.Pay(context.Background(), path.Base(initPoint), "aprobado")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM webhook_events WHERE resource_id = ?", paid.ID) })
+
+	assertBookingStatus(t, db, created.ID, "confirmado")
+	assertConfirmations(t, db, created.ID, 1)
+
+	// 4. Mercado Pago reenvia la misma notificacion
+	if err := gateway.Redeliver(context.Background(), paid.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(responses) != 2 || !strings.Contains(responses[0], `"ok"`) || !strings.Contains(responses[1], `"duplicada"`) {
+		t.Fatalf("se esperaba la notificacion procesada y luego duplicada, se obtuvo %v", responses)
+	}
+
+	assertBookingStatus(t, db, created.ID, "confirmado")
+	assertConfirmations(t, db, created.ID, 1)
+
+	var events int64
+	db.Table("webhook_events").Where("resource_id = ? AND status = ?", paid.ID, "procesado").Count(&events)
+	if events != 1 {
+		t.Fatalf("la notificacion deberia registrarse una unica vez, hay %d", events)
+	}
+}
+
+// Arma el handler con los mismos servicios que NewAppointmentRoutes
+func newTestMepaHandler(db *gorm.DB, gateway *repository.FakeGateway, secret string) *MepaHandler {
+
+	rdb := redis.NewClient(&redis.Options{Addr: cmp.Or(os.Getenv("TEST_REDIS_ADDR"), "localhost:6379"), MaxRetries: -1})
+
+	couponRepo := repository.NewGormCouponRepo(db, rdb)
+	paymentRepo := repository.NewGormPaymentRepo(db, rdb)
+	bookingRepo := repository.NewGormBookingRepo(db, rdb)
+	checkoutRepo := repository.NewGormCheckoutRepo(db, rdb)
+	reconRepo := repository.NewGormReconciliationRepo(db, rdb)
+
+	couponSvc := usecases.NewCouponService(couponRepo)
+	paymentSvc := usecases.NewPaymentService(paymentRepo)
+	pricingSvc := pricingUsecase.NewPricingService(pricingRepository.NewGormPricingRepo(db, rdb))
+	policySvc := policyUsecase.NewPolicyService(policyRepository.NewGormPolicyRepo(db, rdb))
+	waitlistSvc := usecases.NewWaitlistService(repository.NewGormWaitlistRepo(db, rdb), usecases.DefaultWaitlistHold)
+	notificationSvc := usecases.NewNotificationService(repository.NewGormNotificationRepo(db, rdb), sse.NewHub())
+
+	bookingSvc := usecases.NewBookingService(bookingRepo, paymentRepo, couponRepo, reconRepo, gateway, pricingSvc, waitlistSvc, policySvc, notificationSvc)
+	checkoutSvc := usecases.NewCheckoutService(checkoutRepo, bookingRepo, pricingSvc, couponSvc, policySvc, usecases.DefaultBookingExpiry)
+	seriesSvc := usecases.NewSeriesService(repository.NewGormSeriesRepo(db, rdb), checkoutRepo, bookingRepo, gateway, pricingSvc, checkoutSvc, bookingSvc)
+	webhookSvc := usecases.NewWebhookService(repository.NewGormWebhookRepo(db, rdb), gateway, bookingSvc, paymentSvc, seriesSvc)
+
+	return NewMepaHandler(bookingSvc, paymentSvc, couponSvc, nil, checkoutSvc, gateway, webhookSvc, secret)
+}
+
+func assertBookingStatus(t *testing.T, db *gorm.DB, bookingID uint, want string) {
+	t.Helper()
+
+	var status string
+	if err := db.Raw("SELECT status FROM bookings WHERE id = ?", bookingID).Scan(&status).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if status != want {
+		t.Fatalf("la reserva deberia estar %s, esta %s", want, status)
+	}
+}
+
+// Cantidad de veces que la reserva paso a confirmado, una notificacion procesada dos veces dejaria dos eventos
+func assertConfirmations(t *testing.T, db *gorm.DB, bookingID uint, want int64) {
+	t.Helper()
+
+	var confirmed int64
+	db.Table("booking_events").Where("booking_id = ? AND to_status = ?", bookingID, "confirmado").Count(&confirmed)
+
+	if confirmed != want {
+		t.Fatalf("se esperaban %d confirmaciones de la reserva, hay %d", want, confirmed)
+	}
+}
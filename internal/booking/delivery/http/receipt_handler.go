@@ -0,0 +1,183 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type ReceiptHandler struct {
+	receiptSvc *usecases.ReceiptService
+}
+
+func NewReceiptHandler(receiptSvc *usecases.ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{receiptSvc}
+}
+
+type RejectReceiptRequest struct {
+	Note string `json:"note"`
+}
+
+// El cliente sube el comprobante de la transferencia de su reserva (campo "file")
+func (h *ReceiptHandler) Upload(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	// 3. Recuperar el archivo
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no se recibio el comprobante"})
+		return
+	}
+
+	if fileHeader.Size > usecases.MaxReceiptSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": payments.ErrInvalidReceipt.Error()})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible abrir el comprobante"})
+		return
+	}
+	defer file.Close()
+
+	// 4. Subir y vincular al pago
+	payment, err := h.receiptSvc.Upload(c.Request.Context(), uint(id), existing.ID, file)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, payments.ErrInvalidReceipt) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// Cola de comprobantes pendientes de revision
+func (h *ReceiptHandler) Pending(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene permiso suficiente"})
+		return
+	}
+
+	reviews, err := h.receiptSvc.Pending(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Confirma la transferencia revisada
+func (h *ReceiptHandler) Approve(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene permiso suficiente"})
+		return
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	if err := h.receiptSvc.Approve(c.Request.Context(), uint(id), booking.NewActor(booking.ActorAdmin, existing.ID)); err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "transferencia confirmada exitosamente"})
+}
+
+// Rechaza el comprobante con una nota para el cliente, la reserva sigue pendiente de pago
+func (h *ReceiptHandler) Reject(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+		req        RejectReceiptRequest
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene permiso suficiente"})
+		return
+	}
+
+	// 2. Parsear el id
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible parsear el id"})
+		return
+	}
+
+	// La nota es opcional
+	_ = c.ShouldBindJSON(&req)
+
+	if err := h.receiptSvc.Reject(c.Request.Context(), uint(id), req.Note); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "comprobante rechazado"})
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type ReconciliationHandler struct {
+	reconSvc *usecases.ReconciliationService
+}
+
+func NewReconciliationHandler(reconSvc *usecases.ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{reconSvc}
+}
+
+// Ejecuta la conciliacion en el momento y devuelve el reporte
+func (h *ReconciliationHandler) Run(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene permiso suficiente"})
+		return
+	}
+
+	report, err := h.reconSvc.Run(c.Request.Context())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, usecases.ErrReconciliationRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Reporte de discrepancias, ?status=revision para ver solo las que requieren intervencion
+func (h *ReconciliationHandler) Discrepancies(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		status     = c.Query("status")
+	)
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene permiso suficiente"})
+		return
+	}
+
+	list, err := h.reconSvc.Discrepancies(c.Request.Context(), status)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// Reservas recurrentes de clientes habituales
+type SeriesHandler struct {
+	seriesSvc *usecases.SeriesService
+}
+
+func NewSeriesHandler(seriesSvc *usecases.SeriesService) *SeriesHandler {
+	return &SeriesHandler{seriesSvc}
+}
+
+// Crea la serie y reserva sus turnos, informa los que no se pudieron reservar
+func (h *SeriesHandler) Create(c *gin.Context) {
+
+	var req usecases.SeriesRequest
+
+	// 1. Validar la sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsear la solicitud
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	// 3. Crear la serie
+	res, err := h.seriesSvc.Create(c.Request.Context(), req, existing.ID)
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+// Series del usuario autenticado
+func (h *SeriesHandler) Mine(c *gin.Context) {
+
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.seriesSvc.ListByClient(c.Request.Context(), existing.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "no fue posible recuperar las series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *SeriesHandler) Get(c *gin.Context) {
+
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	seriesID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar el id de la serie"})
+		return
+	}
+
+	series, err := h.seriesSvc.GetByID(c.Request.Context(), uint(seriesID), existing.ID, existing.IsAdmin)
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// Cancela los turnos futuros de la serie, ?compensation=cupon|reembolso si la politica permite elegir
+func (h *SeriesHandler) Cancel(c *gin.Context) {
+
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	seriesID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar el id de la serie"})
+		return
+	}
+
+	results, err := h.seriesSvc.CancelSeries(c.Request.Context(), uint(seriesID), existing.ID, existing.IsAdmin, c.Query("compensation"))
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// Cancela un turno de la serie, ?compensation=cupon|reembolso si la politica permite elegir
+func (h *SeriesHandler) CancelOccurrence(c *gin.Context) {
+
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	seriesID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar el id de la serie"})
+		return
+	}
+
+	bookingID, err := strconv.ParseUint(c.Param("booking"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar el id de la reserva"})
+		return
+	}
+
+	res, err := h.seriesSvc.CancelOccurrence(c.Request.Context(), uint(seriesID), uint(bookingID), existing.ID, existing.IsAdmin, c.Query("compensation"))
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
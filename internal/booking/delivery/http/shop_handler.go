@@ -0,0 +1,104 @@
+package http
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// Cambios de citas iniciados por la barberia, sin penalidad para el cliente
+type ShopHandler struct {
+	bookingSvc *usecases.BookingService
+}
+
+func NewShopHandler(bookingSvc *usecases.BookingService) *ShopHandler {
+	return &ShopHandler{bookingSvc}
+}
+
+type ShopRescheduleReq struct {
+	SlotID uint   `json:"slot_id"`
+	Reason string `json:"reason"`
+}
+
+// Cancela la cita devolviendo lo abonado o entregando un cupon
+func (h *ShopHandler) Cancel(c *gin.Context) {
+
+	var req usecases.ShopCancelRequest
+
+	existing, id, ok := staffRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	res, err := h.bookingSvc.ShopCancel(c.Request.Context(), id, existing.ID, existing.IsAdmin, req)
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Mueve la cita a otro turno sin recargo
+func (h *ShopHandler) Reschedule(c *gin.Context) {
+
+	var req ShopRescheduleReq
+
+	existing, id, ok := staffRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	res, err := h.bookingSvc.ShopReschedule(c.Request.Context(), id, req.SlotID, existing.ID, existing.IsAdmin, req.Reason)
+	if err != nil {
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Mueve todas las citas de un barbero en un rango horario
+func (h *ShopHandler) BulkReschedule(c *gin.Context) {
+
+	var req usecases.BulkRescheduleRequest
+
+	// 1. Verificar sesion del usuario
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !existing.IsBarber && !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene autorizacion"})
+		return
+	}
+
+	// 2. Parsear datos, las fechas en formato RFC3339
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	results, err := h.bookingSvc.BulkReschedule(c.Request.Context(), existing.ID, existing.IsAdmin, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -56,7 +56,8 @@ func (b *BookingHandler) Reschedule(c *gin.Context) {
 	)
 
 	// 1. Verificar sesion del usuario
-	if _, err := jwt.VerifyUserSession(c, auth_token); err != nil {
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
 		fmt.Printf("[Error verificando sesion] %s\n", err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
@@ -70,9 +71,9 @@ func (b *BookingHandler) Reschedule(c *gin.Context) {
 	}
 
 	// 3.
-	res, err := b.bookingSvc.Reschedule(c.Request.Context(), reqBody.BookingID, reqBody.NewSlotID)
+	res, err := b.bookingSvc.Reschedule(c.Request.Context(), reqBody.BookingID, reqBody.NewSlotID, existing.ID, existing.IsAdmin)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -117,7 +118,8 @@ func (b *BookingHandler) Cancel(c *gin.Context) {
 	)
 
 	// 1. Validar la sesion del usuario
-	if _, err := jwt.VerifyUserSession(c, auth_token); err != nil {
+	existing, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
@@ -130,11 +132,11 @@ func (b *BookingHandler) Cancel(c *gin.Context) {
 		return
 	}
 
-	// 3. Realizar consulta
-	info, err := b.bookingSvc.CancelBooking(c.Request.Context(), uint(parsedId))
+	// 3. Realizar consulta, ?compensation=cupon|reembolso si la politica permite elegir
+	info, err := b.bookingSvc.CancelBooking(c.Request.Context(), uint(parsedId), existing.ID, existing.IsAdmin, c.Query("compensation"))
 	if err != nil {
 		fmt.Printf("[error cancelando el booking] %s\n", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar el id de la consulta"})
+		c.JSON(bookingErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/waitlist"
+	"github.com/ezep02/rodeo/internal/booking/usecases"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type WaitlistHandler struct {
+	waitlistSvc *usecases.WaitlistService
+}
+
+func NewWaitlistHandler(waitlistSvc *usecases.WaitlistService) *WaitlistHandler {
+	return &WaitlistHandler{waitlistSvc}
+}
+
+type JoinWaitlistReq struct {
+	BarberID   *uint  `json:"barber_id"` // vacio = cualquier barbero
+	DateFrom   string `json:"date_from"` // YYYY-MM-DD
+	DateTo     string `json:"date_to"`   // YYYY-MM-DD
+	ServicesID []uint `json:"services_id"`
+}
+
+// Anota al cliente en la lista de espera
+func (h *WaitlistHandler) Join(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		req        JoinWaitlistReq
+	)
+
+	// 1. Verificar sesion del usuario
+	user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsear request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	dateFrom, err := time.ParseInLocation("2006-01-02", req.DateFrom, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando fecha de inicio"})
+		return
+	}
+
+	dateTo, err := time.ParseInLocation("2006-01-02", req.DateTo, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando fecha de fin"})
+		return
+	}
+
+	entry := &waitlist.WaitlistEntry{
+		ClientID: user.ID,
+		BarberID: req.BarberID,
+		DateFrom: dateFrom,
+		DateTo:   dateTo,
+	}
+
+	for _, svcID := range req.ServicesID {
+		entry.Services = append(entry.Services, waitlist.WaitlistService{ServiceID: svcID})
+	}
+
+	// 3. Anotar
+	if err := h.waitlistSvc.Join(c.Request.Context(), entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// Anotaciones del cliente con los turnos que le fueron ofrecidos
+func (h *WaitlistHandler) Mine(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.waitlistSvc.ListByClient(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar la lista de espera"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Sale de la lista de espera
+func (h *WaitlistHandler) Leave(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+	)
+
+	user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	parsedId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id invalido"})
+		return
+	}
+
+	if err := h.waitlistSvc.Leave(c.Request.Context(), uint(parsedId), user.ID); err != nil {
+		c.JSON(waitlistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "saliste de la lista de espera"})
+}
+
+// Rechaza el turno ofrecido para que pase al siguiente de la lista
+func (h *WaitlistHandler) Decline(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		idStr      = c.Param("id")
+	)
+
+	user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	parsedId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id invalido"})
+		return
+	}
+
+	if err := h.waitlistSvc.Decline(c.Request.Context(), uint(parsedId), user.ID); err != nil {
+		c.JSON(waitlistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "oferta rechazada"})
+}
+
+func waitlistErrorStatus(err error) int {
+	if errors.Is(err, waitlist.ErrEntryNotFound) || errors.Is(err, waitlist.ErrOfferNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
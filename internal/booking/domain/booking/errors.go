@@ -0,0 +1,42 @@
+package booking
+
+import "errors"
+
+var (
+	// El turno ya tiene una reserva activa
+	ErrSlotTaken = errors.New("el turno ya fue reservado")
+
+	// El turno solicitado no existe
+	ErrSlotNotFound = errors.New("el turno no existe")
+
+	// No hay turnos consecutivos suficientes para la duracion de los servicios
+	ErrSlotTooShort = errors.New("no hay turnos consecutivos suficientes para los servicios seleccionados")
+
+	// El turno cae dentro de una ausencia del barbero o un cierre del local
+	ErrSlotUnavailable = errors.New("el barbero no atiende en ese horario")
+
+	// La politica de cancelacion no ofrece la compensacion elegida
+	ErrCompensationNotAllowed = errors.New("la politica de cancelacion no permite elegir esa compensacion")
+
+	// La reserva vencio sin pago y su turno ya fue tomado por otra reserva
+	ErrBookingExpired = errors.New("la reserva vencio y el turno ya no esta disponible")
+
+	// El cliente supero las ausencias permitidas y debe abonar el total al reservar
+	ErrPrepaymentRequired = errors.New("por ausencias previas debe abonar el total de la reserva")
+
+	ErrSeriesNotFound = errors.New("la serie no existe")
+
+	// Ningun turno de la serie pudo reservarse
+	ErrSeriesEmpty = errors.New("no fue posible reservar ningun turno de la serie")
+)
+
+// Indica si el error proviene de la reserva del turno, estos errores se devuelven tal cual al cliente
+func IsSlotError(err error) bool {
+	return errors.Is(err, ErrSlotTaken) ||
+		errors.Is(err, ErrSlotNotFound) ||
+		errors.Is(err, ErrSlotTooShort) ||
+		errors.Is(err, ErrSlotUnavailable)
+}
+
+// Estados en los que una reserva ocupa su turno
+var ActiveStatuses = []string{"pendiente_pago", "confirmado", "pagado", "reprogramado", "en_curso", "completado", "ausente"}
@@ -3,20 +3,70 @@ package booking
 import (
 	"context"
 	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 )
 
 type BookingRepository interface {
-	Create(ctx context.Context, b *Booking) error
-	UpdateStatus(ctx context.Context, bookingID uint, status string) error
+	Create(ctx context.Context, b *Booking, actor Actor) error
+
+	// Cambia el estado validando la maquina de estados y registra el evento
+	UpdateStatus(ctx context.Context, bookingID uint, status string, actor Actor, reason string) error
 	UpdateSlot(ctx context.Context, bookingID, slotID uint) error
-	Cancel(ctx context.Context, bookingID uint) error
+
+	// Mueve la reserva, la marca reprogramada y registra el cobro del recargo en una misma transaccion
+	RescheduleWithCharge(ctx context.Context, bookingID, slotID uint, actor Actor, charge *payments.Payment) error
+	IsSlotTaken(ctx context.Context, slotID, exceptBookingID uint) (bool, error)
+	GetSlot(ctx context.Context, slotID uint) (*Slot, error)
+	Cancel(ctx context.Context, bookingID uint, actor Actor, reason string) error
+
+	// Cancela y registra las devoluciones pendientes en una misma transaccion, sin devoluciones (o nil) cancela sin devolver
+	CancelWithRefund(ctx context.Context, bookingID uint, actor Actor, reason string, refunds ...*payments.Payment) error
 	GetByID(ctx context.Context, bookingID uint) (*Booking, error)
-	StartBookingCleanupJob(interval time.Duration)
-	MarkAsPaid(ctx context.Context, bookingID uint) error
-	MarkAsRejected(ctx context.Context, bookingID uint) error
-	MarkAsRescheduled(ctx context.Context, bookingID uint) error
+	ExpirePending(ctx context.Context, now time.Time) ([]Booking, error)
+	MarkAsPaid(ctx context.Context, bookingID uint, actor Actor) error
+	MarkAsRejected(ctx context.Context, bookingID uint, actor Actor, reason string) error
+	MarkAsRescheduled(ctx context.Context, bookingID uint, actor Actor) error
 	Upcoming(ctx context.Context, barberID uint, date time.Time, status string) ([]Booking, error)
 	GetByUserID(ctx context.Context, userID uint, offset int64) ([]Booking, error)
 	StatsByBarberID(ctx context.Context, barberID uint) (*BookingStats, error)
 	AllPendingPayment(ctx context.Context) ([]Booking, error)
+
+	// Historial de cambios de estado de la reserva, del mas antiguo al mas reciente
+	Events(ctx context.Context, bookingID uint) ([]BookingEvent, error)
+	FlagUnclosed(ctx context.Context, before time.Time) (int64, error)
+	Unclosed(ctx context.Context, barberID uint) ([]Booking, error)
+	CountNoShows(ctx context.Context, clientID uint, since time.Time) (int64, error)
+	// Turno del barbero que comienza en start, nil si no existe
+	FindSlot(ctx context.Context, barberID uint, start time.Time) (*Slot, error)
+	// Reservas del barbero cuyo turno comienza entre from y to, en los estados indicados
+	ByBarberRange(ctx context.Context, barberID uint, from, to time.Time, statuses []string) ([]Booking, error)
+	// Reservas de los asistentes de una reserva grupal
+	ByGroup(ctx context.Context, groupID uint) ([]Booking, error)
+	// Turnos registrados de la reserva, incluido el inicial
+	SlotIDs(ctx context.Context, bookingID uint) ([]uint, error)
+}
+
+// Persistencia atomica del checkout (booking, payment y booking_services). El payment es
+// opcional, las reservas que se abonan en el local no registran pago al reservar
+type CheckoutRepository interface {
+	Create(ctx context.Context, checkout *Checkout) error
+	// Crea el grupo y el checkout de cada asistente en una unica transaccion, si un turno no esta libre no se reserva ninguno
+	CreateGroup(ctx context.Context, group *BookingGroup, checkouts []*Checkout) error
+	// Guarda el checkout del grupo en el grupo y en los pagos pendientes de sus reservas, para conciliarlos
+	SetGroupCheckout(ctx context.Context, groupID uint, checkout *payments.Checkout) error
+	// Verifica sin bloquear que el checkout encontraria los turnos libres, con el mismo error de turno que recibiria
+	CheckAvailability(ctx context.Context, slotID uint, duration int, clientID uint) error
+}
+
+type SeriesRepository interface {
+	Create(ctx context.Context, series *BookingSeries) error
+	// Serie con sus reservas ordenadas por turno
+	GetByID(ctx context.Context, seriesID uint) (*BookingSeries, error)
+	ListByClient(ctx context.Context, clientID uint) ([]BookingSeries, error)
+	UpdateStatus(ctx context.Context, seriesID uint, status string) error
+	// Guarda el checkout de la serie en la serie y en los pagos pendientes de sus reservas, para conciliarlos
+	SetCheckout(ctx context.Context, seriesID uint, checkout *payments.Checkout) error
+	// Elimina una serie sin reservas
+	Delete(ctx context.Context, seriesID uint) error
 }
@@ -1,22 +1,32 @@
 package booking
 
-import "time"
+import (
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/ezep02/rodeo/internal/booking/domain/services"
+	pricing "github.com/ezep02/rodeo/internal/pricing/domain"
+)
 
 type Booking struct {
 	ID             uint    `gorm:"primaryKey" json:"id"`
 	SlotID         uint    `gorm:"not null" json:"slot_id"`
 	ClientID       uint    `gorm:"not null" json:"client_id"`
-	Status         string  `gorm:"type:enum('pendiente_pago','confirmado','cancelado','rechazado','completado', 'reprogramado');default:'pendiente_pago';not null" json:"status"`
+	Status         string  `gorm:"type:enum('pendiente_pago','confirmado','pagado','cancelado','rechazado','completado', 'reprogramado','expirado','en_curso','ausente');default:'pendiente_pago';not null" json:"status"`
 	TotalAmount    float64 `gorm:"type:decimal(10,2);default:0" json:"total_amount"`
 	CouponCode     *string `gorm:"size:12" json:"coupon_code"`
 	DiscountAmount float64 `gorm:"type:decimal(10,2);default:0" json:"discount_amount"`
 	GoogleEventID  *string `gorm:"size:255" json:"google_event_id"`
+	SeriesID       *uint   `gorm:"default:null" json:"series_id"` // serie recurrente a la que pertenece
+	GroupID        *uint   `gorm:"default:null" json:"group_id"`  // reserva grupal abonada en un unico checkout
+	AttendeeName   string  `gorm:"size:100" json:"attendee_name"` // persona atendida, si no es el cliente
 
 	Client          User             `gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE" json:"client"`
 	Slot            Slot             `gorm:"foreignKey:SlotID;constraint:OnDelete:CASCADE" json:"slot"`
 	BookingServices []BookingService `gorm:"foreignKey:BookingID;constraint:OnDelete:CASCADE" json:"services"`
 
 	ExpiresAt *time.Time `gorm:"default:null" json:"expires_at"`
+	FlaggedAt *time.Time `gorm:"default:null" json:"flagged_at"` // el turno termino sin marcarse completado o ausente
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -38,6 +48,14 @@ type Slot struct {
 	End      time.Time `json:"end"`
 }
 
+// Turnos ocupados por una reserva, con varios servicios puede ocupar turnos consecutivos
+type BookingSlot struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BookingID uint      `gorm:"not null" json:"booking_id"`
+	SlotID    uint      `gorm:"not null" json:"slot_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
 type BookingService struct {
 	ID        uint `gorm:"primaryKey" json:"id"`
 	BookingID uint `gorm:"not null" json:"booking_id"`
@@ -57,30 +75,164 @@ type Service struct {
 	Price      float64 `gorm:"type:decimal(10,2);not null" json:"price"`
 }
 
+// Resultado de un checkout: la reserva junto a su pago y servicios, creados en una misma transaccion
+type Checkout struct {
+	Booking  *Booking                   `json:"booking"`
+	Payment  *payments.Payment          `json:"payment"`
+	Services []services.BookingServices `json:"services"`
+	Slots    []Slot                     `json:"slots"`            // turnos reservados, el primero es Booking.SlotID
+	Duration int                        `json:"duration_minutes"` // duracion a cubrir con turnos consecutivos
+	Quote    *pricing.Quote             `json:"quote"`
+}
+
 type BookingStats struct {
 	TotalBookings     int64   `json:"total_bookings"`
 	PendingBookings   int64   `json:"pending_bookings"`
 	CompletedBookings int64   `json:"completed_bookings"`
 	CanceledBookings  int64   `json:"canceled_bookings"`
+	NoShowBookings    int64   `json:"no_show_bookings"`
 	ExpectedRevenue   float64 `json:"expected_revenue"`
 }
 
 // Devuelve informacion sobre el estado de la reprogramacion
 type RescheduleResponse struct {
-	RequiresPayment bool    `json:"requires_payment"`
-	Amount          float64 `json:"amount,omitempty"`
-	Percentage      int     `json:"percentage,omitempty"`
-	InitPoint       string  `json:"init_point,omitempty"`
-	Free            bool    `json:"free"`
-	Reprogrammed    bool    `json:"reprogrammed"`
-	Message         string  `json:"message"`
+	RequiresPayment bool           `json:"requires_payment"`
+	Amount          float64        `json:"amount,omitempty"`
+	Percentage      int            `json:"percentage,omitempty"`
+	Quote           *pricing.Quote `json:"quote,omitempty"`
+	InitPoint       string         `json:"init_point,omitempty"`
+	Free            bool           `json:"free"`
+	Reprogrammed    bool           `json:"reprogrammed"`
+	Message         string         `json:"message"`
 }
 
 // Devuelve informacion sobre el estado de la cancelacion
 type CancelationResponse struct {
-	RequiresCoupon bool   `json:"requires_coupon"`          // se generara un cupon como devolucion?
-	CouponPercent  int    `json:"coupon_percent,omitempty"` // 25, 50, 75, etc.
-	LosesDeposit   bool   `json:"loses_deposit,omitempty"`  // indica si pierde la seña
-	Canceled       bool   `json:"canceled"`                 // si la cancelacion fue efectuada
-	Message        string `json:"message"`                  // explicacion para el usuario
+	Outcome        string            `json:"outcome"`                  // resultado de la politica: cupon, reembolso, pierde_sena o sin_cargo
+	RequiresCoupon bool              `json:"requires_coupon"`          // se generara un cupon como devolucion?
+	CouponPercent  int               `json:"coupon_percent,omitempty"` // 25, 50, 75, etc.
+	RequiresRefund bool              `json:"requires_refund"`          // se devolvera parte de lo abonado?
+	RefundPercent  int               `json:"refund_percent,omitempty"` // porcentaje de lo abonado a devolver
+	RefundAmount   float64           `json:"refund_amount,omitempty"`  // monto a devolver
+	LosesDeposit   bool              `json:"loses_deposit,omitempty"`  // indica si pierde la seña
+	ManualRefund   float64           `json:"manual_refund,omitempty"`  // abonado por otros medios, se devuelve a mano
+	Choices        []string          `json:"choices,omitempty"`        // compensaciones que el cliente puede elegir
+	Refund         *payments.Payment `json:"refund,omitempty"`         // devolucion registrada al cancelar
+	Canceled       bool              `json:"canceled"`                 // si la cancelacion fue efectuada
+	Message        string            `json:"message"`                  // explicacion para el usuario
+}
+
+// Resultado de marcar una ausencia segun la politica de ausencias
+type NoShowResponse struct {
+	Outcome            string `json:"outcome"`                  // pierde_sena o cupon
+	CouponPercent      int    `json:"coupon_percent,omitempty"` // cupon entregado por lo abonado
+	NoShows            int64  `json:"no_shows"`                 // ausencias del cliente contadas por la politica
+	PrepaymentRequired bool   `json:"prepayment_required"`      // sus proximas reservas exigen el pago total
+	Message            string `json:"message"`
+}
+
+// Resultado de mover una reserva en una reprogramacion masiva de la barberia
+type BulkMoveResult struct {
+	BookingID  uint   `json:"booking_id"`
+	ClientID   uint   `json:"client_id"`
+	FromSlotID uint   `json:"from_slot_id"`
+	ToSlotID   uint   `json:"to_slot_id,omitempty"`
+	Moved      bool   `json:"moved"`
+	Error      string `json:"error,omitempty"` // motivo por el que no se pudo mover
+}
+
+// Comprobante de transferencia en la cola de revision de administradores
+type ReceiptReview struct {
+	Booking Booking          `json:"booking"`
+	Payment payments.Payment `json:"payment"`
+}
+
+// Politica de reprogramacion que aplicaria a la reserva
+type ReschedulePolicy struct {
+	Free                bool    `json:"free"`
+	SurchargePercentage int     `json:"surcharge_percentage,omitempty"`
+	SurchargeAmount     float64 `json:"surcharge_amount,omitempty"`
+	Message             string  `json:"message"`
+}
+
+// Cotizacion previa al pago, no crea reservas ni pagos
+type QuoteResponse struct {
+	Slot        Slot                 `json:"slot"`
+	Available   bool                 `json:"available"`
+	Quote       *pricing.Quote       `json:"quote"`
+	Promotions  []pricing.Promotion  `json:"promotions"`
+	PaymentType string               `json:"payment_type"` // total o parcial
+	AmountDue   float64              `json:"amount_due"`   // monto a abonar ahora
+	Deposit     float64              `json:"deposit"`      // seña, 0 si debe abonar el total
+	FullAmount  float64              `json:"full_amount"`  // total de la reserva
+	Prepayment  bool                 `json:"prepayment"`   // por ausencias previas debe abonar el total
+	Cancelation *CancelationResponse `json:"cancelation"`
+	Reschedule  *ReschedulePolicy    `json:"reschedule"`
+}
+
+// Formas de pago de una serie recurrente
+const (
+	SeriesPerOccurrence = "por_turno" // cada turno se abona en el local
+	SeriesPrepaid       = "prepago"   // la serie completa se abona por adelantado
+)
+
+// Reserva recurrente de un cliente habitual: el mismo barbero y horario cada IntervalWeeks semanas,
+// hasta completar Count turnos o hasta Until
+type BookingSeries struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ClientID      uint       `gorm:"not null" json:"client_id"`
+	BarberID      uint       `gorm:"not null" json:"barber_id"`
+	Start         time.Time  `gorm:"not null" json:"start"` // primer turno, fija el dia y la hora
+	IntervalWeeks int        `gorm:"not null" json:"interval_weeks"`
+	Count         int        `gorm:"default:0" json:"count"`    // 0 si la serie termina en Until
+	Until         *time.Time `gorm:"default:null" json:"until"` // nil si la serie termina en Count
+	PaymentMode   string     `gorm:"type:enum('por_turno','prepago');not null" json:"payment_mode"`
+	Status        string     `gorm:"type:enum('activa','cancelada');default:'activa';not null" json:"status"`
+	PaymentURL    *string    `gorm:"type:text" json:"payment_url"` // checkout de la serie prepaga
+
+	Bookings []Booking `gorm:"foreignKey:SeriesID" json:"bookings"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Turno de la serie que no se pudo reservar
+type SeriesSkip struct {
+	Start time.Time `json:"start"`
+	Error string    `json:"error"`
+}
+
+// Resultado de crear una serie: los turnos reservados, los que no se pudieron reservar y el pago de la serie prepaga
+type SeriesResponse struct {
+	Series    *BookingSeries `json:"series"`
+	Skipped   []SeriesSkip   `json:"skipped"`
+	AmountDue float64        `json:"amount_due,omitempty"` // a abonar ahora, solo series prepagas
+	InitPoint string         `json:"init_point,omitempty"`
+}
+
+// Resultado de cancelar un turno de la serie
+type SeriesCancelResult struct {
+	BookingID   uint                 `json:"booking_id"`
+	Cancelation *CancelationResponse `json:"cancelation,omitempty"`
+	Error       string               `json:"error,omitempty"` // motivo por el que no se pudo cancelar
+}
+
+// Reserva de varias personas en un unico checkout. Cada asistente tiene su propia reserva y su pago,
+// por lo que la cancelacion y la reprogramacion se aplican por asistente
+type BookingGroup struct {
+	ID         uint    `gorm:"primaryKey" json:"id"`
+	ClientID   uint    `gorm:"not null" json:"client_id"`
+	PaymentURL *string `gorm:"type:text" json:"payment_url"`
+
+	Bookings []Booking `gorm:"foreignKey:GroupID" json:"bookings"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Resultado de un checkout grupal: el grupo y la reserva de cada asistente
+type GroupCheckout struct {
+	Group     *BookingGroup `json:"group"`
+	Attendees []*Checkout   `json:"attendees"`
+	AmountDue float64       `json:"amount_due"` // suma de los pagos de los asistentes
+	InitPoint string        `json:"init_point,omitempty"`
 }
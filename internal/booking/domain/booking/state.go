@@ -0,0 +1,126 @@
+package booking
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Roles que pueden cambiar el estado de una reserva
+const (
+	ActorClient = "cliente"
+	ActorBarber = "barbero"
+	ActorAdmin  = "admin"
+	ActorSystem = "sistema" // webhooks, conciliacion y jobs en segundo plano
+)
+
+var (
+	// El cambio de estado no existe en la maquina de estados
+	ErrInvalidTransition = errors.New("cambio de estado invalido")
+
+	// El cambio de estado existe pero el rol no puede realizarlo
+	ErrTransitionForbidden = errors.New("no tiene permiso para realizar este cambio de estado")
+)
+
+// Quien realiza un cambio de estado, UserID es nil para el sistema
+type Actor struct {
+	Role   string `json:"role"`
+	UserID *uint  `json:"user_id"`
+}
+
+func NewActor(role string, userID uint) Actor {
+	return Actor{Role: role, UserID: &userID}
+}
+
+func SystemActor() Actor {
+	return Actor{Role: ActorSystem}
+}
+
+// Cambios de estado permitidos y los roles que pueden realizarlos. El estado vacio es la creacion,
+// los turnos de una serie que se abonan en el local se crean confirmados.
+// El barbero reprograma o cancela por la barberia, sin las penalidades que se aplican al cliente
+var transitions = map[string]map[string][]string{
+	"": {
+		"pendiente_pago": {ActorClient, ActorAdmin},
+		"confirmado":     {ActorClient, ActorAdmin},
+	},
+	"pendiente_pago": {
+		"confirmado": {ActorSystem, ActorAdmin},
+		"pagado":     {ActorSystem, ActorAdmin},
+		"rechazado":  {ActorAdmin},
+		"cancelado":  {ActorClient, ActorBarber, ActorAdmin},
+		"expirado":   {ActorSystem},
+	},
+	// Un pago que llega tarde recupera la reserva si el turno sigue libre
+	"expirado": {
+		"confirmado": {ActorSystem, ActorAdmin},
+		"pagado":     {ActorSystem, ActorAdmin},
+	},
+	"confirmado": {
+		"pagado":       {ActorSystem, ActorBarber, ActorAdmin},
+		"reprogramado": {ActorClient, ActorBarber, ActorSystem, ActorAdmin},
+		"cancelado":    {ActorClient, ActorBarber, ActorAdmin},
+		"en_curso":     {ActorBarber, ActorAdmin},
+		"completado":   {ActorBarber, ActorAdmin},
+		"ausente":      {ActorBarber, ActorAdmin},
+	},
+	"pagado": {
+		"reprogramado": {ActorClient, ActorBarber, ActorSystem, ActorAdmin},
+		"cancelado":    {ActorClient, ActorBarber, ActorAdmin},
+		"en_curso":     {ActorBarber, ActorAdmin},
+		"completado":   {ActorBarber, ActorAdmin},
+		"ausente":      {ActorBarber, ActorAdmin},
+	},
+	"reprogramado": {
+		"reprogramado": {ActorClient, ActorBarber, ActorSystem, ActorAdmin},
+		"pagado":       {ActorSystem, ActorBarber, ActorAdmin},
+		"cancelado":    {ActorClient, ActorBarber, ActorAdmin},
+		"en_curso":     {ActorBarber, ActorAdmin},
+		"completado":   {ActorBarber, ActorAdmin},
+		"ausente":      {ActorBarber, ActorAdmin},
+	},
+	// El cliente se presento y esta siendo atendido
+	"en_curso": {
+		"completado": {ActorBarber, ActorAdmin},
+	},
+	// Un administrador corrige una ausencia marcada por error
+	"ausente": {
+		"completado": {ActorAdmin},
+	},
+}
+
+// Estados en los que la reserva sigue abierta luego de su turno, hasta marcarse completada o ausente
+var OpenStatuses = []string{"confirmado", "pagado", "reprogramado", "en_curso"}
+
+// Valida que el rol pueda llevar la reserva del estado from al estado to
+func CanTransition(from, to, role string) error {
+
+	roles, ok := transitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: de %q a %q", ErrInvalidTransition, from, to)
+	}
+
+	if !slices.Contains(roles, role) {
+		return fmt.Errorf("%w: %s no puede pasar la reserva de %q a %q", ErrTransitionForbidden, role, from, to)
+	}
+
+	return nil
+}
+
+// Indica si el error proviene de la maquina de estados
+func IsTransitionError(err error) bool {
+	return errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrTransitionForbidden)
+}
+
+// Cambio de estado registrado de una reserva
+type BookingEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	BookingID  uint      `gorm:"not null;index" json:"booking_id"`
+	FromStatus string    `gorm:"size:20;not null" json:"from_status"` // vacio en la creacion
+	ToStatus   string    `gorm:"size:20;not null" json:"to_status"`
+	ActorRole  string    `gorm:"type:enum('cliente','barbero','admin','sistema');not null" json:"actor_role"`
+	ActorID    *uint     `gorm:"default:null" json:"actor_id"`
+	Reason     string    `gorm:"size:255" json:"reason"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package coupon
+
+import "errors"
+
+var (
+	// El cupon ya fue canjeado o no esta disponible
+	ErrCouponUnavailable = errors.New("el cupón ya fue utilizado")
+
+	// El cupon esta aplicado a otra reserva del usuario que todavia espera su pago
+	ErrCouponInUse = errors.New("el cupón ya está aplicado a otra reserva pendiente de pago")
+)
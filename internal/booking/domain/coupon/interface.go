@@ -6,5 +6,10 @@ type CouponRepository interface {
 	Create(ctx context.Context, coupon *Coupon) error
 	GetByCode(ctx context.Context, code string) (*Coupon, error)
 	GetByUserID(ctx context.Context, id uint) ([]Coupon, error)
-	UpdateStatus(ctx context.Context, code string) error
+
+	// Canjea el cupon si sigue disponible, ErrCouponUnavailable si ya fue canjeado
+	Redeem(ctx context.Context, code string) error
+
+	// Indica si el cupon esta aplicado a una reserva pendiente de pago
+	HeldByPendingBooking(ctx context.Context, code string) (bool, error)
 }
@@ -0,0 +1,6 @@
+package notification
+
+import "errors"
+
+// La notificacion no existe o pertenece a otro usuario
+var ErrNotificationNotFound = errors.New("la notificacion no existe")
@@ -0,0 +1,14 @@
+package notification
+
+import "context"
+
+type NotificationRepository interface {
+	Create(ctx context.Context, n *Notification) error
+	ListByUser(ctx context.Context, userID uint, limit int) ([]Notification, error)
+	MarkRead(ctx context.Context, id, userID uint) error
+}
+
+// Canal en vivo por el que se avisa que hay notificaciones nuevas (SSE)
+type Publisher interface {
+	Broadcast(message string)
+}
@@ -0,0 +1,20 @@
+package notification
+
+import "time"
+
+// Tipos de aviso enviados al cliente
+const (
+	TypeRescheduled = "reserva_reprogramada" // la barberia movio la reserva a otro turno
+	TypeCanceled    = "reserva_cancelada"    // la barberia cancelo la reserva
+)
+
+// Aviso para un cliente, queda guardado hasta que lo lee
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	BookingID *uint      `gorm:"default:null" json:"booking_id"`
+	Type      string     `gorm:"size:40;not null" json:"type"`
+	Message   string     `gorm:"size:255;not null" json:"message"`
+	ReadAt    *time.Time `gorm:"default:null" json:"read_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -2,6 +2,7 @@ package payments
 
 import (
 	"context"
+	"io"
 	"time"
 )
 
@@ -9,9 +10,26 @@ type PaymentRepository interface {
 	// Crear un nuevo pago (puede ser seña o total)
 	Create(ctx context.Context, payment *Payment) error
 
-	// Obtener todos los pagos de un booking
+	// Registrar un cobro del proveedor junto con su devolucion pendiente, en una misma transaccion
+	CreateWithRefund(ctx context.Context, charge, refund *Payment) error
+
+	// Obtener el pago de la reserva (seña o total) de un booking
 	GetByBookingID(ctx context.Context, bookingID uint) (*Payment, error)
 
+	// Registro completo de pagos y devoluciones de un booking con su saldo
+	Ledger(ctx context.Context, bookingID uint) (*Ledger, error)
+
+	// Registrar un cobro aprobado contra el saldo del booking, sin superarlo
+	RecordCharge(ctx context.Context, payment *Payment) (*Ledger, error)
+
+	// Aprobar un pago confirmado a mano, con el metodo por el que se recibio
+	Approve(ctx context.Context, paymentID uint, method string, paidAt time.Time) error
+
+	// Comprobantes de transferencia
+	AttachReceipt(ctx context.Context, paymentID uint, url string) error
+	RejectReceipt(ctx context.Context, paymentID uint, note string) error
+	PendingReceipts(ctx context.Context) ([]Payment, error)
+
 	// Actualizar el status del pago (pendiente, aprobado, rechazado, reembolsado)
 	UpdateStatus(ctx context.Context, paymentID uint, status string, paidAt *time.Time) error
 
@@ -19,4 +37,66 @@ type PaymentRepository interface {
 	Update(ctx context.Context, payment *Payment) error
 
 	MarkAsPaid(ctx context.Context, paymentID uint, mpPaymentID string) error
+
+	// Obtener el cobro asociado a un pago del proveedor, el primero si el pago cubre varios
+	GetByProviderID(ctx context.Context, providerPaymentID string) (*Payment, error)
+
+	// Devoluciones registradas para un cobro
+	RefundsByPayment(ctx context.Context, paymentID uint) ([]Payment, error)
+
+	// Confirmar las devoluciones pendientes de los cobros del pago del proveedor cubiertas por el
+	// monto devuelto informado, devuelve cuantas se confirmaron
+	ConfirmRefunds(ctx context.Context, providerPaymentID string, refundedAmount float64) (int, error)
+
+	// Cobros pendientes con checkout o pago en el proveedor creados desde since, por id a partir de
+	// afterID, para recorrerlos por paginas sin que los mas antiguos tapen al resto
+	PendingWithProvider(ctx context.Context, since time.Time, afterID uint, limit int) ([]Payment, error)
+
+	GetByID(ctx context.Context, paymentID uint) (*Payment, error)
+
+	// Devoluciones registradas antes de before que todavia no se solicitaron al proveedor, para reintentarlas
+	UnsentRefunds(ctx context.Context, before time.Time, limit int) ([]Payment, error)
+}
+
+// Proveedor de pagos externo (Mercado Pago o el fake local para desarrollo)
+type Gateway interface {
+	// Crear un checkout y devolver el link de pago
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+
+	// Consultar el estado de un pago por el id del proveedor
+	GetPayment(ctx context.Context, paymentID string) (*ProviderPayment, error)
+
+	// Devolver total o parcialmente un pago aprobado (amount 0 = devolucion total)
+	Refund(ctx context.Context, paymentID string, amount float64) (*ProviderRefund, error)
+
+	// Buscar los pagos realizados sobre un checkout por su referencia externa
+	SearchPayments(ctx context.Context, externalReference string) ([]ProviderPayment, error)
+}
+
+// Registro de notificaciones procesadas y cola de reintentos
+type WebhookRepository interface {
+	// Registra la notificacion, devuelve false si ya habia sido recibida
+	Create(ctx context.Context, event *WebhookEvent) (bool, error)
+
+	MarkProcessed(ctx context.Context, id uint) error
+
+	// Registra el intento fallido, con next nil la notificacion queda como fallida definitivamente
+	MarkFailed(ctx context.Context, id uint, reason string, next *time.Time) error
+
+	// Notificaciones pendientes cuyo reintento ya corresponde
+	Due(ctx context.Context, now time.Time, limit int) ([]WebhookEvent, error)
+}
+
+// Discrepancias detectadas al conciliar con el proveedor
+type ReconciliationRepository interface {
+	// Registra la discrepancia, devuelve false si ya habia sido registrada
+	Create(ctx context.Context, discrepancy *Discrepancy) (bool, error)
+
+	// Discrepancias mas recientes, opcionalmente filtradas por status (reparado o revision)
+	List(ctx context.Context, status string, limit int) ([]Discrepancy, error)
+}
+
+// Almacenamiento de los comprobantes de transferencia (Cloudinary)
+type ReceiptStorage interface {
+	UploadReceipt(ctx context.Context, file io.Reader, filename string) (string, error)
 }
@@ -1,7 +1,33 @@
 package payments
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
+// Tipos de movimiento del registro de pagos
+const (
+	KindCharge = "cobro"     // pago del cliente
+	KindRefund = "reembolso" // devolucion de un cobro a traves del proveedor
+)
+
+// Conceptos de un cobro
+const (
+	ConceptBooking   = "reserva" // seña o total abonado al reservar
+	ConceptSurcharge = "recargo" // recargo por reprogramar
+	ConceptBalance   = "saldo"   // resto abonado en el local
+)
+
+var (
+	ErrNotRefundable  = errors.New("el pago no admite devolucion a traves del proveedor")
+	ErrExceedsBalance = errors.New("el monto supera el saldo pendiente de la reserva")
+	ErrNothingDue     = errors.New("la reserva no tiene saldo pendiente")
+	ErrInvalidReceipt = errors.New("el comprobante debe ser una imagen jpg, png o webp de hasta 5MB")
+)
+
+// Movimiento del registro de pagos de una reserva. Las devoluciones son movimientos propios
+// (Kind reembolso) que referencian al cobro original con RefundOf
 type Payment struct {
 	ID            uint       `gorm:"primaryKey" json:"id"`
 	BookingID     uint       `gorm:"not null" json:"booking_id"`
@@ -10,9 +36,150 @@ type Payment struct {
 	Method        string     `gorm:"type:enum('mercadopago','efectivo','tarjeta','transferencia');not null" json:"method"`
 	Status        string     `gorm:"type:enum('pendiente','aprobado','rechazado','reembolsado');default:'pendiente';not null" json:"status"`
 	MercadoPagoID *string    `gorm:"size:255" json:"mercado_pago_id"`
+	PreferenceID  *string    `gorm:"size:255" json:"preference_id"` // checkout creado en el proveedor
 	PaymentURL    *string    `gorm:"type:text" json:"payment_url"`
 	PaidAt        *time.Time `gorm:"default:null" json:"paid_at"`
+	Kind          string     `gorm:"type:enum('cobro','reembolso');default:'cobro';not null" json:"kind"`
+	Concept       string     `gorm:"type:enum('reserva','recargo','saldo');default:'reserva';not null" json:"concept"`
+	RecordedBy    *uint      `gorm:"default:null" json:"recorded_by"` // barbero que registro el cobro en el local
+
+	// Comprobante de transferencia subido por el cliente, revisado por un administrador
+	ReceiptURL        *string    `gorm:"type:text" json:"receipt_url"`
+	ReceiptUploadedAt *time.Time `gorm:"default:null" json:"receipt_uploaded_at"`
+	ReviewNote        string     `gorm:"size:255" json:"review_note"`
+	RefundOf          *uint      `gorm:"default:null" json:"refund_of"` // cobro devuelto, solo para reembolsos
 
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
+
+// Datos necesarios para generar un checkout en el proveedor de pagos
+type CheckoutRequest struct {
+	Title           string
+	Amount          float64
+	Quantity        int
+	PayerName       string
+	PayerSurname    string
+	NotificationURL string
+	BackURL         string
+	Metadata        map[string]any
+
+	// Referencia propia del checkout, permite buscar sus pagos en el proveedor sin depender de la notificacion
+	ExternalReference string
+
+	// Vencimiento del checkout, pasado este momento el proveedor no acepta el pago
+	ExpiresAt *time.Time
+}
+
+// Referencia externa con la que se identifica un pago local en el proveedor
+func ExternalReference(paymentID uint) string {
+	return fmt.Sprintf("payment-%d", paymentID)
+}
+
+// Referencias externas de los checkouts que abonan con un unico pago todas las reservas de un grupo o una serie
+func GroupReference(groupID uint) string {
+	return fmt.Sprintf("group-%d", groupID)
+}
+
+func SeriesReference(seriesID uint) string {
+	return fmt.Sprintf("series-%d", seriesID)
+}
+
+// Referencia externa del checkout del recargo por reprogramar la reserva al turno slotID
+func RescheduleReference(bookingID, slotID uint) string {
+	return fmt.Sprintf("reschedule-%d-%d", bookingID, slotID)
+}
+
+// Checkout generado por el proveedor (preferencia en Mercado Pago)
+type Checkout struct {
+	ID        string `json:"id"`
+	InitPoint string `json:"init_point"`
+}
+
+// Estado de un pago informado por el proveedor, con el status ya normalizado
+// a los valores de Payment.Status (pendiente, aprobado, rechazado, reembolsado)
+type ProviderPayment struct {
+	ID             string           `json:"id"`
+	Status         string           `json:"status"`
+	Amount         float64          `json:"amount"`
+	RefundedAmount float64          `json:"refunded_amount"` // total devuelto y aprobado por el proveedor
+	Refunds        []ProviderRefund `json:"refunds"`
+	Metadata       map[string]any   `json:"metadata"`
+	PaidAt         *time.Time       `json:"paid_at"`
+}
+
+// Devolucion realizada a traves del proveedor
+type ProviderRefund struct {
+	ID        string  `json:"id"`
+	PaymentID string  `json:"payment_id"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+}
+
+// Topicos de notificacion, segun el endpoint que la recibio
+const (
+	TopicPayment    = "pago"
+	TopicReschedule = "reprogramacion"
+)
+
+// Notificacion recibida del proveedor. El event_id unico evita procesar dos veces la misma
+// entrega, y las que fallan quedan pendientes con NextAttemptAt para reintentarse
+type WebhookEvent struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	EventID       string     `gorm:"size:100;not null;uniqueIndex" json:"event_id"`
+	Topic         string     `gorm:"type:enum('pago','reprogramacion');not null" json:"topic"`
+	ResourceID    string     `gorm:"size:255;not null" json:"resource_id"` // id del pago en el proveedor
+	Status        string     `gorm:"type:enum('pendiente','procesado','fallido');default:'pendiente';not null" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"last_error"`
+	NextAttemptAt *time.Time `gorm:"default:null" json:"next_attempt_at"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Registro de pagos de una reserva con su saldo. El total incluye los recargos cobrados
+// y lo abonado descuenta las devoluciones confirmadas
+type Ledger struct {
+	BookingID  uint      `json:"booking_id"`
+	Total      float64   `json:"total"`
+	Paid       float64   `json:"paid"`
+	Refunded   float64   `json:"refunded"`
+	BalanceDue float64   `json:"balance_due"`
+	Payments   []Payment `json:"payments"`
+}
+
+// Tipos de discrepancia detectados al conciliar con el proveedor
+const (
+	DiscrepancyApproved  = "pago_aprobado"    // aprobado en el proveedor y pendiente en el sistema
+	DiscrepancyAmount    = "monto_distinto"   // el monto aprobado no coincide con el registrado
+	DiscrepancyDuplicate = "pago_duplicado"   // mas de un pago aprobado para el mismo checkout
+	DiscrepancyRefunded  = "pago_devuelto"    // devuelto en el proveedor sin confirmarse en el sistema
+	DiscrepancyCanceled  = "reserva_inactiva" // el pago se aprobo pero la reserva ya no esta pendiente
+)
+
+// Diferencia entre el estado local de un pago y el del proveedor. Las reparadas se corrigieron
+// automaticamente, las que quedan en revision necesitan la intervencion de un administrador
+type Discrepancy struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	PaymentID      uint      `gorm:"not null;uniqueIndex:idx_discrepancy" json:"payment_id"`
+	BookingID      uint      `gorm:"not null" json:"booking_id"`
+	ProviderID     string    `gorm:"size:255;not null;uniqueIndex:idx_discrepancy" json:"provider_id"`
+	Type           string    `gorm:"type:enum('pago_aprobado','monto_distinto','pago_duplicado','pago_devuelto','reserva_inactiva');not null;uniqueIndex:idx_discrepancy" json:"type"`
+	LocalStatus    string    `gorm:"size:50;not null" json:"local_status"`
+	ProviderStatus string    `gorm:"size:50;not null" json:"provider_status"`
+	LocalAmount    float64   `gorm:"type:decimal(10,2);not null" json:"local_amount"`
+	ProviderAmount float64   `gorm:"type:decimal(10,2);not null" json:"provider_amount"`
+	Status         string    `gorm:"type:enum('reparado','revision');not null" json:"status"`
+	Detail         string    `gorm:"type:text" json:"detail"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Resultado de una corrida de conciliacion
+type ReconciliationReport struct {
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Checked       int           `json:"checked"`
+	Repaired      int           `json:"repaired"`
+	Errors        int           `json:"errors"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
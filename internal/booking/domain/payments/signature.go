@@ -0,0 +1,93 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Antiguedad maxima aceptada para una notificacion firmada
+const NotificationTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidSignature   = errors.New("firma de la notificacion invalida")
+	ErrStaleNotification  = errors.New("la notificacion esta vencida")
+	ErrMissingWebhookData = errors.New("la notificacion no tiene los datos esperados")
+)
+
+// Firma una notificacion como lo hace Mercado Pago: HMAC-SHA256 del manifiesto
+// "id:{data.id};request-id:{x-request-id};ts:{ts};" y devuelve el header x-signature
+func SignNotification(secret, dataID, requestID string, ts int64) string {
+	return fmt.Sprintf("ts=%d,v1=%s", ts, signatureHash(secret, dataID, requestID, strconv.FormatInt(ts, 10)))
+}
+
+// Valida el header x-signature de una notificacion y que no tenga mas de NotificationTolerance
+func VerifySignature(secret, header, requestID, dataID string, now time.Time) error {
+
+	if secret == "" || header == "" {
+		return ErrInvalidSignature
+	}
+
+	var ts, hash string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ts":
+			ts = value
+		case "v1":
+			hash = value
+		}
+	}
+
+	if ts == "" || hash == "" {
+		return ErrInvalidSignature
+	}
+
+	expected := signatureHash(secret, dataID, requestID, ts)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return ErrInvalidSignature
+	}
+
+	// Mercado Pago puede enviar el timestamp en segundos o en milisegundos
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	sentAt := time.Unix(unix, 0)
+	if unix > 1e12 {
+		sentAt = time.UnixMilli(unix)
+	}
+
+	age := now.Sub(sentAt)
+	if age > NotificationTolerance || age < -NotificationTolerance {
+		return ErrStaleNotification
+	}
+
+	return nil
+}
+
+func signatureHash(secret, dataID, requestID, ts string) string {
+
+	var manifest strings.Builder
+	if dataID != "" {
+		// Los ids alfanumericos se firman en minusculas
+		fmt.Fprintf(&manifest, "id:%s;", strings.ToLower(dataID))
+	}
+	if requestID != "" {
+		fmt.Fprintf(&manifest, "request-id:%s;", requestID)
+	}
+	fmt.Fprintf(&manifest, "ts:%s;", ts)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(manifest.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
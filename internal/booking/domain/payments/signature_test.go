@@ -0,0 +1,69 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const (
+	testSecret    = "secreto-webhook"
+	testRequestID = "req-123"
+)
+
+// Header armado a mano con el manifiesto que firma Mercado Pago, independiente de signatureHash
+func manualSignature(dataID string, ts int64) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	fmt.Fprintf(mac, "id:%s;request-id:%s;ts:%d;", dataID, testRequestID, ts)
+	return fmt.Sprintf("ts=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifySignature(t *testing.T) {
+
+	now := time.Now()
+	stale := now.Add(-NotificationTolerance - time.Minute)
+
+	cases := []struct {
+		name   string
+		header string
+		dataID string
+		want   error
+	}{
+		{"valida", SignNotification(testSecret, "123456", testRequestID, now.Unix()), "123456", nil},
+		{"valida con el manifiesto de Mercado Pago", manualSignature("123456", now.Unix()), "123456", nil},
+		{"valida con espacios entre partes", fmt.Sprintf("ts=%d, v1=%s", now.Unix(), signatureHash(testSecret, "123456", testRequestID, fmt.Sprint(now.Unix()))), "123456", nil},
+		{"timestamp en milisegundos", SignNotification(testSecret, "123456", testRequestID, now.UnixMilli()), "123456", nil},
+		{"data id en mayusculas se firma en minusculas", manualSignature("abc123", now.Unix()), "ABC123", nil},
+		{"hash de otro secreto", SignNotification("otro-secreto", "123456", testRequestID, now.Unix()), "123456", ErrInvalidSignature},
+		{"hash de otro pago", SignNotification(testSecret, "999999", testRequestID, now.Unix()), "123456", ErrInvalidSignature},
+		{"hash alterado", fmt.Sprintf("ts=%d,v1=%064d", now.Unix(), 0), "123456", ErrInvalidSignature},
+		{"vencida en segundos", SignNotification(testSecret, "123456", testRequestID, stale.Unix()), "123456", ErrStaleNotification},
+		{"vencida en milisegundos", SignNotification(testSecret, "123456", testRequestID, stale.UnixMilli()), "123456", ErrStaleNotification},
+		{"del futuro", SignNotification(testSecret, "123456", testRequestID, now.Add(NotificationTolerance+time.Minute).Unix()), "123456", ErrStaleNotification},
+		{"sin ts", fmt.Sprintf("v1=%s", signatureHash(testSecret, "123456", testRequestID, fmt.Sprint(now.Unix()))), "123456", ErrInvalidSignature},
+		{"sin v1", fmt.Sprintf("ts=%d", now.Unix()), "123456", ErrInvalidSignature},
+		{"ts no numerico", fmt.Sprintf("ts=abc,v1=%s", signatureHash(testSecret, "123456", testRequestID, "abc")), "123456", ErrInvalidSignature},
+		{"header vacio", "", "123456", ErrInvalidSignature},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifySignature(testSecret, tc.header, testRequestID, tc.dataID, now)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("se esperaba %v, se obtuvo %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureWithoutSecret(t *testing.T) {
+
+	header := SignNotification("", "123456", testRequestID, time.Now().Unix())
+	if err := VerifySignature("", header, testRequestID, "123456", time.Now()); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("sin secreto configurado ninguna notificacion deberia aceptarse, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+package waitlist
+
+import "errors"
+
+var (
+	// La anotacion no existe o pertenece a otro cliente
+	ErrEntryNotFound = errors.New("la anotacion en la lista de espera no existe")
+
+	// El turno dejo de estar libre antes de registrar la oferta
+	ErrSlotTaken = errors.New("el turno ya no esta libre")
+
+	// La oferta no existe, pertenece a otro cliente o ya no esta vigente
+	ErrOfferNotFound = errors.New("la oferta no existe o ya no esta vigente")
+)
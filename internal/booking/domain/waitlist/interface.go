@@ -0,0 +1,26 @@
+package waitlist
+
+import (
+	"context"
+	"time"
+)
+
+type WaitlistRepository interface {
+	Create(ctx context.Context, entry *WaitlistEntry) error
+	GetByID(ctx context.Context, id uint) (*WaitlistEntry, error)
+	ListByClient(ctx context.Context, clientID uint) ([]WaitlistEntry, error)
+	Cancel(ctx context.Context, id uint) error
+	Waiting(ctx context.Context) ([]WaitlistEntry, error)
+	Candidates(ctx context.Context, slot *Slot) ([]WaitlistEntry, error)
+	ServicesDuration(ctx context.Context, entryID uint) (int, error)
+
+	// Turnos
+	GetSlot(ctx context.Context, slotID uint) (*Slot, error)
+	FreeSlots(ctx context.Context, barberID *uint, start, end time.Time) ([]Slot, error)
+
+	// Ofertas
+	CreateOffer(ctx context.Context, offer *WaitlistOffer) error
+	GetOffer(ctx context.Context, offerID uint) (*WaitlistOffer, error)
+	CloseOffer(ctx context.Context, offerID uint, status string) error
+	ExpiredOffers(ctx context.Context, now time.Time) ([]WaitlistOffer, error)
+}
@@ -0,0 +1,45 @@
+package waitlist
+
+import "time"
+
+// Anotacion de un cliente en la lista de espera para un barbero (o cualquiera) en un rango de fechas
+type WaitlistEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ClientID  uint      `gorm:"not null" json:"client_id"`
+	BarberID  *uint     `gorm:"default:null" json:"barber_id"` // nil = cualquier barbero
+	DateFrom  time.Time `gorm:"not null" json:"date_from"`
+	DateTo    time.Time `gorm:"not null" json:"date_to"`
+	Status    string    `gorm:"type:enum('esperando','ofrecido','atendido','cancelado');default:'esperando';not null" json:"status"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Services []WaitlistService `gorm:"foreignKey:WaitlistEntryID;constraint:OnDelete:CASCADE" json:"services"`
+	Offers   []WaitlistOffer   `gorm:"foreignKey:WaitlistEntryID;constraint:OnDelete:CASCADE" json:"offers"`
+}
+
+// Servicios que el cliente quiere realizarse
+type WaitlistService struct {
+	ID              uint `gorm:"primaryKey" json:"id"`
+	WaitlistEntryID uint `gorm:"not null" json:"waitlist_entry_id"`
+	ServiceID       uint `gorm:"not null" json:"service_id"`
+}
+
+// Turno liberado que se le ofrece a un cliente de la lista, queda retenido para el hasta ExpiresAt
+type WaitlistOffer struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	WaitlistEntryID uint      `gorm:"not null" json:"waitlist_entry_id"`
+	SlotID          uint      `gorm:"not null" json:"slot_id"`
+	Status          string    `gorm:"type:enum('ofrecido','aceptado','vencido','rechazado');default:'ofrecido';not null" json:"status"`
+	ExpiresAt       time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Slot Slot `gorm:"foreignKey:SlotID" json:"slot"`
+}
+
+type Slot struct {
+	ID       uint      `gorm:"primaryKey" json:"id"`
+	BarberID uint      `json:"barber_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
@@ -1,41 +1,77 @@
 package helpers
 
-import "github.com/ezep02/rodeo/internal/booking/domain/booking"
+import (
+	"fmt"
 
-func CalculateConsequences(isWithin24h bool, isPaymentComplete string) *booking.CancelationResponse {
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	policy "github.com/ezep02/rodeo/internal/policy/domain"
+)
 
-	isComplete := isPaymentComplete == "total"
+// Traduce la decision de la politica de cancelacion a la respuesta para el cliente.
+// Si el pago no se puede devolver por el proveedor, el reembolso se reemplaza por un cupon
+func CalculateConsequences(decision *policy.Decision, refundable bool) *booking.CancelationResponse {
 
 	response := &booking.CancelationResponse{
-		Canceled:     false,
-		LosesDeposit: false,
+		Outcome:  decision.Outcome,
+		Canceled: false,
+		Message:  decision.Message,
 	}
 
-	// DENTRO DE 24 HORAS
-	if isWithin24h {
-		if isComplete {
-			response.CouponPercent = 50
+	switch decision.Outcome {
+	case policy.OutcomeCoupon:
+		response.RequiresCoupon = true
+		response.CouponPercent = decision.Percentage
+	case policy.OutcomeRefund:
+		if !refundable {
+			response.Outcome = policy.OutcomeCoupon
 			response.RequiresCoupon = true
-			response.Message = "La cancelación está dentro de las 24 horas. Recibirás un cupón del 50%."
-		} else {
-			response.CouponPercent = 0
-			response.RequiresCoupon = false
-			response.LosesDeposit = true
-			response.Message = "La cancelación está dentro de las 24 horas. Perderás la seña abonada."
+			response.CouponPercent = decision.Percentage
+			response.Message = fmt.Sprintf("El pago no admite devolución, recibirás un cupón del %d%%.", decision.Percentage)
+			break
 		}
-		return response
+		response.RequiresRefund = true
+		response.RefundPercent = decision.Percentage
+	case policy.OutcomeForfeitDeposit:
+		response.LosesDeposit = true
 	}
 
-	// FUERA DE 24 HORAS
-	if isComplete {
-		response.CouponPercent = 75
-		response.RequiresCoupon = true
-		response.Message = "La cancelación está fuera de las 24 horas. Recibirás un cupón del 75%."
-	} else {
-		response.CouponPercent = 25
-		response.RequiresCoupon = true
-		response.Message = "La cancelación está fuera de las 24 horas. Recibirás un cupón del 25%."
+	if decision.AllowChoice && refundable && (response.RequiresCoupon || response.RequiresRefund) {
+		response.Choices = []string{policy.OutcomeCoupon, policy.OutcomeRefund}
 	}
 
 	return response
 }
+
+// Aplica la compensacion elegida por el cliente, solo si la politica la ofrece
+func ChooseCompensation(response *booking.CancelationResponse, compensation string) error {
+
+	if compensation == "" || compensation == response.Outcome {
+		return nil
+	}
+
+	allowed := false
+	for _, choice := range response.Choices {
+		if choice == compensation {
+			allowed = true
+		}
+	}
+
+	if !allowed {
+		return booking.ErrCompensationNotAllowed
+	}
+
+	percentage := max(response.CouponPercent, response.RefundPercent)
+
+	response.Outcome = compensation
+	response.RequiresCoupon = compensation == policy.OutcomeCoupon
+	response.RequiresRefund = compensation == policy.OutcomeRefund
+	response.CouponPercent, response.RefundPercent = 0, 0
+
+	if response.RequiresCoupon {
+		response.CouponPercent = percentage
+	} else {
+		response.RefundPercent = percentage
+	}
+
+	return nil
+}
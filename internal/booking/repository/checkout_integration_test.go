@@ -0,0 +1,277 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/coupon"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Pruebas contra MySQL con el esquema de elrodeodb.sql cargado, se ejecutan con
+//
+//	TEST_MYSQL_DSN="user:pass@tcp(localhost:3306)/elrodeodb?parseTime=true&loc=Local" go test -tags integration ./internal/booking/repository/
+//
+// Cada prueba crea sus propios usuarios y turnos y los elimina al terminar
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN no esta definido")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("no fue posible conectar a la base de pruebas: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(32)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+var testUserSeq atomic.Int64
+
+// Crea un usuario de prueba, al eliminarlo se eliminan en cascada sus turnos y reservas
+func createTestUser(t *testing.T, db *gorm.DB, prefix string, isBarber bool) uint {
+	t.Helper()
+
+	name := fmt.Sprintf("%s%d_%d", prefix, time.Now().UnixNano(), testUserSeq.Add(1))
+
+	if err := db.Exec("INSERT INTO users (name, password, email, username, is_barber) VALUES (?, ?, ?, ?, ?)",
+		name, "x", name+"@test.local", name, isBarber).Error; err != nil {
+		t.Fatalf("no fue posible crear el usuario de prueba: %v", err)
+	}
+
+	var id uint
+	if err := db.Raw("SELECT id FROM users WHERE username = ?", name).Scan(&id).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = ?", id) })
+
+	return id
+}
+
+// Crea turnos consecutivos de 30 minutos del barbero a partir de una fecha futura
+func createTestSlots(t *testing.T, db *gorm.DB, barberID uint, count int) []booking.Slot {
+	t.Helper()
+
+	start := time.Now().Add(240 * time.Hour).Truncate(time.Hour)
+	slots := make([]booking.Slot, 0, count)
+	for i := range count {
+		slotStart := start.Add(time.Duration(i) * 30 * time.Minute)
+		slots = append(slots, booking.Slot{BarberID: barberID, Start: slotStart, End: slotStart.Add(30 * time.Minute)})
+	}
+
+	if err := db.Create(&slots).Error; err != nil {
+		t.Fatalf("no fue posible crear los turnos de prueba: %v", err)
+	}
+
+	return slots
+}
+
+// Lanza un checkout por cliente en paralelo y devuelve los errores de cada uno
+func runConcurrentCheckouts(t *testing.T, repo booking.CheckoutRepository, clients []uint, slotFor func(i int) uint, duration int) []error {
+	t.Helper()
+
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make([]error, len(clients))
+	)
+
+	for i, clientID := range clients {
+		wg.Add(1)
+		go func(i int, clientID uint) {
+			defer wg.Done()
+			<-start
+
+			errs[i] = repo.Create(context.Background(), &booking.Checkout{
+				Booking: &booking.Booking{
+					SlotID:      slotFor(i),
+					ClientID:    clientID,
+					Status:      "pendiente_pago",
+					TotalAmount: 1000,
+				},
+				Duration: duration,
+			})
+		}(i, clientID)
+	}
+
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+// Exactamente un checkout gana, el resto recibe ErrSlotTaken
+func assertSingleWinner(t *testing.T, errs []error) {
+	t.Helper()
+
+	var won, taken int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case errors.Is(err, booking.ErrSlotTaken):
+			taken++
+		default:
+			t.Errorf("checkout %d: error inesperado: %v", i, err)
+		}
+	}
+
+	if won != 1 || taken != len(errs)-1 {
+		t.Fatalf("se esperaba 1 reserva y %d ErrSlotTaken, se obtuvieron %d y %d", len(errs)-1, won, taken)
+	}
+}
+
+const concurrentCheckouts = 10
+
+func TestCheckoutConcurrentSingleSlot(t *testing.T) {
+
+	db := openTestDB(t)
+	barberID := createTestUser(t, db, "barber", true)
+	slots := createTestSlots(t, db, barberID, 1)
+
+	clients := make([]uint, concurrentCheckouts)
+	for i := range clients {
+		clients[i] = createTestUser(t, db, "client", false)
+	}
+
+	errs := runConcurrentCheckouts(t, NewGormCheckoutRepo(db, nil), clients, func(int) uint { return slots[0].ID }, 30)
+	assertSingleWinner(t, errs)
+
+	var active int64
+	db.Model(&booking.Booking{}).Where("slot_id = ? AND status IN ?", slots[0].ID, booking.ActiveStatuses).Count(&active)
+	if active != 1 {
+		t.Fatalf("el turno deberia tener una unica reserva activa, tiene %d", active)
+	}
+}
+
+// Reservas de 60 minutos que arrancan en turnos distintos pero comparten el turno del medio. El indice
+// unico solo cubre el turno inicial, el unico resguardo sobre booking_slots es el lock de reserveSlots
+func TestCheckoutConcurrentMultiSlot(t *testing.T) {
+
+	db := openTestDB(t)
+	barberID := createTestUser(t, db, "barber", true)
+	slots := createTestSlots(t, db, barberID, 3)
+
+	clients := make([]uint, concurrentCheckouts)
+	for i := range clients {
+		clients[i] = createTestUser(t, db, "client", false)
+	}
+
+	errs := runConcurrentCheckouts(t, NewGormCheckoutRepo(db, nil), clients, func(i int) uint { return slots[i%2].ID }, 60)
+	assertSingleWinner(t, errs)
+
+	var occupied int64
+	db.Table("booking_slots bs").
+		Joins("JOIN bookings b ON b.id = bs.booking_id").
+		Where("bs.slot_id = ? AND b.status IN ?", slots[1].ID, booking.ActiveStatuses).
+		Count(&occupied)
+	if occupied != 1 {
+		t.Fatalf("el turno del medio deberia estar ocupado por una unica reserva, lo ocupan %d", occupied)
+	}
+}
+
+// Crea un cupon disponible del cliente, se elimina en cascada con el usuario
+func createTestCoupon(t *testing.T, db *gorm.DB, clientID uint) string {
+	t.Helper()
+
+	code := fmt.Sprintf("T%d", testUserSeq.Add(1))
+	if err := db.Create(&coupon.Coupon{Code: code, UserID: clientID, DiscountPercentage: 20, IsAvailable: true, ExpireAt: time.Now().Add(24 * time.Hour)}).Error; err != nil {
+		t.Fatalf("no fue posible crear el cupon de prueba: %v", err)
+	}
+
+	return code
+}
+
+// Checkouts del mismo cliente en turnos distintos con el mismo cupon, solo uno puede retenerlo
+func TestCheckoutConcurrentSameCoupon(t *testing.T) {
+
+	db := openTestDB(t)
+	barberID := createTestUser(t, db, "barber", true)
+	slots := createTestSlots(t, db, barberID, concurrentCheckouts)
+	clientID := createTestUser(t, db, "client", false)
+	code := createTestCoupon(t, db, clientID)
+
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make([]error, concurrentCheckouts)
+		repo  = NewGormCheckoutRepo(db, nil)
+	)
+
+	for i := range concurrentCheckouts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			errs[i] = repo.Create(context.Background(), &booking.Checkout{
+				Booking: &booking.Booking{
+					SlotID:      slots[i].ID,
+					ClientID:    clientID,
+					Status:      "pendiente_pago",
+					TotalAmount: 800,
+					CouponCode:  &code,
+				},
+				Duration: 30,
+			})
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	var won, inUse int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case errors.Is(err, coupon.ErrCouponInUse):
+			inUse++
+		default:
+			t.Errorf("checkout %d: error inesperado: %v", i, err)
+		}
+	}
+
+	if won != 1 || inUse != concurrentCheckouts-1 {
+		t.Fatalf("se esperaba 1 reserva y %d ErrCouponInUse, se obtuvieron %d y %d", concurrentCheckouts-1, won, inUse)
+	}
+}
+
+// Dos notificaciones que canjean el mismo cupon, la segunda no lo vuelve a canjear
+func TestCouponRedeemOnce(t *testing.T) {
+
+	db := openTestDB(t)
+	clientID := createTestUser(t, db, "client", false)
+	code := createTestCoupon(t, db, clientID)
+	repo := NewGormCouponRepo(db, nil)
+
+	if err := repo.Redeem(context.Background(), code); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Redeem(context.Background(), code); !errors.Is(err, coupon.ErrCouponUnavailable) {
+		t.Fatalf("se esperaba ErrCouponUnavailable, se obtuvo %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+)
+
+// FakeGateway es un proveedor de pagos en memoria para desarrollo y pruebas.
+// Los ids son secuenciales, por lo que el flujo es deterministico, y al pagar
+// un checkout envia la notificacion al mismo endpoint que usa Mercado Pago.
+type FakeGateway struct {
+	baseURL string
+	secret  string // firma las notificaciones como Mercado Pago
+	client  *http.Client
+
+	mu        sync.Mutex
+	seq       int
+	checkouts map[string]payments.CheckoutRequest
+	payments  map[string]*payments.ProviderPayment
+	refunds   map[string][]payments.ProviderRefund
+	notifyTo  map[string]string // url de notificacion de cada pago
+	refs      map[string]string // referencia externa de cada pago
+	lastEvent map[string]string // ultima notificacion enviada de cada pago
+}
+
+func NewFakeGateway(baseURL, secret string) *FakeGateway {
+	return &FakeGateway{
+		baseURL:   baseURL,
+		secret:    secret,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		checkouts: make(map[string]payments.CheckoutRequest),
+		payments:  make(map[string]*payments.ProviderPayment),
+		refunds:   make(map[string][]payments.ProviderRefund),
+		notifyTo:  make(map[string]string),
+		refs:      make(map[string]string),
+		lastEvent: make(map[string]string),
+	}
+}
+
+func (g *FakeGateway) nextID(prefix string) string {
+	g.seq++
+	return fmt.Sprintf("%s-%d", prefix, g.seq)
+}
+
+func (g *FakeGateway) CreateCheckout(ctx context.Context, req payments.CheckoutRequest) (*payments.Checkout, error) {
+
+	if req.Amount <= 0 {
+		return nil, errors.New("el monto del checkout debe ser mayor a cero")
+	}
+
+	// Mercado Pago devuelve la metadata como JSON, replicamos ese formato (numeros como float64)
+	metadata, err := roundTripMetadata(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	req.Metadata = metadata
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := g.nextID("pref")
+	g.checkouts[id] = req
+
+	return &payments.Checkout{
+		ID:        id,
+		InitPoint: fmt.Sprintf("%s/api/v1/mercado_pago/fake/checkout/%s", g.baseURL, id),
+	}, nil
+}
+
+func (g *FakeGateway) GetPayment(ctx context.Context, paymentID string) (*payments.ProviderPayment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[paymentID]
+	if !ok {
+		return nil, errors.New("pago no encontrado")
+	}
+
+	copied := *p
+	copied.Refunds = append([]payments.ProviderRefund(nil), g.refunds[paymentID]...)
+	copied.RefundedAmount = g.refunded(paymentID)
+	return &copied, nil
+}
+
+func (g *FakeGateway) SearchPayments(ctx context.Context, externalReference string) ([]payments.ProviderPayment, error) {
+
+	if externalReference == "" {
+		return nil, errors.New("falta la referencia externa")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var list []payments.ProviderPayment
+	for id, ref := range g.refs {
+		if ref != externalReference {
+			continue
+		}
+
+		copied := *g.payments[id]
+		copied.Refunds = append([]payments.ProviderRefund(nil), g.refunds[id]...)
+		copied.RefundedAmount = g.refunded(id)
+		list = append(list, copied)
+	}
+
+	// Los ids son secuenciales, se devuelven en orden de creacion
+	slices.SortFunc(list, func(a, b payments.ProviderPayment) int {
+		return cmp.Compare(fakeSeq(a.ID), fakeSeq(b.ID))
+	})
+
+	return list, nil
+}
+
+func fakeSeq(id string) int {
+	n, _ := strconv.Atoi(id[strings.LastIndex(id, "-")+1:])
+	return n
+}
+
+func (g *FakeGateway) refunded(paymentID string) float64 {
+	var total float64
+	for _, r := range g.refunds[paymentID] {
+		total += r.Amount
+	}
+	return total
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, paymentID string, amount float64) (*payments.ProviderRefund, error) {
+	g.mu.Lock()
+
+	p, ok := g.payments[paymentID]
+	if !ok {
+		g.mu.Unlock()
+		return nil, errors.New("pago no encontrado")
+	}
+
+	if p.Status != "aprobado" {
+		g.mu.Unlock()
+		return nil, errors.New("solo se pueden devolver pagos aprobados")
+	}
+
+	available := p.Amount - g.refunded(paymentID)
+	if amount <= 0 {
+		amount = available
+	}
+
+	if amount > available+0.005 {
+		g.mu.Unlock()
+		return nil, errors.New("el monto a devolver supera lo disponible")
+	}
+
+	refund := payments.ProviderRefund{
+		ID:        g.nextID("refund"),
+		PaymentID: paymentID,
+		Amount:    amount,
+		Status:    "aprobado",
+	}
+	g.refunds[paymentID] = append(g.refunds[paymentID], refund)
+
+	// Como Mercado Pago, una devolucion total deja el pago como reembolsado
+	if g.refunded(paymentID) >= p.Amount-0.005 {
+		p.Status = "reembolsado"
+	}
+
+	url := g.notifyTo[paymentID]
+	g.mu.Unlock()
+
+	// La devolucion se confirma luego por webhook, igual que en Mercado Pago
+	if url != "" {
+		go func() {
+			if err := g.notify(context.Background(), url, paymentID); err != nil {
+				log.Println("[FAKE GATEWAY] error enviando notificacion de devolucion:", err)
+			}
+		}()
+	}
+
+	return &refund, nil
+}
+
+// Pay simula que el cliente completo el checkout con el status indicado
+// (aprobado o rechazado) y envia la notificacion al webhook configurado.
+func (g *FakeGateway) Pay(ctx context.Context, checkoutID, status string) (*payments.ProviderPayment, error) {
+
+	if status != "aprobado" && status != "rechazado" {
+		return nil, errors.New("status invalido, debe ser aprobado o rechazado")
+	}
+
+	g.mu.Lock()
+	req, ok := g.checkouts[checkoutID]
+	if !ok {
+		g.mu.Unlock()
+		return nil, errors.New("checkout no encontrado")
+	}
+
+	if req.ExpiresAt != nil && time.Now().After(*req.ExpiresAt) {
+		g.mu.Unlock()
+		return nil, errors.New("el checkout esta vencido")
+	}
+
+	p := &payments.ProviderPayment{
+		ID:       g.nextID("pay"),
+		Status:   status,
+		Amount:   req.Amount * float64(max(req.Quantity, 1)),
+		Metadata: req.Metadata,
+	}
+
+	if status == "aprobado" {
+		now := time.Now()
+		p.PaidAt = &now
+	}
+
+	g.payments[p.ID] = p
+	g.notifyTo[p.ID] = req.NotificationURL
+	g.refs[p.ID] = req.ExternalReference
+	g.mu.Unlock()
+
+	if req.NotificationURL != "" {
+		if err := g.notify(ctx, req.NotificationURL, p.ID); err != nil {
+			log.Println("[FAKE GATEWAY] error enviando notificacion:", err)
+		}
+	}
+
+	copied := *p
+	return &copied, nil
+}
+
+// Redeliver reenvia la ultima notificacion del pago con el mismo id de evento, como hace
+// Mercado Pago cuando no recibe la confirmacion de una entrega.
+func (g *FakeGateway) Redeliver(ctx context.Context, paymentID string) error {
+
+	g.mu.Lock()
+	url, eventID := g.notifyTo[paymentID], g.lastEvent[paymentID]
+	g.mu.Unlock()
+
+	if url == "" || eventID == "" {
+		return errors.New("el pago no tiene notificaciones enviadas")
+	}
+
+	return g.send(ctx, url, paymentID, eventID)
+}
+
+func (g *FakeGateway) notify(ctx context.Context, url, paymentID string) error {
+
+	g.mu.Lock()
+	eventID := g.nextID("evt")
+	g.lastEvent[paymentID] = eventID
+	g.mu.Unlock()
+
+	return g.send(ctx, url, paymentID, eventID)
+}
+
+// Envia el mismo payload y los mismos headers firmados que Mercado Pago envia a la url de notificacion
+func (g *FakeGateway) send(ctx context.Context, url, paymentID, eventID string) error {
+
+	body, err := json.Marshal(map[string]any{
+		"id":     eventID,
+		"type":   "payment",
+		"action": "payment.updated",
+		"data":   map[string]any{"id": paymentID},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s?data.id=%s&type=payment", url, paymentID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	requestID := eventID + "-req"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-request-id", requestID)
+	req.Header.Set("x-signature", payments.SignNotification(g.secret, paymentID, requestID, time.Now().Unix()))
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook respondio %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func roundTripMetadata(metadata map[string]any) (map[string]any, error) {
+	if metadata == nil {
+		return map[string]any{}, nil
+	}
+
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, errors.New("metadata invalida")
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, errors.New("metadata invalida")
+	}
+
+	return out, nil
+}
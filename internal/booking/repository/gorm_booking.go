@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type GormBookingRepository struct {
@@ -22,26 +25,166 @@ func NewGormBookingRepo(db *gorm.DB, redis *redis.Client) booking.BookingReposit
 	return &GormBookingRepository{db: db, redis: redis}
 }
 
-func (r *GormBookingRepository) Create(ctx context.Context, b *booking.Booking) error {
-	return r.db.WithContext(ctx).Create(b).Error
-}
+func (r *GormBookingRepository) Create(ctx context.Context, b *booking.Booking, actor booking.Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 
-func (r *GormBookingRepository) UpdateStatus(ctx context.Context, bookingID uint, status string) error {
+		if err := booking.CanTransition("", b.Status, actor.Role); err != nil {
+			return err
+		}
 
-	return r.db.WithContext(ctx).
-		Model(&booking.Booking{}).
-		Where("id = ?", bookingID).
-		Update("status", status).Error
+		if err := tx.Create(b).Error; err != nil {
+			return err
+		}
+
+		return recordEvent(tx, b.ID, "", b.Status, actor, "reserva creada")
+	})
 }
 
-// Actualiza el booking con el nuevo id del slot luego de reprogramar
+func (r *GormBookingRepository) UpdateStatus(ctx context.Context, bookingID uint, status string, actor booking.Actor, reason string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return transition(tx, bookingID, status, actor, reason)
+	})
+}
+
+// Actualiza el booking con el nuevo id del slot luego de reprogramar, siempre que los nuevos turnos esten libres
 func (r *GormBookingRepository) UpdateSlot(ctx context.Context, bookingID, slotID uint) error {
-	return r.db.WithContext(ctx).Model(&booking.Booking{}).Where("id = ?", bookingID).Update("slot_id", slotID).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return moveBooking(tx, bookingID, slotID)
+	})
+}
+
+// Mueve la reserva al nuevo turno, la marca reprogramada y registra el cobro del recargo en una unica
+// transaccion: si el turno ya no esta libre no queda nada registrado. Un cobro del proveedor ya
+// registrado indica que la reprogramacion ya se aplico y no se repite
+func (r *GormBookingRepository) RescheduleWithCharge(ctx context.Context, bookingID, slotID uint, actor booking.Actor, charge *payments.Payment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if charge != nil && charge.MercadoPagoID != nil {
+			var recorded int64
+			if err := tx.Model(&payments.Payment{}).
+				Where("mercado_pago_id = ? AND kind = ?", *charge.MercadoPagoID, payments.KindCharge).
+				Count(&recorded).Error; err != nil {
+				return err
+			}
+
+			if recorded > 0 {
+				return nil
+			}
+		}
+
+		if err := moveBooking(tx, bookingID, slotID); err != nil {
+			return err
+		}
+
+		if err := transition(tx, bookingID, "reprogramado", actor, "turno reprogramado"); err != nil {
+			return err
+		}
+
+		if charge == nil {
+			return nil
+		}
+
+		charge.BookingID = bookingID
+		return tx.Create(charge).Error
+	})
+}
+
+// Pasos para mover la reserva al nuevo turno dentro de la transaccion tx
+func moveBooking(tx *gorm.DB, bookingID, slotID uint) error {
+
+	// 1. Duracion de los servicios de la reserva
+	var duration int
+	if err := tx.Table("booking_services bs").
+		Select("COALESCE(SUM(s.duration_minutes), 0)").
+		Joins("JOIN services s ON s.id = bs.service_id").
+		Where("bs.booking_id = ?", bookingID).
+		Scan(&duration).Error; err != nil {
+		return err
+	}
+
+	// 2. Reservar los nuevos turnos
+	var clientID uint
+	if err := tx.Model(&booking.Booking{}).Select("client_id").Where("id = ?", bookingID).Scan(&clientID).Error; err != nil {
+		return err
+	}
+
+	run, err := reserveSlots(tx, slotID, duration, bookingID, clientID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&booking.Booking{}).Where("id = ?", bookingID).Update("slot_id", slotID).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return booking.ErrSlotTaken
+		}
+		return err
+	}
+
+	// 3. Liberar los turnos anteriores y registrar los nuevos
+	if err := setBookingSlots(tx, bookingID, run); err != nil {
+		return err
+	}
+
+	return claimHeldSlots(tx, run, clientID)
+}
+
+// Indica si el turno tiene una reserva activa distinta a exceptBookingID o cae dentro de una ausencia
+func (r *GormBookingRepository) IsSlotTaken(ctx context.Context, slotID, exceptBookingID uint) (bool, error) {
+
+	var slot booking.Slot
+	if err := r.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", slotID).Take(&slot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, booking.ErrSlotNotFound
+		}
+		return false, err
+	}
+
+	blocked, err := slotsBlocked(r.db.WithContext(ctx), slot.BarberID, slot.Start, slot.End)
+	if err != nil || blocked {
+		return blocked, err
+	}
+
+	return slotsTaken(r.db.WithContext(ctx), []uint{slotID}, exceptBookingID)
+}
+
+func (r *GormBookingRepository) GetSlot(ctx context.Context, slotID uint) (*booking.Slot, error) {
+	var slot booking.Slot
+	if err := r.db.WithContext(ctx).
+		Where("id = ?", slotID).
+		First(&slot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &slot, nil
 }
 
 // Cliente cancela la cita
-func (r *GormBookingRepository) Cancel(ctx context.Context, bookingID uint) error {
-	return r.db.WithContext(ctx).Model(&booking.Booking{}).Where("id = ?", bookingID).Update("status", "cancelado").Error
+func (r *GormBookingRepository) Cancel(ctx context.Context, bookingID uint, actor booking.Actor, reason string) error {
+	return r.UpdateStatus(ctx, bookingID, "cancelado", actor, reason)
+}
+
+// La devolucion queda pendiente y sin id del proveedor hasta que se solicita, si la solicitud falla
+// el job de reintentos la vuelve a enviar
+func (r *GormBookingRepository) CancelWithRefund(ctx context.Context, bookingID uint, actor booking.Actor, reason string, refunds ...*payments.Payment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := transition(tx, bookingID, "cancelado", actor, reason); err != nil {
+			return err
+		}
+
+		for _, refund := range refunds {
+			if refund == nil {
+				continue
+			}
+			if err := tx.Create(refund).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func (r *GormBookingRepository) GetByID(ctx context.Context, bookingID uint) (*booking.Booking, error) {
@@ -49,7 +192,7 @@ func (r *GormBookingRepository) GetByID(ctx context.Context, bookingID uint) (*b
 	if err := r.db.WithContext(ctx).
 		Preload("Client").
 		Preload("Slot").
-		Preload("Services").
+		Preload("BookingServices.Service").
 		Where("id = ?", bookingID).
 		First(&b).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -60,18 +203,71 @@ func (r *GormBookingRepository) GetByID(ctx context.Context, bookingID uint) (*b
 	return &b, nil
 }
 
-// Cuando se paga la cita, se marca como confirmada para que no sea cancelada
-func (r *GormBookingRepository) MarkAsPaid(ctx context.Context, bookingID uint) error {
-	return r.db.WithContext(ctx).Model(&booking.Booking{}).Where("id = ?", bookingID).Update("status", "confirmado").Error
+// Cuando se paga la cita, se marca como confirmada para que no sea cancelada,
+// o como pagada si con ese pago el saldo quedo en cero
+func (r *GormBookingRepository) MarkAsPaid(ctx context.Context, bookingID uint, actor booking.Actor) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var current booking.Booking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status").
+			Where("id = ?", bookingID).
+			Take(&current).Error; err != nil {
+			return err
+		}
+
+		// El pago ya fue contabilizado (notificacion repetida o reserva ya confirmada). Las reservas
+		// canceladas o rechazadas siguen de largo y la maquina de estados las rechaza
+		if current.Status != "pendiente_pago" && slices.Contains(booking.ActiveStatuses, current.Status) {
+			return nil
+		}
+
+		// Un pago que llega despues del vencimiento solo recupera la reserva si sus turnos siguen libres
+		if current.Status == "expirado" {
+			var slotIDs []uint
+			if err := tx.Model(&booking.BookingSlot{}).Where("booking_id = ?", bookingID).Pluck("slot_id", &slotIDs).Error; err != nil {
+				return err
+			}
+
+			if len(slotIDs) > 0 {
+				taken, err := slotsTaken(tx, slotIDs, bookingID)
+				if err != nil {
+					return err
+				}
+				if taken {
+					return booking.ErrBookingExpired
+				}
+			}
+		}
+
+		balance, err := balanceDue(tx, bookingID)
+		if err != nil {
+			return err
+		}
+
+		status := "confirmado"
+		if balance <= 0.005 {
+			status = "pagado"
+		}
+
+		if err := transition(tx, bookingID, status, actor, "pago aprobado"); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return booking.ErrBookingExpired
+			}
+			return err
+		}
+
+		return nil
+	})
 }
 
 // Marcar como rechazado un booking, accion realizada solo por un administrador
-func (r *GormBookingRepository) MarkAsRejected(ctx context.Context, bookingID uint) error {
-	return r.db.WithContext(ctx).Model(&booking.Booking{}).Where("id = ?", bookingID).Update("status", "rechazado").Error
+func (r *GormBookingRepository) MarkAsRejected(ctx context.Context, bookingID uint, actor booking.Actor, reason string) error {
+	return r.UpdateStatus(ctx, bookingID, "rechazado", actor, reason)
 }
 
-func (r *GormBookingRepository) MarkAsRescheduled(ctx context.Context, bookingID uint) error {
-	return r.db.WithContext(ctx).Model(&booking.Booking{}).Where("id = ?", bookingID).Update("status", "reprogramado").Error
+func (r *GormBookingRepository) MarkAsRescheduled(ctx context.Context, bookingID uint, actor booking.Actor) error {
+	return r.UpdateStatus(ctx, bookingID, "reprogramado", actor, "turno reprogramado")
 }
 
 // Devuelve las proximas citas dado un id de barbero
@@ -94,7 +290,7 @@ func (r *GormBookingRepository) Upcoming(ctx context.Context, barberID uint, dat
 	query := r.db.WithContext(ctx).
 		Preload("Client").
 		Preload("Slot").
-		Preload("Services").
+		Preload("BookingServices.Service").
 		Joins("JOIN slots s ON s.id = bookings.slot_id").
 		Where("s.barber_id = ?", barberID).
 		Where("s.start >= ? AND s.start < ?", startOfDay, endOfDay).
@@ -133,20 +329,21 @@ func (r *GormBookingRepository) StatsByBarberID(ctx context.Context, barberID ui
 		}
 	}
 
-	// Query base
+	// Query base, la sesion permite reutilizarla sin acumular las condiciones de cada conteo
 	baseQuery := r.db.WithContext(ctx).
 		Table("bookings b").
 		Joins("JOIN slots s ON s.id = b.slot_id").
-		Where("s.barber_id = ?", barberID)
+		Where("s.barber_id = ?", barberID).
+		Session(&gorm.Session{})
 
 	// Total bookings
 	if err := baseQuery.Count(&stats.TotalBookings).Error; err != nil {
 		return nil, err
 	}
 
-	// Confirmadas
+	// Confirmadas, aun sin atender
 	if err := baseQuery.
-		Where("b.status = ?", "confirmado").
+		Where("b.status IN ?", booking.OpenStatuses).
 		Count(&stats.PendingBookings).Error; err != nil {
 		return nil, err
 	}
@@ -165,15 +362,17 @@ func (r *GormBookingRepository) StatsByBarberID(ctx context.Context, barberID ui
 		return nil, err
 	}
 
-	// Ingresos estimados
-	revenueQuery := r.db.WithContext(ctx).
-		Table("bookings b").
-		Joins("JOIN slots s ON s.id = b.slot_id").
-		Where("s.barber_id = ?", barberID)
+	// Ausencias
+	if err := baseQuery.
+		Where("b.status = ?", "ausente").
+		Count(&stats.NoShowBookings).Error; err != nil {
+		return nil, err
+	}
 
-	if err := revenueQuery.
+	// Ingresos estimados, de las citas por atender y las ya atendidas
+	if err := baseQuery.
 		Select("COALESCE(SUM(b.total_amount), 0)").
-		Where("b.status = ?", "confirmado").
+		Where("b.status IN ?", append([]string{"completado"}, booking.OpenStatuses...)).
 		Scan(&stats.ExpectedRevenue).Error; err != nil {
 		return nil, err
 	}
@@ -231,19 +430,148 @@ func (r *GormBookingRepository) GetByUserID(ctx context.Context, userID uint, of
 	return bookings, nil
 }
 
-// Proceso en segundo plano para eliminar los bookings que no fueron abonados
-func (r *GormBookingRepository) StartBookingCleanupJob(interval time.Duration) {
+// Marca como expiradas las reservas cuyo pago no se completo a tiempo. La reserva se conserva
+// para el historial y deja de ocupar sus turnos al salir de los estados activos
+func (r *GormBookingRepository) ExpirePending(ctx context.Context, now time.Time) ([]booking.Booking, error) {
+	var expired []booking.Booking
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ? AND expires_at < ?", "pendiente_pago", now).
+			Find(&expired).Error; err != nil {
+			return err
+		}
+
+		if len(expired) == 0 {
+			return nil
+		}
 
-	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
-			now := time.Now()
-			if err := r.db.
-				Where("status = ? AND expires_at < ?", "pendiente_pago", now).
-				Delete(&booking.Booking{}).Error; err != nil {
-				log.Println("Error cancelando bookings expirados:", err)
+		for i := range expired {
+			if err := transition(tx, expired[i].ID, "expirado", booking.SystemActor(), "el pago no se completo a tiempo"); err != nil {
+				return err
 			}
-			log.Println("[CONSULTING EXPIRED BOOKINGS]")
+			expired[i].Status = "expirado"
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// Marca las reservas cuyo turno termino antes de before sin cerrarse como completadas o ausentes,
+// para que el barbero las resuelva. Cada reserva se marca una sola vez
+func (r *GormBookingRepository) FlagUnclosed(ctx context.Context, before time.Time) (int64, error) {
+
+	res := r.db.WithContext(ctx).
+		Model(&booking.Booking{}).
+		Where("status IN ? AND flagged_at IS NULL", booking.OpenStatuses).
+		Where("slot_id IN (?)", r.db.Table("slots").Select("slots.id").Where("slots.end < ?", before)).
+		Update("flagged_at", time.Now())
+
+	return res.RowsAffected, res.Error
+}
+
+// Reservas marcadas que siguen sin cerrarse, de un barbero o de todos si barberID es 0
+func (r *GormBookingRepository) Unclosed(ctx context.Context, barberID uint) ([]booking.Booking, error) {
+	var bookings []booking.Booking
+
+	query := r.db.WithContext(ctx).
+		Preload("Client", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "email", "surname", "avatar")
+		}).
+		Preload("Slot").
+		Preload("BookingServices.Service").
+		Joins("JOIN slots s ON s.id = bookings.slot_id").
+		Where("bookings.flagged_at IS NOT NULL AND bookings.status IN ?", booking.OpenStatuses).
+		Order("s.start ASC")
+
+	if barberID != 0 {
+		query = query.Where("s.barber_id = ?", barberID)
+	}
+
+	if err := query.Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+// Cantidad de ausencias del cliente en turnos desde since
+func (r *GormBookingRepository) CountNoShows(ctx context.Context, clientID uint, since time.Time) (int64, error) {
+	var count int64
+
+	if err := r.db.WithContext(ctx).
+		Table("bookings b").
+		Joins("JOIN slots s ON s.id = b.slot_id").
+		Where("b.client_id = ? AND b.status = ? AND s.start >= ?", clientID, "ausente", since).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *GormBookingRepository) FindSlot(ctx context.Context, barberID uint, start time.Time) (*booking.Slot, error) {
+	var slot booking.Slot
+	if err := r.db.WithContext(ctx).
+		Where("barber_id = ? AND start = ? AND deleted_at IS NULL", barberID, start).
+		Take(&slot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
 		}
-	}()
+		return nil, err
+	}
+	return &slot, nil
+}
+
+func (r *GormBookingRepository) ByBarberRange(ctx context.Context, barberID uint, from, to time.Time, statuses []string) ([]booking.Booking, error) {
+	var bookings []booking.Booking
+
+	if err := r.db.WithContext(ctx).
+		Preload("Client", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "email", "surname", "avatar")
+		}).
+		Preload("Slot").
+		Joins("JOIN slots s ON s.id = bookings.slot_id").
+		Where("s.barber_id = ? AND s.start >= ? AND s.start < ?", barberID, from, to).
+		Where("bookings.status IN ?", statuses).
+		Order("s.start ASC").
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+func (r *GormBookingRepository) SlotIDs(ctx context.Context, bookingID uint) ([]uint, error) {
+	var slotIDs []uint
+
+	if err := r.db.WithContext(ctx).
+		Model(&booking.BookingSlot{}).
+		Where("booking_id = ?", bookingID).
+		Order("id ASC").
+		Pluck("slot_id", &slotIDs).Error; err != nil {
+		return nil, err
+	}
+
+	return slotIDs, nil
+}
+
+func (r *GormBookingRepository) ByGroup(ctx context.Context, groupID uint) ([]booking.Booking, error) {
+	var bookings []booking.Booking
+
+	if err := r.db.WithContext(ctx).
+		Preload("Slot").
+		Where("group_id = ?", groupID).
+		Order("id ASC").
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	return bookings, nil
 }
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Unico punto donde cambia el estado de una reserva: bloquea la fila, valida el cambio contra
+// la maquina de estados y registra el evento. Si la reserva ya esta en el estado pedido y el
+// cambio no esta permitido no hace nada, asi las acciones repetidas (webhooks) son idempotentes.
+// Los demas modulos (turnos incluido) cambian estados a traves de los flujos del BookingService;
+// TestBookingStatusOnlyChangesInTransition falla ante cualquier otra escritura de bookings.status
+func transition(tx *gorm.DB, bookingID uint, to string, actor booking.Actor, reason string) error {
+
+	var current booking.Booking
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "status").
+		Where("id = ?", bookingID).
+		Take(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("la reserva no existe")
+		}
+		return err
+	}
+
+	if err := booking.CanTransition(current.Status, to, actor.Role); err != nil {
+		if current.Status == to {
+			return nil
+		}
+		return err
+	}
+
+	if err := tx.Model(&booking.Booking{}).Where("id = ?", bookingID).Update("status", to).Error; err != nil {
+		return err
+	}
+
+	return recordEvent(tx, bookingID, current.Status, to, actor, reason)
+}
+
+func recordEvent(tx *gorm.DB, bookingID uint, from, to string, actor booking.Actor, reason string) error {
+	return tx.Create(&booking.BookingEvent{
+		BookingID:  bookingID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorRole:  actor.Role,
+		ActorID:    actor.UserID,
+		Reason:     reason,
+	}).Error
+}
+
+func (r *GormBookingRepository) Events(ctx context.Context, bookingID uint) ([]booking.BookingEvent, error) {
+	var events []booking.BookingEvent
+
+	if err := r.db.WithContext(ctx).
+		Where("booking_id = ?", bookingID).
+		Order("created_at ASC, id ASC").
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
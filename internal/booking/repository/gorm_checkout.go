@@ -0,0 +1,380 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/coupon"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormCheckoutRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormCheckoutRepo(db *gorm.DB, redis *redis.Client) booking.CheckoutRepository {
+	return &GormCheckoutRepository{db: db, redis: redis}
+}
+
+// Crea booking, payment y booking_services en una unica transaccion, si algo falla no queda nada persistido
+func (r *GormCheckoutRepository) Create(ctx context.Context, checkout *booking.Checkout) error {
+
+	if err := validateCheckout(checkout); err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createCheckout(tx, checkout)
+	})
+}
+
+// Crea el grupo y luego cada asistente con el mismo proceso que un checkout individual
+func (r *GormCheckoutRepository) CreateGroup(ctx context.Context, group *booking.BookingGroup, checkouts []*booking.Checkout) error {
+
+	if group == nil || len(checkouts) == 0 {
+		return errors.New("checkout grupal incompleto")
+	}
+
+	for _, checkout := range checkouts {
+		if err := validateCheckout(checkout); err != nil {
+			return err
+		}
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Omit("Bookings").Create(group).Error; err != nil {
+			return err
+		}
+
+		for _, checkout := range checkouts {
+			checkout.Booking.GroupID = &group.ID
+			if err := createCheckout(tx, checkout); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Verifica sin bloquear nada que los turnos necesarios para la duracion esten libres para el cliente,
+// devuelve el error de turno que recibiria el checkout
+func (r *GormCheckoutRepository) CheckAvailability(ctx context.Context, slotID uint, duration int, clientID uint) error {
+	_, err := checkSlots(r.db.WithContext(ctx), slotID, duration, 0, clientID, false)
+	return err
+}
+
+func (r *GormCheckoutRepository) SetGroupCheckout(ctx context.Context, groupID uint, checkout *payments.Checkout) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Model(&booking.BookingGroup{}).
+			Where("id = ?", groupID).
+			Update("payment_url", checkout.InitPoint).Error; err != nil {
+			return err
+		}
+
+		return setCoveredCheckout(tx, "group_id", groupID, checkout)
+	})
+}
+
+// Registra el checkout compartido en los cobros pendientes de las reservas que abona, asi la
+// conciliacion los encuentra aunque la notificacion se pierda
+func setCoveredCheckout(tx *gorm.DB, column string, id uint, checkout *payments.Checkout) error {
+	return tx.Model(&payments.Payment{}).
+		Where("kind = ? AND status = ?", payments.KindCharge, "pendiente").
+		Where("booking_id IN (SELECT id FROM bookings WHERE "+column+" = ?)", id).
+		Updates(map[string]any{
+			"preference_id": checkout.ID,
+			"payment_url":   checkout.InitPoint,
+		}).Error
+}
+
+func validateCheckout(checkout *booking.Checkout) error {
+
+	if checkout == nil || checkout.Booking == nil {
+		return errors.New("checkout incompleto")
+	}
+
+	return booking.CanTransition("", checkout.Booking.Status, booking.ActorClient)
+}
+
+// Pasos del checkout dentro de la transaccion tx
+func createCheckout(tx *gorm.DB, checkout *booking.Checkout) error {
+
+	// 1. Bloquear los turnos hasta terminar la transaccion y verificar que sigan libres
+	run, err := reserveSlots(tx, checkout.Booking.SlotID, checkout.Duration, 0, checkout.Booking.ClientID)
+	if err != nil {
+		return err
+	}
+
+	// El cupon queda retenido por la reserva hasta que se apruebe el pago o la reserva se libere
+	if checkout.Booking.CouponCode != nil && *checkout.Booking.CouponCode != "" {
+		if err := holdCoupon(tx, *checkout.Booking.CouponCode, checkout.Booking.ClientID); err != nil {
+			return err
+		}
+	}
+
+	// 2. Crear booking (sin tocar las asociaciones)
+	if err := tx.Omit(clause.Associations).Create(checkout.Booking).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return booking.ErrSlotTaken
+		}
+		return err
+	}
+
+	if err := recordEvent(tx, checkout.Booking.ID, "", checkout.Booking.Status, booking.NewActor(booking.ActorClient, checkout.Booking.ClientID), "reserva creada"); err != nil {
+		return err
+	}
+
+	// 3. Registrar los turnos ocupados
+	if err := setBookingSlots(tx, checkout.Booking.ID, run); err != nil {
+		return err
+	}
+	checkout.Slots = run
+
+	// Si el turno le fue ofrecido desde la lista de espera, la oferta queda aceptada
+	if err := claimHeldSlots(tx, run, checkout.Booking.ClientID); err != nil {
+		return err
+	}
+
+	// 4. Crear payment, si la reserva se abona al reservar
+	if checkout.Payment != nil {
+		checkout.Payment.BookingID = checkout.Booking.ID
+		if err := tx.Create(checkout.Payment).Error; err != nil {
+			return err
+		}
+	}
+
+	// 5. Relacionar los servicios
+	for i := range checkout.Services {
+		checkout.Services[i].BookingID = checkout.Booking.ID
+	}
+
+	if len(checkout.Services) > 0 {
+		if err := tx.Create(&checkout.Services).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Bloquea (SELECT ... FOR UPDATE) el turno inicial y los turnos consecutivos del mismo barbero
+// necesarios para cubrir la duracion en minutos, y verifica que ninguno tenga otra reserva activa
+// ni este retenido por una oferta de la lista de espera para otro cliente.
+// Dos checkouts concurrentes sobre los mismos turnos quedan serializados por el lock, el segundo
+// encuentra la reserva del primero y recibe ErrSlotTaken. El indice unico uq_booking_active_slot
+// cubre cualquier escritura sobre el turno inicial que no pase por aca.
+func reserveSlots(tx *gorm.DB, slotID uint, duration int, exceptBookingID, clientID uint) ([]booking.Slot, error) {
+	return checkSlots(tx, slotID, duration, exceptBookingID, clientID, true)
+}
+
+// Mismas verificaciones que reserveSlots, con lock solo si se va a reservar
+func checkSlots(tx *gorm.DB, slotID uint, duration int, exceptBookingID, clientID uint, lock bool) ([]booking.Slot, error) {
+
+	var first booking.Slot
+	if err := lockIf(tx, lock).
+		Where("id = ? AND deleted_at IS NULL", slotID).
+		Take(&first).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, booking.ErrSlotNotFound
+		}
+		return nil, err
+	}
+
+	run := []booking.Slot{first}
+	needed := time.Duration(duration) * time.Minute
+	covered := first.End.Sub(first.Start)
+
+	// Sumar turnos consecutivos hasta cubrir la duracion
+	if covered < needed {
+		var next []booking.Slot
+		if err := lockIf(tx, lock).
+			Where("slots.barber_id = ? AND slots.start >= ? AND slots.start < ? AND slots.deleted_at IS NULL", first.BarberID, first.End, first.Start.Add(needed)).
+			Order("slots.start ASC").
+			Find(&next).Error; err != nil {
+			return nil, err
+		}
+
+		cursor := first.End
+		for _, s := range next {
+			if covered >= needed || !s.Start.Equal(cursor) {
+				break
+			}
+			run = append(run, s)
+			covered += s.End.Sub(s.Start)
+			cursor = s.End
+		}
+
+		if covered < needed {
+			return nil, booking.ErrSlotTooShort
+		}
+	}
+
+	blocked, err := slotsBlocked(tx, first.BarberID, first.Start, run[len(run)-1].End)
+	if err != nil {
+		return nil, err
+	}
+
+	if blocked {
+		return nil, booking.ErrSlotUnavailable
+	}
+
+	ids := make([]uint, 0, len(run))
+	for _, s := range run {
+		ids = append(ids, s.ID)
+	}
+
+	taken, err := slotsTaken(tx, ids, exceptBookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, booking.ErrSlotTaken
+	}
+
+	held, err := slotsHeld(tx, ids, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if held {
+		return nil, booking.ErrSlotTaken
+	}
+
+	return run, nil
+}
+
+func lockIf(tx *gorm.DB, lock bool) *gorm.DB {
+	if lock {
+		return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return tx
+}
+
+// Indica si alguno de los turnos esta ocupado por una reserva activa, ya sea como turno inicial
+// o como turno consecutivo registrado en booking_slots
+func slotsTaken(db *gorm.DB, slotIDs []uint, exceptBookingID uint) (bool, error) {
+	var active int64
+
+	if err := db.Model(&booking.Booking{}).
+		Where("bookings.id <> ? AND bookings.status IN ?", exceptBookingID, booking.ActiveStatuses).
+		Where("(bookings.slot_id IN ? OR EXISTS (SELECT 1 FROM booking_slots bs WHERE bs.booking_id = bookings.id AND bs.slot_id IN ?))", slotIDs, slotIDs).
+		Count(&active).Error; err != nil {
+		return false, err
+	}
+
+	return active > 0, nil
+}
+
+// Indica si el rango se superpone con una ausencia del barbero o un cierre del local
+func slotsBlocked(db *gorm.DB, barberID uint, start, end time.Time) (bool, error) {
+	var blocked int64
+
+	if err := db.Table("time_offs").
+		Where("(barber_id = ? OR barber_id IS NULL) AND start < ? AND end > ?", barberID, end, start).
+		Count(&blocked).Error; err != nil {
+		return false, err
+	}
+
+	return blocked > 0, nil
+}
+
+// Indica si alguno de los turnos esta retenido por una oferta vigente de la lista de espera para otro cliente
+func slotsHeld(db *gorm.DB, slotIDs []uint, clientID uint) (bool, error) {
+	var held int64
+
+	if err := db.Table("waitlist_offers wo").
+		Joins("JOIN waitlist_entries we ON we.id = wo.waitlist_entry_id").
+		Where("wo.slot_id IN ? AND wo.status = ? AND wo.expires_at > ?", slotIDs, "ofrecido", time.Now()).
+		Where("we.client_id <> ?", clientID).
+		Count(&held).Error; err != nil {
+		return false, err
+	}
+
+	return held > 0, nil
+}
+
+// Bloquea el cupon disponible del cliente y verifica que ninguna otra reserva pendiente de pago lo tenga
+// aplicado. Dos checkouts con el mismo cupon quedan serializados por el lock; el conteo es una lectura
+// con lock para ver la reserva que el primero ya confirmo
+func holdCoupon(tx *gorm.DB, code string, clientID uint) error {
+
+	var c coupon.Coupon
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ? AND user_id = ? AND is_available = ?", code, clientID, true).
+		Take(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return coupon.ErrCouponUnavailable
+		}
+		return err
+	}
+
+	var held int64
+	if err := tx.Model(&booking.Booking{}).
+		Clauses(clause.Locking{Strength: "SHARE"}).
+		Where("coupon_code = ? AND status = ?", code, "pendiente_pago").
+		Count(&held).Error; err != nil {
+		return err
+	}
+
+	if held > 0 {
+		return coupon.ErrCouponInUse
+	}
+
+	return nil
+}
+
+// Marca como aceptadas las ofertas de la lista de espera del cliente sobre los turnos reservados
+func claimHeldSlots(tx *gorm.DB, run []booking.Slot, clientID uint) error {
+
+	ids := make([]uint, 0, len(run))
+	for _, s := range run {
+		ids = append(ids, s.ID)
+	}
+
+	var entryIDs []uint
+	if err := tx.Table("waitlist_offers wo").
+		Joins("JOIN waitlist_entries we ON we.id = wo.waitlist_entry_id").
+		Where("wo.slot_id IN ? AND wo.status = ? AND we.client_id = ?", ids, "ofrecido", clientID).
+		Pluck("wo.waitlist_entry_id", &entryIDs).Error; err != nil {
+		return err
+	}
+
+	if len(entryIDs) == 0 {
+		return nil
+	}
+
+	if err := tx.Table("waitlist_offers").
+		Where("slot_id IN ? AND status = ? AND waitlist_entry_id IN ?", ids, "ofrecido", entryIDs).
+		Update("status", "aceptado").Error; err != nil {
+		return err
+	}
+
+	return tx.Table("waitlist_entries").
+		Where("id IN ?", entryIDs).
+		Update("status", "atendido").Error
+}
+
+// Reemplaza los turnos registrados de una reserva
+func setBookingSlots(tx *gorm.DB, bookingID uint, run []booking.Slot) error {
+
+	if err := tx.Where("booking_id = ?", bookingID).Delete(&booking.BookingSlot{}).Error; err != nil {
+		return err
+	}
+
+	rows := make([]booking.BookingSlot, 0, len(run))
+	for _, s := range run {
+		rows = append(rows, booking.BookingSlot{BookingID: bookingID, SlotID: s.ID})
+	}
+
+	return tx.Create(&rows).Error
+}
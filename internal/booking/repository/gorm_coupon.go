@@ -49,13 +49,36 @@ func (r *GormCouponRepository) GetByUserID(ctx context.Context, userID uint) ([]
 	return coupons, nil
 }
 
-func (r *GormCouponRepository) UpdateStatus(ctx context.Context, code string) error {
-	now := time.Now()
-	return r.db.WithContext(ctx).
+// Solo canjea un cupon disponible, dos pagos que intentan canjear el mismo cupon no pueden hacerlo ambos
+func (r *GormCouponRepository) Redeem(ctx context.Context, code string) error {
+	res := r.db.WithContext(ctx).
 		Model(&coupon.Coupon{}).
-		Where("code = ?", code).
+		Where("code = ? AND is_available = ?", code, true).
 		Updates(map[string]any{
 			"is_available": false,
-			"used_at":      now,
-		}).Error
+			"used_at":      time.Now(),
+		})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return coupon.ErrCouponUnavailable
+	}
+
+	return nil
+}
+
+func (r *GormCouponRepository) HeldByPendingBooking(ctx context.Context, code string) (bool, error) {
+	var held int64
+
+	if err := r.db.WithContext(ctx).
+		Table("bookings").
+		Where("coupon_code = ? AND status = ?", code, "pendiente_pago").
+		Count(&held).Error; err != nil {
+		return false, err
+	}
+
+	return held > 0, nil
 }
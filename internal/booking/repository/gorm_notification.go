@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/notification"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type GormNotificationRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormNotificationRepo(db *gorm.DB, redis *redis.Client) notification.NotificationRepository {
+	return &GormNotificationRepository{db: db, redis: redis}
+}
+
+func (r *GormNotificationRepository) Create(ctx context.Context, n *notification.Notification) error {
+	return r.db.WithContext(ctx).Create(n).Error
+}
+
+// Notificaciones del usuario, las mas recientes primero
+func (r *GormNotificationRepository) ListByUser(ctx context.Context, userID uint, limit int) ([]notification.Notification, error) {
+	var list []notification.Notification
+
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (r *GormNotificationRepository) MarkRead(ctx context.Context, id, userID uint) error {
+	res := r.db.WithContext(ctx).
+		Model(&notification.Notification{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Update("read_at", time.Now())
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return notification.ErrNotificationNotFound
+	}
+
+	return nil
+}
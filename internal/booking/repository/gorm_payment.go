@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"log"
+	"math"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type GormPaymentRepository struct {
@@ -27,14 +29,29 @@ func (r *GormPaymentRepository) Create(ctx context.Context, p *payments.Payment)
 	return r.db.WithContext(ctx).Create(p).Error
 }
 
+func (r *GormPaymentRepository) CreateWithRefund(ctx context.Context, charge, refund *payments.Payment) error {
+	if charge == nil || refund == nil {
+		return errors.New("payment es nil")
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Create(charge).Error; err != nil {
+			return err
+		}
+
+		refund.RefundOf = &charge.ID
+		return tx.Create(refund).Error
+	})
+}
+
 func (r *GormPaymentRepository) GetByBookingID(ctx context.Context, bookingID uint) (*payments.Payment, error) {
-	var payments *payments.Payment
+	var payment *payments.Payment
 	if err := r.db.WithContext(ctx).
-		Where("booking_id = ?", bookingID).
-		Find(&payments).Error; err != nil {
+		Where("booking_id = ? AND kind = ? AND concept = ?", bookingID, payments.KindCharge, payments.ConceptBooking).
+		Find(&payment).Error; err != nil {
 		return nil, err
 	}
-	return payments, nil
+	return payment, nil
 }
 
 func (r *GormPaymentRepository) UpdateStatus(ctx context.Context, paymentID uint, status string, paidAt *time.Time) error {
@@ -74,3 +91,313 @@ func (r *GormPaymentRepository) MarkAsPaid(ctx context.Context, paymentID uint,
 
 	return nil
 }
+
+func (r *GormPaymentRepository) GetByProviderID(ctx context.Context, providerPaymentID string) (*payments.Payment, error) {
+	var p payments.Payment
+
+	if err := r.db.WithContext(ctx).
+		Where("mercado_pago_id = ? AND kind = ?", providerPaymentID, payments.KindCharge).
+		Order("id ASC").
+		Take(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *GormPaymentRepository) GetByID(ctx context.Context, paymentID uint) (*payments.Payment, error) {
+	var p payments.Payment
+
+	if err := r.db.WithContext(ctx).Where("id = ?", paymentID).Take(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Devoluciones pendientes sin id del proveedor: la cita se cancelo pero el proveedor no llego a recibir la solicitud
+func (r *GormPaymentRepository) UnsentRefunds(ctx context.Context, before time.Time, limit int) ([]payments.Payment, error) {
+	var list []payments.Payment
+
+	if err := r.db.WithContext(ctx).
+		Where("kind = ? AND status = ? AND method = ? AND mercado_pago_id IS NULL AND created_at < ?", payments.KindRefund, "pendiente", "mercadopago", before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (r *GormPaymentRepository) RefundsByPayment(ctx context.Context, paymentID uint) ([]payments.Payment, error) {
+	var refunds []payments.Payment
+
+	if err := r.db.WithContext(ctx).
+		Where("refund_of = ? AND kind = ?", paymentID, payments.KindRefund).
+		Order("id ASC").
+		Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// Confirma en orden las devoluciones pendientes mientras el total confirmado no supere lo que el
+// proveedor informa como devuelto. Un pago del proveedor puede cubrir varios cobros (una serie
+// prepaga), por eso se confirman las devoluciones de todos sus cobros juntas. Si se devolvio
+// todo un cobro, el cobro pasa a reembolsado
+func (r *GormPaymentRepository) ConfirmRefunds(ctx context.Context, providerPaymentID string, refundedAmount float64) (int, error) {
+
+	confirmed := 0
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		// 1. Bloquear los cobros para que notificaciones concurrentes no confirmen dos veces
+		var charges []payments.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("mercado_pago_id = ? AND kind = ?", providerPaymentID, payments.KindCharge).
+			Order("id ASC").
+			Find(&charges).Error; err != nil {
+			return err
+		}
+
+		if len(charges) == 0 {
+			return errors.New("no existe un cobro para el pago informado")
+		}
+
+		ids := make([]uint, 0, len(charges))
+		for _, charge := range charges {
+			ids = append(ids, charge.ID)
+		}
+
+		var refunds []payments.Payment
+		if err := tx.Where("refund_of IN ? AND kind = ?", ids, payments.KindRefund).
+			Order("id ASC").
+			Find(&refunds).Error; err != nil {
+			return err
+		}
+
+		// 2. Lo ya confirmado cuenta contra el total devuelto por el proveedor
+		var (
+			total    float64
+			byCharge = make(map[uint]float64, len(charges))
+		)
+		for _, refund := range refunds {
+			if refund.Status == "reembolsado" {
+				total += refund.Amount
+				byCharge[*refund.RefundOf] += refund.Amount
+			}
+		}
+
+		now := time.Now()
+		for _, refund := range refunds {
+			if refund.Status != "pendiente" || total+refund.Amount > refundedAmount+0.005 {
+				continue
+			}
+
+			if err := tx.Model(&payments.Payment{}).
+				Where("id = ?", refund.ID).
+				Updates(map[string]any{"status": "reembolsado", "paid_at": now}).Error; err != nil {
+				return err
+			}
+
+			total += refund.Amount
+			byCharge[*refund.RefundOf] += refund.Amount
+			confirmed++
+		}
+
+		// 3. Devolucion total de cada cobro
+		for _, charge := range charges {
+			if byCharge[charge.ID] > 0 && byCharge[charge.ID] >= charge.Amount-0.005 && charge.Status != "reembolsado" {
+				if err := tx.Model(&payments.Payment{}).
+					Where("id = ?", charge.ID).
+					Update("status", "reembolsado").Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return confirmed, nil
+}
+
+func (r *GormPaymentRepository) Ledger(ctx context.Context, bookingID uint) (*payments.Ledger, error) {
+	return ledger(r.db.WithContext(ctx), bookingID)
+}
+
+// Registra el cobro dentro de una transaccion que bloquea la reserva, asi dos cobros
+// simultaneos no pueden superar el saldo
+func (r *GormPaymentRepository) RecordCharge(ctx context.Context, p *payments.Payment) (*payments.Ledger, error) {
+
+	if p == nil {
+		return nil, errors.New("payment es nil")
+	}
+
+	var result *payments.Ledger
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		// 1. Bloquear la reserva
+		var locked uint
+		if err := tx.Table("bookings").
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", p.BookingID).
+			Scan(&locked).Error; err != nil {
+			return err
+		}
+
+		// 2. Validar contra el saldo
+		current, err := ledger(tx, p.BookingID)
+		if err != nil {
+			return err
+		}
+
+		if current.BalanceDue <= 0.005 {
+			return payments.ErrNothingDue
+		}
+
+		if p.Amount > current.BalanceDue+0.005 {
+			return payments.ErrExceedsBalance
+		}
+
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+
+		result, err = ledger(tx, p.BookingID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Arma el registro de pagos de la reserva y calcula su saldo
+func ledger(db *gorm.DB, bookingID uint) (*payments.Ledger, error) {
+
+	var total float64
+	if err := db.Table("bookings").
+		Select("total_amount").
+		Where("id = ?", bookingID).
+		Scan(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var list []payments.Payment
+	if err := db.Where("booking_id = ?", bookingID).
+		Order("id ASC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	result := &payments.Ledger{
+		BookingID: bookingID,
+		Total:     total,
+		Payments:  list,
+	}
+
+	for _, p := range list {
+		switch {
+		case p.Kind == payments.KindRefund && p.Status == "reembolsado":
+			result.Refunded += p.Amount
+		case p.Kind == payments.KindCharge && (p.Status == "aprobado" || p.Status == "reembolsado"):
+			result.Paid += p.Amount
+			if p.Concept == payments.ConceptSurcharge {
+				result.Total += p.Amount
+			}
+		}
+	}
+
+	result.Paid -= result.Refunded
+	result.BalanceDue = max(math.Round((result.Total-result.Paid)*100)/100, 0)
+
+	return result, nil
+}
+
+// Saldo pendiente de la reserva
+func balanceDue(db *gorm.DB, bookingID uint) (float64, error) {
+	l, err := ledger(db, bookingID)
+	if err != nil {
+		return 0, err
+	}
+	return l.BalanceDue, nil
+}
+
+func (r *GormPaymentRepository) Approve(ctx context.Context, paymentID uint, method string, paidAt time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&payments.Payment{}).
+		Where("id = ?", paymentID).
+		Updates(map[string]any{
+			"status":  "aprobado",
+			"method":  method,
+			"paid_at": paidAt,
+		}).Error
+}
+
+func (r *GormPaymentRepository) AttachReceipt(ctx context.Context, paymentID uint, url string) error {
+	return r.db.WithContext(ctx).
+		Model(&payments.Payment{}).
+		Where("id = ?", paymentID).
+		Updates(map[string]any{
+			"receipt_url":         url,
+			"receipt_uploaded_at": time.Now(),
+			"review_note":         "",
+		}).Error
+}
+
+// Descarta el comprobante para que el cliente suba uno nuevo, la nota explica el motivo
+func (r *GormPaymentRepository) RejectReceipt(ctx context.Context, paymentID uint, note string) error {
+	return r.db.WithContext(ctx).
+		Model(&payments.Payment{}).
+		Where("id = ?", paymentID).
+		Updates(map[string]any{
+			"receipt_url":         nil,
+			"receipt_uploaded_at": nil,
+			"review_note":         note,
+		}).Error
+}
+
+// Transferencias pendientes con comprobante, las mas antiguas primero
+func (r *GormPaymentRepository) PendingReceipts(ctx context.Context) ([]payments.Payment, error) {
+	var list []payments.Payment
+
+	if err := r.db.WithContext(ctx).
+		Where("kind = ? AND status = ? AND receipt_url IS NOT NULL", payments.KindCharge, "pendiente").
+		Order("receipt_uploaded_at ASC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (r *GormPaymentRepository) PendingWithProvider(ctx context.Context, since time.Time, afterID uint, limit int) ([]payments.Payment, error) {
+	var list []payments.Payment
+
+	if err := r.db.WithContext(ctx).
+		Where("kind = ? AND status = ? AND method = ? AND created_at >= ?", payments.KindCharge, "pendiente", "mercadopago", since).
+		Where("preference_id IS NOT NULL OR mercado_pago_id IS NOT NULL").
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
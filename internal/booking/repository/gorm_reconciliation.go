@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormReconciliationRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormReconciliationRepo(db *gorm.DB, redis *redis.Client) payments.ReconciliationRepository {
+	return &GormReconciliationRepository{db, redis}
+}
+
+// La misma discrepancia (pago, pago del proveedor y tipo) se registra una unica vez,
+// asi las que quedan en revision no se duplican en cada corrida
+func (r *GormReconciliationRepository) Create(ctx context.Context, discrepancy *payments.Discrepancy) (bool, error) {
+
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(discrepancy)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (r *GormReconciliationRepository) List(ctx context.Context, status string, limit int) ([]payments.Discrepancy, error) {
+	var list []payments.Discrepancy
+
+	query := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type GormSeriesRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormSeriesRepo(db *gorm.DB, redis *redis.Client) booking.SeriesRepository {
+	return &GormSeriesRepository{db: db, redis: redis}
+}
+
+func (r *GormSeriesRepository) Create(ctx context.Context, series *booking.BookingSeries) error {
+	return r.db.WithContext(ctx).Omit("Bookings").Create(series).Error
+}
+
+// Serie con sus reservas en el orden en que se crearon, que es el de sus turnos
+func (r *GormSeriesRepository) GetByID(ctx context.Context, seriesID uint) (*booking.BookingSeries, error) {
+	var series booking.BookingSeries
+
+	if err := r.db.WithContext(ctx).
+		Preload("Bookings", func(db *gorm.DB) *gorm.DB {
+			return db.Order("bookings.id ASC")
+		}).
+		Preload("Bookings.Slot").
+		Preload("Bookings.BookingServices.Service").
+		Where("id = ?", seriesID).
+		First(&series).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, booking.ErrSeriesNotFound
+		}
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+// Series del cliente, las mas recientes primero
+func (r *GormSeriesRepository) ListByClient(ctx context.Context, clientID uint) ([]booking.BookingSeries, error) {
+	var list []booking.BookingSeries
+
+	if err := r.db.WithContext(ctx).
+		Preload("Bookings", func(db *gorm.DB) *gorm.DB {
+			return db.Order("bookings.id ASC")
+		}).
+		Preload("Bookings.Slot").
+		Where("client_id = ?", clientID).
+		Order("created_at DESC, id DESC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (r *GormSeriesRepository) UpdateStatus(ctx context.Context, seriesID uint, status string) error {
+	res := r.db.WithContext(ctx).
+		Model(&booking.BookingSeries{}).
+		Where("id = ?", seriesID).
+		Update("status", status)
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return booking.ErrSeriesNotFound
+	}
+
+	return nil
+}
+
+func (r *GormSeriesRepository) SetCheckout(ctx context.Context, seriesID uint, checkout *payments.Checkout) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Model(&booking.BookingSeries{}).
+			Where("id = ?", seriesID).
+			Update("payment_url", checkout.InitPoint).Error; err != nil {
+			return err
+		}
+
+		return setCoveredCheckout(tx, "series_id", seriesID, checkout)
+	})
+}
+
+func (r *GormSeriesRepository) Delete(ctx context.Context, seriesID uint) error {
+	return r.db.WithContext(ctx).Delete(&booking.BookingSeries{}, seriesID).Error
+}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/waitlist"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Un turno esta libre si no fue eliminado, no tiene reservas activas (como turno inicial o
+// consecutivo), no cae en una ausencia o cierre y no esta retenido por una oferta vigente
+var freeSlotSQL = `slots.deleted_at IS NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM bookings b
+		WHERE b.slot_id = slots.id
+		AND b.status IN (` + sqlList(booking.ActiveStatuses) + `)
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM booking_slots bs
+		JOIN bookings b ON b.id = bs.booking_id
+		WHERE bs.slot_id = slots.id
+		AND b.status IN (` + sqlList(booking.ActiveStatuses) + `)
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM time_offs t
+		WHERE (t.barber_id = slots.barber_id OR t.barber_id IS NULL)
+		AND t.start < slots.end AND t.end > slots.start
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM waitlist_offers wo
+		WHERE wo.slot_id = slots.id
+		AND wo.status = 'ofrecido' AND wo.expires_at > NOW()
+	)`
+
+// Lista SQL de valores fijos, para las condiciones que se arman como texto
+func sqlList(values []string) string {
+	return "'" + strings.Join(values, "', '") + "'"
+}
+
+type GormWaitlistRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormWaitlistRepo(db *gorm.DB, redis *redis.Client) waitlist.WaitlistRepository {
+	return &GormWaitlistRepository{db: db, redis: redis}
+}
+
+func (r *GormWaitlistRepository) Create(ctx context.Context, entry *waitlist.WaitlistEntry) error {
+	if entry == nil {
+		return errors.New("entry es nil")
+	}
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *GormWaitlistRepository) GetByID(ctx context.Context, id uint) (*waitlist.WaitlistEntry, error) {
+	var entry waitlist.WaitlistEntry
+
+	if err := r.db.WithContext(ctx).
+		Preload("Services").
+		Preload("Offers").
+		Where("id = ?", id).
+		Take(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, waitlist.ErrEntryNotFound
+		}
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Anotaciones del cliente con sus ofertas (la mas reciente primero)
+func (r *GormWaitlistRepository) ListByClient(ctx context.Context, clientID uint) ([]waitlist.WaitlistEntry, error) {
+	var entries []waitlist.WaitlistEntry
+
+	if err := r.db.WithContext(ctx).
+		Preload("Services").
+		Preload("Offers", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC")
+		}).
+		Preload("Offers.Slot").
+		Where("client_id = ?", clientID).
+		Order("created_at DESC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Cancela la anotacion y libera la oferta vigente si la hubiera
+func (r *GormWaitlistRepository) Cancel(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := tx.Model(&waitlist.WaitlistOffer{}).
+			Where("waitlist_entry_id = ? AND status = ?", id, "ofrecido").
+			Update("status", "rechazado").Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&waitlist.WaitlistEntry{}).
+			Where("id = ?", id).
+			Update("status", "cancelado").Error
+	})
+}
+
+// Anotaciones en espera vigentes, en orden de llegada
+func (r *GormWaitlistRepository) Waiting(ctx context.Context) ([]waitlist.WaitlistEntry, error) {
+	var entries []waitlist.WaitlistEntry
+
+	if err := r.db.WithContext(ctx).
+		Preload("Offers").
+		Where("status = ? AND date_to > ?", "esperando", time.Now()).
+		Order("created_at ASC, id ASC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Anotaciones en espera que aceptan el turno y aun no lo rechazaron, en orden de llegada
+func (r *GormWaitlistRepository) Candidates(ctx context.Context, slot *waitlist.Slot) ([]waitlist.WaitlistEntry, error) {
+	var entries []waitlist.WaitlistEntry
+
+	if err := r.db.WithContext(ctx).
+		Where("status = ?", "esperando").
+		Where("(barber_id IS NULL OR barber_id = ?)", slot.BarberID).
+		Where("date_from <= ? AND date_to > ?", slot.Start, slot.Start).
+		Where("NOT EXISTS (SELECT 1 FROM waitlist_offers wo WHERE wo.waitlist_entry_id = waitlist_entries.id AND wo.slot_id = ?)", slot.ID).
+		Order("created_at ASC, id ASC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Duracion en minutos de los servicios de la anotacion
+func (r *GormWaitlistRepository) ServicesDuration(ctx context.Context, entryID uint) (int, error) {
+	var duration int
+
+	if err := r.db.WithContext(ctx).
+		Table("waitlist_services ws").
+		Select("COALESCE(SUM(s.duration_minutes), 0)").
+		Joins("JOIN services s ON s.id = ws.service_id").
+		Where("ws.waitlist_entry_id = ?", entryID).
+		Scan(&duration).Error; err != nil {
+		return 0, err
+	}
+
+	return duration, nil
+}
+
+func (r *GormWaitlistRepository) GetSlot(ctx context.Context, slotID uint) (*waitlist.Slot, error) {
+	var slot waitlist.Slot
+
+	if err := r.db.WithContext(ctx).
+		Table("slots").
+		Where("id = ? AND deleted_at IS NULL", slotID).
+		Take(&slot).Error; err != nil {
+		return nil, err
+	}
+
+	return &slot, nil
+}
+
+// Turnos libres a futuro dentro del rango, de un barbero o de todos si barberID es nil
+func (r *GormWaitlistRepository) FreeSlots(ctx context.Context, barberID *uint, start, end time.Time) ([]waitlist.Slot, error) {
+	var slots []waitlist.Slot
+
+	query := r.db.WithContext(ctx).
+		Table("slots").
+		Select("slots.id, slots.barber_id, slots.start, slots.end").
+		Where("slots.start >= ? AND slots.start < ? AND slots.start > ?", start, end, time.Now()).
+		Where(freeSlotSQL)
+
+	if barberID != nil {
+		query = query.Where("slots.barber_id = ?", *barberID)
+	}
+
+	if err := query.Order("slots.start ASC, slots.barber_id ASC").Scan(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// Registra la oferta y marca la anotacion como ofrecida. El turno se bloquea como en el checkout
+// y se vuelve a verificar libre dentro de la transaccion, una reserva pudo tomarlo mientras se buscaba
+// el candidato
+func (r *GormWaitlistRepository) CreateOffer(ctx context.Context, offer *waitlist.WaitlistOffer) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		// 1. Bloquear el turno hasta el fin de la transaccion, antes de cualquier lectura para que la
+		// verificacion vea las reservas que se confirmaron mientras se esperaba el bloqueo
+		var slotID uint
+		if err := tx.Table("slots").
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", offer.SlotID).
+			Pluck("id", &slotID).Error; err != nil {
+			return err
+		}
+
+		var free int64
+		if err := tx.Table("slots").
+			Where("slots.id = ?", offer.SlotID).
+			Where(freeSlotSQL).
+			Count(&free).Error; err != nil {
+			return err
+		}
+
+		if free == 0 {
+			return waitlist.ErrSlotTaken
+		}
+
+		// 2. Marcar la anotacion y registrar la oferta
+		res := tx.Model(&waitlist.WaitlistEntry{}).
+			Where("id = ? AND status = ?", offer.WaitlistEntryID, "esperando").
+			Update("status", "ofrecido")
+		if res.Error != nil {
+			return res.Error
+		}
+
+		// Otra oferta se adelanto para la misma anotacion
+		if res.RowsAffected == 0 {
+			return waitlist.ErrEntryNotFound
+		}
+
+		return tx.Omit("Slot").Create(offer).Error
+	})
+}
+
+func (r *GormWaitlistRepository) GetOffer(ctx context.Context, offerID uint) (*waitlist.WaitlistOffer, error) {
+	var offer waitlist.WaitlistOffer
+
+	if err := r.db.WithContext(ctx).
+		Preload("Slot").
+		Where("id = ?", offerID).
+		Take(&offer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, waitlist.ErrOfferNotFound
+		}
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+// Cierra una oferta vigente (vencido o rechazado) y devuelve la anotacion a la espera
+func (r *GormWaitlistRepository) CloseOffer(ctx context.Context, offerID uint, status string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var offer waitlist.WaitlistOffer
+		if err := tx.Where("id = ? AND status = ?", offerID, "ofrecido").Take(&offer).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return waitlist.ErrOfferNotFound
+			}
+			return err
+		}
+
+		if err := tx.Model(&offer).Update("status", status).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&waitlist.WaitlistEntry{}).
+			Where("id = ? AND status = ?", offer.WaitlistEntryID, "ofrecido").
+			Update("status", "esperando").Error
+	})
+}
+
+func (r *GormWaitlistRepository) ExpiredOffers(ctx context.Context, now time.Time) ([]waitlist.WaitlistOffer, error) {
+	var offers []waitlist.WaitlistOffer
+
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", "ofrecido", now).
+		Order("expires_at ASC").
+		Find(&offers).Error; err != nil {
+		return nil, err
+	}
+
+	return offers, nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormWebhookRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormWebhookRepo(db *gorm.DB, redis *redis.Client) payments.WebhookRepository {
+	return &GormWebhookRepository{db, redis}
+}
+
+func (r *GormWebhookRepository) Create(ctx context.Context, event *payments.WebhookEvent) (bool, error) {
+
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(event)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (r *GormWebhookRepository) MarkProcessed(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).
+		Model(&payments.WebhookEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"status":          "procesado",
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      "",
+			"next_attempt_at": nil,
+		}).Error
+}
+
+func (r *GormWebhookRepository) MarkFailed(ctx context.Context, id uint, reason string, next *time.Time) error {
+
+	status := "pendiente"
+	if next == nil {
+		status = "fallido"
+	}
+
+	return r.db.WithContext(ctx).
+		Model(&payments.WebhookEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"status":          status,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      reason,
+			"next_attempt_at": next,
+		}).Error
+}
+
+func (r *GormWebhookRepository) Due(ctx context.Context, now time.Time, limit int) ([]payments.WebhookEvent, error) {
+	var events []payments.WebhookEvent
+
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at IS NOT NULL AND next_attempt_at <= ?", "pendiente", now).
+		Order("next_attempt_at ASC").
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
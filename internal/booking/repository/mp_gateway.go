@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/mercadopago/sdk-go/pkg/config"
+	"github.com/mercadopago/sdk-go/pkg/payment"
+	"github.com/mercadopago/sdk-go/pkg/preference"
+	"github.com/mercadopago/sdk-go/pkg/refund"
+)
+
+type MercadoPagoGateway struct {
+	preferenceClient preference.Client
+	paymentClient    payment.Client
+	refundClient     refund.Client
+}
+
+func NewMercadoPagoGateway(accessToken string) (payments.Gateway, error) {
+
+	if accessToken == "" {
+		return nil, errors.New("falta mp access token")
+	}
+
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, errors.New("error al configurar Mercado Pago")
+	}
+
+	return &MercadoPagoGateway{
+		preferenceClient: preference.NewClient(cfg),
+		paymentClient:    payment.NewClient(cfg),
+		refundClient:     refund.NewClient(cfg),
+	}, nil
+}
+
+func (g *MercadoPagoGateway) CreateCheckout(ctx context.Context, req payments.CheckoutRequest) (*payments.Checkout, error) {
+
+	quantity := req.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	mpRequest := preference.Request{
+		Items: []preference.ItemRequest{
+			{
+				Title:     req.Title,
+				UnitPrice: req.Amount,
+				Quantity:  quantity,
+			},
+		},
+		Payer: &preference.PayerRequest{
+			Name:    req.PayerName,
+			Surname: req.PayerSurname,
+		},
+		NotificationURL:   req.NotificationURL,
+		ExternalReference: req.ExternalReference,
+		Metadata:          req.Metadata,
+		BackURLs: &preference.BackURLsRequest{
+			Success: req.BackURL,
+		},
+		Expires:          req.ExpiresAt != nil,
+		ExpirationDateTo: req.ExpiresAt,
+	}
+
+	res, err := g.preferenceClient.Create(ctx, mpRequest)
+	if err != nil {
+		log.Println("[MP GATEWAY]", err.Error())
+		return nil, errors.New("error al crear preferencia en Mercado Pago")
+	}
+
+	return &payments.Checkout{
+		ID:        res.ID,
+		InitPoint: res.InitPoint,
+	}, nil
+}
+
+func (g *MercadoPagoGateway) GetPayment(ctx context.Context, paymentID string) (*payments.ProviderPayment, error) {
+
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return nil, errors.New("id de pago invalido")
+	}
+
+	res, err := g.paymentClient.Get(ctx, id)
+	if err != nil {
+		log.Println("[MP GATEWAY]", err.Error())
+		return nil, errors.New("pago no encontrado")
+	}
+
+	return providerPayment(res), nil
+}
+
+func (g *MercadoPagoGateway) SearchPayments(ctx context.Context, externalReference string) ([]payments.ProviderPayment, error) {
+
+	if externalReference == "" {
+		return nil, errors.New("falta la referencia externa")
+	}
+
+	res, err := g.paymentClient.Search(ctx, payment.SearchRequest{
+		Filters: map[string]string{"external_reference": externalReference},
+	})
+	if err != nil {
+		log.Println("[MP GATEWAY]", err.Error())
+		return nil, errors.New("no fue posible buscar los pagos en Mercado Pago")
+	}
+
+	list := make([]payments.ProviderPayment, 0, len(res.Results))
+	for i := range res.Results {
+		list = append(list, *providerPayment(&res.Results[i]))
+	}
+
+	return list, nil
+}
+
+func providerPayment(res *payment.Response) *payments.ProviderPayment {
+
+	info := &payments.ProviderPayment{
+		ID:             strconv.Itoa(res.ID),
+		Status:         mpStatus(res.Status),
+		Amount:         res.TransactionAmount,
+		RefundedAmount: res.TransactionAmountRefunded,
+		Metadata:       res.Metadata,
+	}
+
+	for _, r := range res.Refunds {
+		info.Refunds = append(info.Refunds, payments.ProviderRefund{
+			ID:        strconv.Itoa(r.ID),
+			PaymentID: info.ID,
+			Amount:    r.Amount,
+			Status:    mpStatus(r.Status),
+		})
+	}
+
+	if !res.DateApproved.IsZero() {
+		paidAt := res.DateApproved
+		info.PaidAt = &paidAt
+	}
+
+	return info
+}
+
+func (g *MercadoPagoGateway) Refund(ctx context.Context, paymentID string, amount float64) (*payments.ProviderRefund, error) {
+
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return nil, errors.New("id de pago invalido")
+	}
+
+	var res *refund.Response
+	if amount > 0 {
+		res, err = g.refundClient.CreatePartialRefund(ctx, id, amount)
+	} else {
+		res, err = g.refundClient.Create(ctx, id)
+	}
+	if err != nil {
+		log.Println("[MP GATEWAY]", err.Error())
+		return nil, errors.New("no fue posible realizar la devolucion en Mercado Pago")
+	}
+
+	return &payments.ProviderRefund{
+		ID:        strconv.Itoa(res.ID),
+		PaymentID: paymentID,
+		Amount:    res.Amount,
+		Status:    mpStatus(res.Status),
+	}, nil
+}
+
+// Traduce los estados de Mercado Pago a los estados locales de Payment
+func mpStatus(status string) string {
+	switch status {
+	case "approved":
+		return "aprobado"
+	case "rejected", "cancelled":
+		return "rechazado"
+	case "refunded", "charged_back":
+		return "reembolsado"
+	default:
+		return "pendiente"
+	}
+}
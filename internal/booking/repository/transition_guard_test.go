@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Todo cambio de estado de una reserva pasa por transition(), que valida la maquina de estados y
+// registra el evento. Recorre el codigo de internal/ y falla si encuentra otra escritura de
+// bookings.status, en cualquier modulo
+func TestBookingStatusOnlyChangesInTransition(t *testing.T) {
+
+	root := filepath.Join("..", "..")
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+
+			if fn.Name.Name == "transition" && filepath.Base(path) == "gorm_booking_event.go" {
+				continue
+			}
+
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if ok && writesBookingStatus(call) {
+					t.Errorf("%s: %s cambia bookings.status sin pasar por transition()", fset.Position(call.Pos()), fn.Name.Name)
+				}
+				return true
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteDetection(t *testing.T) {
+
+	cases := map[string]bool{
+		`tx.Table("bookings").Where("id = ?", id).Update("status", "cancelado")`:                true,
+		`tx.Model(&booking.Booking{}).Where("id = ?", id).Updates(map[string]any{"status": s})`: true,
+		`tx.Model(&Booking{}).Updates(&Booking{Status: "pagado"})`:                              true,
+		`tx.Exec("UPDATE bookings SET status = ? WHERE id = ?", s, id)`:                         true,
+		`tx.Model(&booking.BookingSeries{}).Where("id = ?", id).Update("status", s)`:            false,
+		`tx.Table("bookings").Where("id = ?", id).Update("flagged_at", now)`:                    false,
+		`tx.Table("payments").Where("id = ?", id).Update("status", "aprobado")`:                 false,
+	}
+
+	for src, want := range cases {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+
+		if got := writesBookingStatus(expr.(*ast.CallExpr)); got != want {
+			t.Errorf("%s: se esperaba %v, se obtuvo %v", src, want, got)
+		}
+	}
+}
+
+// Indica si la llamada escribe la columna status de la tabla bookings
+func writesBookingStatus(call *ast.CallExpr) bool {
+
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) == 0 {
+		return false
+	}
+
+	switch sel.Sel.Name {
+	case "Update", "UpdateColumn":
+		return stringLit(call.Args[0]) == "status" && onBookings(sel.X)
+	case "Updates", "UpdateColumns":
+		return setsStatus(call.Args[0]) && onBookings(sel.X)
+	case "Exec", "Raw":
+		sql := strings.ToLower(stringLit(call.Args[0]))
+		return strings.Contains(sql, "update bookings") && strings.Contains(sql, "status")
+	}
+
+	return false
+}
+
+// Recorre la cadena de llamadas de gorm buscando Table("bookings") o Model(&Booking{})
+func onBookings(expr ast.Expr) bool {
+
+	for {
+		call, ok := expr.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+
+		if len(call.Args) > 0 {
+			switch sel.Sel.Name {
+			case "Table":
+				if table := strings.Fields(stringLit(call.Args[0])); len(table) > 0 && table[0] == "bookings" {
+					return true
+				}
+			case "Model":
+				if isBookingLit(call.Args[0]) {
+					return true
+				}
+			}
+		}
+
+		expr = sel.X
+	}
+}
+
+// Mapa o struct de actualizacion con la clave status
+func setsStatus(arg ast.Expr) bool {
+
+	if unary, ok := arg.(*ast.UnaryExpr); ok {
+		arg = unary.X
+	}
+
+	lit, ok := arg.(*ast.CompositeLit)
+	if !ok {
+		return false
+	}
+
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if ident, ok := kv.Key.(*ast.Ident); ok && ident.Name == "Status" {
+			return true
+		}
+		if stringLit(kv.Key) == "status" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// &booking.Booking{} o &Booking{}
+func isBookingLit(arg ast.Expr) bool {
+
+	unary, ok := arg.(*ast.UnaryExpr)
+	if !ok {
+		return false
+	}
+
+	lit, ok := unary.X.(*ast.CompositeLit)
+	if !ok {
+		return false
+	}
+
+	switch typ := lit.Type.(type) {
+	case *ast.Ident:
+		return typ.Name == "Booking"
+	case *ast.SelectorExpr:
+		return typ.Sel.Name == "Booking"
+	}
+
+	return false
+}
+
+func stringLit(expr ast.Expr) string {
+
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+
+	return value
+}
@@ -0,0 +1,101 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/waitlist"
+	"gorm.io/gorm"
+)
+
+// Anotacion en espera del cliente para cualquier barbero
+func createTestEntry(t *testing.T, db *gorm.DB, clientID uint, slot booking.Slot) uint {
+	t.Helper()
+
+	entry := waitlist.WaitlistEntry{ClientID: clientID, DateFrom: slot.Start.Add(-time.Hour), DateTo: slot.End.Add(time.Hour), Status: "esperando"}
+	if err := db.Omit("Services", "Offers").Create(&entry).Error; err != nil {
+		t.Fatalf("no fue posible crear la anotacion de prueba: %v", err)
+	}
+
+	t.Cleanup(func() { db.Exec("DELETE FROM waitlist_entries WHERE id = ?", entry.ID) })
+
+	return entry.ID
+}
+
+// Una reserva tomo el turno despues de buscar los libres: la oferta se rechaza y la anotacion sigue esperando
+func TestWaitlistOfferRejectsTakenSlot(t *testing.T) {
+
+	db := openTestDB(t)
+	barberID := createTestUser(t, db, "barber", true)
+	slot := createTestSlots(t, db, barberID, 1)[0]
+
+	if err := NewGormCheckoutRepo(db, nil).Create(context.Background(), &booking.Checkout{
+		Booking:  &booking.Booking{SlotID: slot.ID, ClientID: createTestUser(t, db, "client", false), Status: "pendiente_pago", TotalAmount: 1000},
+		Duration: 30,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	entryID := createTestEntry(t, db, createTestUser(t, db, "waiting", false), slot)
+
+	offer := &waitlist.WaitlistOffer{WaitlistEntryID: entryID, SlotID: slot.ID, Status: "ofrecido", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := NewGormWaitlistRepo(db, nil).CreateOffer(context.Background(), offer); !errors.Is(err, waitlist.ErrSlotTaken) {
+		t.Fatalf("se esperaba ErrSlotTaken, se obtuvo %v", err)
+	}
+
+	var status string
+	db.Raw("SELECT status FROM waitlist_entries WHERE id = ?", entryID).Scan(&status)
+	if status != "esperando" {
+		t.Fatalf("la anotacion deberia seguir esperando, esta %s", status)
+	}
+}
+
+// La oferta y un checkout compiten por el mismo turno, solo uno de los dos lo toma
+func TestWaitlistOfferConcurrentCheckout(t *testing.T) {
+
+	db := openTestDB(t)
+	barberID := createTestUser(t, db, "barber", true)
+	slot := createTestSlots(t, db, barberID, 1)[0]
+	clientID := createTestUser(t, db, "client", false)
+	entryID := createTestEntry(t, db, createTestUser(t, db, "waiting", false), slot)
+
+	var (
+		wg          sync.WaitGroup
+		start       = make(chan struct{})
+		checkoutErr error
+		offerErr    error
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		<-start
+		checkoutErr = NewGormCheckoutRepo(db, nil).Create(context.Background(), &booking.Checkout{
+			Booking:  &booking.Booking{SlotID: slot.ID, ClientID: clientID, Status: "pendiente_pago", TotalAmount: 1000},
+			Duration: 30,
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		<-start
+		offerErr = NewGormWaitlistRepo(db, nil).CreateOffer(context.Background(),
+			&waitlist.WaitlistOffer{WaitlistEntryID: entryID, SlotID: slot.ID, Status: "ofrecido", ExpiresAt: time.Now().Add(time.Hour)})
+	}()
+
+	close(start)
+	wg.Wait()
+
+	if (checkoutErr == nil) == (offerErr == nil) {
+		t.Fatalf("se esperaba un unico ganador, checkout: %v, oferta: %v", checkoutErr, offerErr)
+	}
+
+	if offerErr != nil && !errors.Is(offerErr, waitlist.ErrSlotTaken) {
+		t.Fatalf("la oferta deberia perder con ErrSlotTaken, se obtuvo %v", offerErr)
+	}
+}
@@ -5,33 +5,57 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/domain/booking"
 	"github.com/ezep02/rodeo/internal/booking/domain/coupon"
+	"github.com/ezep02/rodeo/internal/booking/domain/notification"
 	"github.com/ezep02/rodeo/internal/booking/domain/payments"
 	"github.com/ezep02/rodeo/internal/booking/helpers"
-	"github.com/mercadopago/sdk-go/pkg/config"
-	"github.com/mercadopago/sdk-go/pkg/preference"
+	policyDomain "github.com/ezep02/rodeo/internal/policy/domain"
+	policy "github.com/ezep02/rodeo/internal/policy/usecase"
+	pricing "github.com/ezep02/rodeo/internal/pricing/usecase"
 )
 
+const (
+	// Anticipacion con la que se puede registrar la llegada del cliente
+	checkInWindow = 30 * time.Minute
+
+	// Tiempo desde el fin del turno hasta marcar la reserva como sin cerrar
+	unclosedGrace = time.Hour
+
+	// Formato de fecha y hora en los avisos al cliente
+	noticeTimeFormat = "02/01/2006 15:04"
+)
+
+// Los barberos no usan las acciones del cliente, que aplican sus penalidades
+var errShopChange = fmt.Errorf("%w: los cambios de la barberia se realizan desde la agenda, sin penalidad para el cliente", booking.ErrTransitionForbidden)
+
 type BookingService struct {
 	bookingRepo booking.BookingRepository
 	paymentRepo payments.PaymentRepository
 	couponRepo  coupon.CouponRepository
+	reconRepo   payments.ReconciliationRepository
+	gateway     payments.Gateway
+	pricingSvc  *pricing.PricingService
+	waitlistSvc *WaitlistService
+	policySvc   *policy.PolicyService
+	notifySvc   *NotificationService
 }
 
-func NewBookingService(bookingRepo booking.BookingRepository, paymentRepo payments.PaymentRepository, couponRepo coupon.CouponRepository) *BookingService {
-	return &BookingService{bookingRepo, paymentRepo, couponRepo}
+func NewBookingService(bookingRepo booking.BookingRepository, paymentRepo payments.PaymentRepository, couponRepo coupon.CouponRepository, reconRepo payments.ReconciliationRepository, gateway payments.Gateway, pricingSvc *pricing.PricingService, waitlistSvc *WaitlistService, policySvc *policy.PolicyService, notifySvc *NotificationService) *BookingService {
+	return &BookingService{bookingRepo, paymentRepo, couponRepo, reconRepo, gateway, pricingSvc, waitlistSvc, policySvc, notifySvc}
 }
 
-func (s *BookingService) CreateBooking(ctx context.Context, b *booking.Booking) error {
+func (s *BookingService) CreateBooking(ctx context.Context, b *booking.Booking, actor booking.Actor) error {
 	if b == nil {
 		return errors.New("booking es nil")
 	}
-	return s.bookingRepo.Create(ctx, b)
+	return s.bookingRepo.Create(ctx, b, actor)
 }
 
 func (s *BookingService) CalculateCancelationConsequences(ctx context.Context, bookingID uint) (*booking.CancelationResponse, error) {
@@ -42,7 +66,7 @@ func (s *BookingService) CalculateCancelationConsequences(ctx context.Context, b
 
 	// 1. Recuperar el booking
 	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
-	if err != nil {
+	if err != nil || existing == nil {
 		return nil, errors.New("no fue posible recuperar la cita")
 	}
 
@@ -52,42 +76,61 @@ func (s *BookingService) CalculateCancelationConsequences(ctx context.Context, b
 		return nil, errors.New("la cita ya ocurrió")
 	}
 
-	// 3. Recupear el payment
+	// 3. Recupear el payment, las reservas sin un cobro aprobado se cancelan sin cargo
 	payment, err := s.paymentRepo.GetByBookingID(ctx, bookingID)
 	if err != nil {
 		return nil, errors.New("no fue posible recuperar los datos del pago de la cita")
 	}
 
-	// 3. ¿Esta dentro de las 24hs? → helper
-	isWithin24h := IsWithin24Hours(existing.Slot.Start)
+	if !isPaid(payment) {
+		return &booking.CancelationResponse{
+			Outcome: policyDomain.OutcomeFree,
+			Message: "La reserva no registra pagos, podés cancelarla sin cargo.",
+		}, nil
+	}
+
+	// 4. Evaluar la politica de cancelacion vigente
+	decision, err := s.evaluatePolicy(ctx, policyDomain.ActionCancel, existing, payment.Type)
+	if err != nil {
+		return nil, err
+	}
 
-	// --------------------------------------
-	// Reglas de negocio (resumidas)
-	// --------------------------------------
-	// DENTRO 24H:
-	//   pago total  → 50%
-	//   pago parcial → pierde seña
-	//
-	// FUERA 24H:
-	//   pago total → 75%
-	//   pago parcial → 25%
-	// --------------------------------------
+	consequences := helpers.CalculateConsequences(decision, isRefundable(payment))
+	if consequences.RequiresRefund {
+		consequences.RefundAmount = pricing.Percentage(payment.Amount, float64(consequences.RefundPercent))
+	}
 
-	return helpers.CalculateConsequences(isWithin24h, payment.Type), nil
+	return consequences, nil
 }
 
-func (s *BookingService) CancelBooking(ctx context.Context, bookingID uint) (*booking.CancelationResponse, error) {
+// Cancela la reserva aplicando la politica vigente. compensation permite elegir entre cupon
+// y reembolso cuando la politica lo ofrece (vacio = la compensacion por defecto de la politica)
+func (s *BookingService) CancelBooking(ctx context.Context, bookingID, userID uint, isAdmin bool, compensation string) (*booking.CancelationResponse, error) {
 
 	if bookingID == 0 {
 		return nil, errors.New("error recuperando el id de la consulta")
 	}
 
-	// 1. Recuperar el booking
+	// 1. Recuperar el booking y validar que el usuario pueda cancelarlo en su estado actual,
+	// antes de solicitar cualquier devolucion
 	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
-	if err != nil {
+	if err != nil || existing == nil {
 		return nil, errors.New("no fue posible recuperar la cita")
 	}
 
+	actor, err := actorFor(existing, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.Role == booking.ActorBarber {
+		return nil, errShopChange
+	}
+
+	if err := booking.CanTransition(existing.Status, "cancelado", actor.Role); err != nil {
+		return nil, err
+	}
+
 	// 2. Validar si ya ocurrio
 	now := time.Now().UTC()
 	if existing.Slot.Start.UTC().Before(now) {
@@ -100,67 +143,100 @@ func (s *BookingService) CancelBooking(ctx context.Context, bookingID uint) (*bo
 		return nil, errors.New("no fue posible recuperar los datos del pago de la cita")
 	}
 
-	// 3. ¿Esta dentro de las 24hs? → helper
-	isWithin24h := IsWithin24Hours(existing.Slot.Start)
+	// Un checkout de Mercado Pago sin completar tiene su pago pendiente, no se cobro nada que compensar
+	if !isPaid(payment) {
+		return s.cancelUnpaid(ctx, existing, actor)
+	}
 
-	consequences := helpers.CalculateConsequences(isWithin24h, payment.Type)
+	// 4. Evaluar la politica de cancelacion, la misma que se mostro en la vista previa
+	decision, err := s.evaluatePolicy(ctx, policyDomain.ActionCancel, existing, payment.Type)
+	if err != nil {
+		return nil, err
+	}
 
-	if consequences.RequiresCoupon {
-		go func() {
-			const maxRetries = 5
-			var couponCode string
-			var err error
-
-			for i := range maxRetries {
-				couponCode, err = helpers.GenerateCouponCode(12)
-				if err != nil {
-					log.Println("No fue posible generar el código de 12")
-					return
-				}
+	consequences := helpers.CalculateConsequences(decision, isRefundable(payment))
 
-				err = s.couponRepo.Create(context.Background(), &coupon.Coupon{
-					Code:               couponCode,
-					UserID:             existing.ClientID,
-					DiscountPercentage: float64(consequences.CouponPercent),
-					ExpireAt:           time.Now().Add(7 * 24 * time.Hour),
-					IsAvailable:        true,
-				})
-				if err == nil {
-					// Éxito, salimos del bucle
-					log.Printf("Cupón creado: %s", couponCode)
-					return
-				}
+	// 5. Compensacion elegida por el cliente
+	if err := helpers.ChooseCompensation(consequences, compensation); err != nil {
+		return nil, err
+	}
 
-				// Si el error es por duplicado, seguimos intentando
-				if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE") {
-					log.Printf("Código repetido, intentando de nuevo (%d/%d)", i+1, maxRetries)
-					continue
-				}
+	// 6. Cancelar y registrar la devolucion pendiente en una misma transaccion
+	var refund *payments.Payment
+	if consequences.RequiresRefund {
+		refund, err = pendingRefund(payment, pricing.Percentage(payment.Amount, float64(consequences.RefundPercent)))
+		if err != nil {
+			return nil, err
+		}
+	}
 
-				// Otro tipo de error
-				log.Printf("Error al crear cupón: %s", err)
-				return
-			}
+	if err := s.bookingRepo.CancelWithRefund(ctx, bookingID, actor, decision.Message, refund); err != nil {
+		if booking.IsTransitionError(err) {
+			return nil, err
+		}
+		return nil, errors.New("error cancelando la cita")
+	}
+
+	// Los turnos liberados se ofrecen a la lista de espera
+	s.offerSlots(s.bookingSlots(ctx, existing))
+
+	message := "cita cancelada con exito"
 
-			log.Println("No se pudo generar un código único después de varios intentos")
-		}()
+	// 7. Solicitar la devolucion, si el proveedor no la acepta queda pendiente y se reintenta
+	if refund != nil {
+		message = fmt.Sprintf("cita cancelada con exito, se solicito la devolucion de $%.2f", refund.Amount)
+		if err := s.sendRefund(ctx, refund, payment); err != nil {
+			log.Printf("[REFUND] la devolucion %d de la cita %d queda pendiente de reintento: %s", refund.ID, bookingID, err)
+			message = fmt.Sprintf("cita cancelada con exito, la devolucion de $%.2f se procesara en breve", refund.Amount)
+		}
+	}
+
+	// 8. Cupon, una vez cancelada la cita
+	if consequences.RequiresCoupon {
+		if err := s.issueCoupon(ctx, existing.ClientID, consequences.CouponPercent); err != nil {
+			log.Printf("[COUPON] la cita %d se cancelo sin generar el cupon: %s", bookingID, err)
+			message = "cita cancelada con exito, no fue posible generar el cupon, comuniquese con la barberia"
+		}
 	}
 
-	if err := s.bookingRepo.Cancel(ctx, bookingID); err != nil {
+	return &booking.CancelationResponse{
+		Outcome:        consequences.Outcome,
+		RequiresCoupon: consequences.RequiresCoupon,
+		CouponPercent:  consequences.CouponPercent,
+		RequiresRefund: consequences.RequiresRefund,
+		RefundPercent:  consequences.RefundPercent,
+		RefundAmount:   refundAmount(refund),
+		Refund:         refund,
+		LosesDeposit:   consequences.LosesDeposit,
+		Message:        message,
+		Canceled:       true,
+	}, nil
+}
+
+// Cancela sin cargo una reserva sin cobro aprobado: turnos que se abonan en el local o checkouts sin completar
+func (s *BookingService) cancelUnpaid(ctx context.Context, existing *booking.Booking, actor booking.Actor) (*booking.CancelationResponse, error) {
+
+	if err := s.bookingRepo.Cancel(ctx, existing.ID, actor, "reserva sin pago, cancelada sin cargo"); err != nil {
+		if booking.IsTransitionError(err) {
+			return nil, err
+		}
 		return nil, errors.New("error cancelando la cita")
 	}
 
+	s.offerSlots(s.bookingSlots(ctx, existing))
+
 	return &booking.CancelationResponse{
-		Message:  "cita cancelada con exito",
+		Outcome:  policyDomain.OutcomeFree,
 		Canceled: true,
+		Message:  "cita cancelada con exito, sin cargo",
 	}, nil
 }
 
-func (s *BookingService) UpdateBookingStatus(ctx context.Context, bookingID uint, status string) error {
+func (s *BookingService) UpdateBookingStatus(ctx context.Context, bookingID uint, status string, actor booking.Actor, reason string) error {
 	if status == "" {
 		return errors.New("status no puede ser vacío")
 	}
-	return s.bookingRepo.UpdateStatus(ctx, bookingID, status)
+	return s.bookingRepo.UpdateStatus(ctx, bookingID, status, actor, reason)
 }
 
 func (s *BookingService) GetBookingByID(ctx context.Context, bookingID uint) (*booking.Booking, error) {
@@ -168,22 +244,187 @@ func (s *BookingService) GetBookingByID(ctx context.Context, bookingID uint) (*b
 }
 
 // PARA ADMINISTRADORES
-func (s *BookingService) MarkAsPaid(ctx context.Context, bookingID uint) error {
+func (s *BookingService) MarkAsPaid(ctx context.Context, bookingID uint, actor booking.Actor) error {
 
 	if bookingID == 0 {
 		return errors.New("el id de la reserva no puede ser nulo")
 	}
 
-	return s.bookingRepo.MarkAsPaid(ctx, bookingID)
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return errors.New("no fue posible recuperar la cita")
+	}
+
+	// Solo se confirman reservas pendientes o vencidas, las que ya estan activas ya contabilizaron
+	// el pago y las canceladas o rechazadas no pueden volver a confirmarse
+	if existing.Status == "pendiente_pago" || existing.Status == "expirado" || !slices.Contains(booking.ActiveStatuses, existing.Status) {
+		if err := booking.CanTransition(existing.Status, "confirmado", actor.Role); err != nil {
+			return err
+		}
+	}
+
+	// Las transferencias se aprueban a mano, el pago de la reserva entra al registro antes de calcular el saldo
+	payment, err := s.paymentRepo.GetByBookingID(ctx, bookingID)
+	if err != nil {
+		return errors.New("no fue posible recuperar el pago de la cita")
+	}
+
+	if payment != nil && payment.ID != 0 && payment.Status == "pendiente" {
+		if err := s.paymentRepo.Approve(ctx, payment.ID, "transferencia", time.Now()); err != nil {
+			return errors.New("no fue posible aprobar el pago de la cita")
+		}
+	}
+
+	if err := s.bookingRepo.MarkAsPaid(ctx, bookingID, actor); err != nil {
+		return err
+	}
+
+	// Con el pago aprobado, el cupon aplicado en el checkout queda consumido. Si ya estaba canjeado
+	// (una notificacion repetida) el pago no se rechaza
+	if existing.CouponCode != nil && *existing.CouponCode != "" {
+		if err := s.couponRepo.Redeem(ctx, *existing.CouponCode); err != nil {
+			if !errors.Is(err, coupon.ErrCouponUnavailable) {
+				return errors.New("no fue posible marcar el cupón como usado")
+			}
+			log.Printf("[COUPON] el cupón %s de la reserva %d ya estaba canjeado", *existing.CouponCode, bookingID)
+		}
+	}
+
+	return nil
+}
+
+// Aprueba los pagos pendientes de las reservas del grupo con el pago del proveedor y las confirma
+func (s *BookingService) MarkGroupAsPaid(ctx context.Context, groupID uint, paymentInfo *payments.ProviderPayment) error {
+
+	list, err := s.bookingRepo.ByGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		return fmt.Errorf("el grupo %d no tiene reservas", groupID)
+	}
+
+	return s.markCoveredAsPaid(ctx, list, paymentInfo)
+}
+
+// Confirma las reservas abonadas con un unico pago del proveedor, como una serie prepaga o un grupo.
+// Es idempotente: los pagos ya aprobados se saltean y las reservas ya confirmadas no cambian
+func (s *BookingService) markCoveredAsPaid(ctx context.Context, list []booking.Booking, paymentInfo *payments.ProviderPayment) error {
+
+	for _, b := range list {
+
+		payment, err := s.paymentRepo.GetByBookingID(ctx, b.ID)
+		if err != nil {
+			return err
+		}
+
+		if !hasPayment(payment) {
+			continue
+		}
+
+		if payment.Status == "pendiente" {
+			if err := s.paymentRepo.MarkAsPaid(ctx, payment.ID, paymentInfo.ID); err != nil {
+				return fmt.Errorf("payment fallo actualizando status a pagado: %w", err)
+			}
+		}
+
+		if err := s.MarkAsPaid(ctx, b.ID, booking.SystemActor()); err != nil {
+			// Reintentar no cambia el resultado, el pago queda aprobado y se resuelve a mano
+			if errors.Is(err, booking.ErrBookingExpired) || booking.IsTransitionError(err) {
+				if err := s.reportUnconfirmed(ctx, payment, paymentInfo, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("booking fallo actualizando status a confirmado: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Registra para revision el pago aprobado que no pudo confirmar su reserva, porque vencio
+// y otro cliente tomo el turno o porque ya fue cancelada. Un administrador decide si se devuelve
+func (s *BookingService) ReportUnconfirmedPayment(ctx context.Context, paymentID uint, paymentInfo *payments.ProviderPayment, cause error) error {
+
+	payment, err := s.paymentRepo.GetByID(ctx, paymentID)
+	if err != nil || payment == nil {
+		return errors.New("no fue posible recuperar el pago")
+	}
+
+	return s.reportUnconfirmed(ctx, payment, paymentInfo, cause)
+}
+
+func (s *BookingService) reportUnconfirmed(ctx context.Context, payment *payments.Payment, paymentInfo *payments.ProviderPayment, cause error) error {
+
+	log.Printf("[WEBHOOK] el pago %s no pudo confirmar la reserva %d: %s", paymentInfo.ID, payment.BookingID, cause)
+
+	detail := "El pago fue aprobado pero la reserva ya no esta activa"
+	if errors.Is(cause, booking.ErrBookingExpired) {
+		detail = "El pago fue aprobado despues del vencimiento y el turno ya fue tomado"
+	}
+
+	d := discrepancy(payment, *paymentInfo, payments.DiscrepancyCanceled, "revision", detail)
+	if _, err := s.reconRepo.Create(ctx, &d); err != nil {
+		return fmt.Errorf("no fue posible registrar el pago para revision: %w", err)
+	}
+
+	return nil
+}
+
+// Vence las reservas que no se pagaron a tiempo y ofrece sus turnos a la lista de espera
+func (s *BookingService) ExpirePending(ctx context.Context) {
+
+	expired, err := s.bookingRepo.ExpirePending(ctx, time.Now())
+	if err != nil {
+		log.Println("[BOOKING] error venciendo reservas sin pago:", err)
+		return
+	}
+
+	for _, b := range expired {
+		log.Printf("[BOOKING] reserva %d vencida sin pago, turno %d liberado", b.ID, b.SlotID)
+		for _, slotID := range s.bookingSlots(ctx, &b) {
+			s.waitlistSvc.OfferSlot(ctx, slotID)
+		}
+	}
+}
+
+// Proceso en segundo plano que vence las reservas sin pago, se detiene al cancelar ctx
+func (s *BookingService) StartExpiryJob(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.ExpirePending(ctx)
+			}
+		}
+	}()
 }
 
-func (s *BookingService) MarkAsRejected(ctx context.Context, bookingID uint) error {
+func (s *BookingService) MarkAsRejected(ctx context.Context, bookingID uint, actor booking.Actor, reason string) error {
 
 	if bookingID == 0 {
 		return errors.New("el id de la reserva no puede ser nulo")
 	}
 
-	return s.bookingRepo.MarkAsRejected(ctx, bookingID)
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return errors.New("no fue posible recuperar la cita")
+	}
+
+	if err := s.bookingRepo.MarkAsRejected(ctx, bookingID, actor, reason); err != nil {
+		return err
+	}
+
+	s.offerSlots(s.bookingSlots(ctx, existing))
+
+	return nil
 }
 
 // PARA BARBEROS
@@ -218,7 +459,7 @@ func (s *BookingService) GetByUserID(ctx context.Context, userID uint, offset in
 	return s.bookingRepo.GetByUserID(ctx, userID, offset)
 }
 
-func (s *BookingService) Reschedule(ctx context.Context, bookingID, slotID uint) (*booking.RescheduleResponse, error) {
+func (s *BookingService) Reschedule(ctx context.Context, bookingID, slotID, userID uint, isAdmin bool) (*booking.RescheduleResponse, error) {
 
 	if bookingID == 0 {
 		return nil, errors.New("el id de la reserva es necesario")
@@ -230,58 +471,91 @@ func (s *BookingService) Reschedule(ctx context.Context, bookingID, slotID uint)
 
 	// 1. Recuperar booking
 	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
-	if err != nil {
+	if err != nil || existing == nil {
 		return nil, errors.New("no fue posible recuperar la cita")
 	}
 
+	actor, err := actorFor(existing, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.Role == booking.ActorBarber {
+		return nil, errShopChange
+	}
+
+	if err := booking.CanTransition(existing.Status, "reprogramado", actor.Role); err != nil {
+		return nil, err
+	}
+
 	// 2. Validar si ya ocurrio
 	now := time.Now().UTC()
 	if existing.Slot.Start.UTC().Before(now) {
 		return nil, errors.New("la cita ya ocurrió")
 	}
 
-	// 3. ¿Esta dentro de las 24hs? → helper
-	isWithin := IsWithin24Hours(existing.Slot.Start)
+	// 3. Verificar que el nuevo turno este libre antes de cobrar o mover la cita
+	taken, err := s.bookingRepo.IsSlotTaken(ctx, slotID, bookingID)
+	if err != nil {
+		if booking.IsSlotError(err) {
+			return nil, err
+		}
+		return nil, errors.New("no fue posible verificar el turno")
+	}
+
+	if taken {
+		return nil, booking.ErrSlotTaken
+	}
 
-	// --- CASE A — Dentro de 24h → requiere pago ----
-	if isWithin {
+	// 4. Evaluar la politica de reprogramacion
+	payment, err := s.paymentRepo.GetByBookingID(ctx, existing.ID)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar el pago asociado")
+	}
 
-		payment, err := s.paymentRepo.GetByBookingID(ctx, existing.ID)
+	// Sin pago al reservar no hay monto sobre el cual aplicar un recargo
+	decision := &policyDomain.Decision{Outcome: policyDomain.OutcomeFree}
+	if isPaid(payment) {
+		decision, err = s.evaluatePolicy(ctx, policyDomain.ActionReschedule, existing, payment.Type)
 		if err != nil {
-			return nil, errors.New("no fue posible recuperar el pago asociado")
+			return nil, err
 		}
+	}
 
-		surcharge := GetSurcharge(payment.Type, int64(payment.Amount))
+	// --- CASE A — La politica aplica un recargo → requiere pago ----
+	if decision.Outcome == policyDomain.OutcomeSurcharge && decision.Percentage > 0 {
 
-		percentage := 0
-		switch payment.Type {
-		case "parcial":
-			percentage = 50
-		case "total":
-			percentage = 25
-		}
+		percentage := decision.Percentage
+		surcharge := s.pricingSvc.Surcharge("Reprogramacion del turno", payment.Amount, float64(percentage))
 
-		initPoint, err := CreateReschedulePref(*existing, *payment, slotID)
+		initPoint, err := s.CreateReschedulePref(ctx, *existing, *payment, slotID, surcharge.Total)
 		if err != nil {
 			return nil, errors.New("no fue posible crear el link de pago")
 		}
 
 		return &booking.RescheduleResponse{
 			RequiresPayment: true,
-			Amount:          float64(surcharge),
+			Amount:          surcharge.Total,
 			Percentage:      percentage,
+			Quote:           surcharge,
 			InitPoint:       initPoint,
 			Free:            false,
 			Reprogrammed:    false,
-			Message:         fmt.Sprintf("La reprogramación es dentro de las 24 horas. Se aplicará un recargo del %d%% (monto: $%d).", percentage, surcharge),
+			Message:         fmt.Sprintf("%s (monto: $%.2f).", strings.TrimSuffix(decision.Message, "."), surcharge.Total),
 		}, nil
 	}
 
 	// --- CASE B — Reprogramacion gratuita ----
+	freed := s.bookingSlots(ctx, existing)
 	if err = s.bookingRepo.UpdateSlot(ctx, bookingID, slotID); err != nil {
+		if booking.IsSlotError(err) {
+			return nil, err
+		}
 		return nil, errors.New("no fue posible reprogramar la cita")
 	}
 
+	s.offerSlots(freed)
+
 	return &booking.RescheduleResponse{
 		RequiresPayment: false,
 		Free:            true,
@@ -290,7 +564,8 @@ func (s *BookingService) Reschedule(ctx context.Context, bookingID, slotID uint)
 	}, nil
 }
 
-func (s *BookingService) RescheduleWithSurcharge(ctx context.Context, bookingID, slotID uint) error {
+// Reprograma la cita una vez aprobado el pago del recargo, que queda en el registro de pagos
+func (s *BookingService) RescheduleWithSurcharge(ctx context.Context, bookingID, slotID uint, surcharge *payments.ProviderPayment) error {
 	if bookingID == 0 {
 		return errors.New("el id de la reserva es necesario")
 	}
@@ -299,29 +574,39 @@ func (s *BookingService) RescheduleWithSurcharge(ctx context.Context, bookingID,
 		return errors.New("el id del turno es necesario")
 	}
 
-	// 1. Recuperar booking
-	_, err := s.bookingRepo.GetByID(ctx, bookingID)
-	if err != nil {
+	// 1. Recuperar booking, si mientras se pagaba el recargo fue cancelada ya no se reprograma
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
 		return errors.New("no fue posible recuperar la cita")
 	}
 
-	// 2. Actualizar el bookings con el nuevo id
-	if err = s.bookingRepo.UpdateSlot(ctx, bookingID, slotID); err != nil {
-		return errors.New("no fue posible reprogramar la cita")
+	if err := booking.CanTransition(existing.Status, "reprogramado", booking.ActorSystem); err != nil {
+		return err
 	}
 
-	// 3. Marcar como reprogramado
-	if err := s.bookingRepo.MarkAsRescheduled(ctx, bookingID); err != nil {
-		return errors.New("no fue posible cambiar el estado a reprogramado")
+	// 2. Mover la reserva, marcarla reprogramada y registrar el recargo cobrado en una misma transaccion
+	freed := s.bookingSlots(ctx, existing)
+	if err := s.bookingRepo.RescheduleWithCharge(ctx, bookingID, slotID, booking.SystemActor(), surchargeCharge(surcharge)); err != nil {
+
+		// 3. El turno no se retiene mientras se paga el recargo, si otro cliente lo tomo se devuelve el recargo
+		if booking.IsSlotError(err) {
+			return s.refundSurcharge(ctx, existing, surcharge)
+		}
+
+		if booking.IsTransitionError(err) {
+			return err
+		}
+		return errors.New("no fue posible reprogramar la cita")
 	}
 
+	s.offerSlots(freed)
+
 	return nil
 }
 
-func CreateReschedulePref(booking booking.Booking, payment payments.Payment, slotID uint) (string, error) {
+func (s *BookingService) CreateReschedulePref(ctx context.Context, booking booking.Booking, payment payments.Payment, slotID uint, amount float64) (string, error) {
 
 	var (
-		MP_ACCESS_TOKEN  = os.Getenv("MP_ACCESS_TOKEN")
 		notification_url = os.Getenv("NGROK_URL")
 	)
 
@@ -329,67 +614,968 @@ func CreateReschedulePref(booking booking.Booking, payment payments.Payment, slo
 		return "", errors.New("no fue posible recuperar las variables de entorno")
 	}
 
-	// 1. Analizar instancia
-	totalAmount := GetSurcharge(payment.Type, int64(payment.Amount))
-
-	log.Println("[DEBUG] payment.Status =", payment.Status)
-	log.Println("[DEBUG] payment.Amount =", payment.Amount)
-	log.Println("[DEBUG] totalAmount =", totalAmount)
-
-	// 4. Configurar Mercado Pago
-	cfg, err := config.New(MP_ACCESS_TOKEN)
-	if err != nil {
-		return "", errors.New("error al configurar Mercado Pago")
-	}
-
-	client := preference.NewClient(cfg)
+	// 1. Crear checkout en el proveedor de pagos. El turno nuevo no se retiene mientras se paga,
+	// el checkout vence como el de una reserva para no cobrar un recargo sobre un turno ya tomado
+	expiresAt := time.Now().Add(DefaultBookingExpiry)
 
-	mpRequest := preference.Request{
-		Items: []preference.ItemRequest{
-			{
-				Title:     "Reprogramacion del turno",
-				UnitPrice: float64(totalAmount),
-				Quantity:  1,
-			},
-		},
-		Payer: &preference.PayerRequest{
-			Name:    booking.Client.Name,
-			Surname: booking.Client.Surname,
-		},
+	checkout, err := s.gateway.CreateCheckout(ctx, payments.CheckoutRequest{
+		Title:           "Reprogramacion del turno",
+		Amount:          amount,
+		Quantity:        1,
+		PayerName:       booking.Client.Name,
+		PayerSurname:    booking.Client.Surname,
 		NotificationURL: fmt.Sprintf("%s/api/v1/mercado_pago/notification/reschedule", notification_url),
+		BackURL:         "http://localhost:5173",
 		Metadata: map[string]any{
 			"booking_id": booking.ID,
 			"payment_id": payment.ID,
 			"slot_id":    slotID,
 		},
-		BackURLs: &preference.BackURLsRequest{
-			Success: "http://localhost:5173",
-		},
+		ExternalReference: payments.RescheduleReference(booking.ID, slotID),
+		ExpiresAt:         &expiresAt,
+	})
+	if err != nil {
+		log.Printf("[RESCHEDULE] error creando el checkout del recargo de la reserva %d: %s", booking.ID, err)
+		return "", err
+	}
+
+	return checkout.InitPoint, nil
+}
+
+// Devolucion de un monto del cobro como movimiento propio, pendiente hasta que la notificacion del proveedor la confirma
+func pendingRefund(payment *payments.Payment, amount float64) (*payments.Payment, error) {
+
+	if !isRefundable(payment) {
+		return nil, payments.ErrNotRefundable
 	}
 
-	preferenceRes, err := client.Create(context.Background(), mpRequest)
+	if amount <= 0 {
+		return nil, errors.New("el monto a devolver debe ser mayor a cero")
+	}
+
+	return &payments.Payment{
+		BookingID: payment.BookingID,
+		Amount:    amount,
+		Type:      payment.Type,
+		Method:    payment.Method,
+		Status:    "pendiente",
+		Kind:      payments.KindRefund,
+		RefundOf:  &payment.ID,
+	}, nil
+}
+
+// Solicita al proveedor una devolucion ya registrada y guarda su id
+func (s *BookingService) sendRefund(ctx context.Context, entry, payment *payments.Payment) error {
+
+	providerRefund, err := s.gateway.Refund(ctx, *payment.MercadoPagoID, entry.Amount)
 	if err != nil {
-		log.Println("[DEBUG]", err.Error())
+		return err
+	}
 
-		return "", errors.New("error al crear preferencia en Mercado Pago")
+	entry.MercadoPagoID = &providerRefund.ID
+	if err := s.paymentRepo.Update(ctx, entry); err != nil {
+		log.Println("[REFUND] error guardando el id de la devolucion:", err)
 	}
 
-	return preferenceRes.InitPoint, nil
+	return nil
 }
 
-func IsWithin24Hours(slotStart time.Time) bool {
-	now := time.Now().UTC()
-	return slotStart.UTC().Sub(now) <= 24*time.Hour
+const (
+	// Devoluciones reintentadas en cada corrida
+	refundRetryBatch = 50
+
+	// Antiguedad minima para reintentar, las mas recientes pueden tener la solicitud en curso
+	refundRetryDelay = time.Minute
+)
+
+// Vuelve a solicitar las devoluciones de citas ya canceladas que el proveedor no llego a recibir
+func (s *BookingService) RetryRefunds(ctx context.Context) {
+
+	pending, err := s.paymentRepo.UnsentRefunds(ctx, time.Now().Add(-refundRetryDelay), refundRetryBatch)
+	if err != nil {
+		log.Println("[REFUND] error recuperando devoluciones pendientes:", err)
+		return
+	}
+
+	for i := range pending {
+		entry := &pending[i]
+		if entry.RefundOf == nil {
+			continue
+		}
+
+		charge, err := s.paymentRepo.GetByID(ctx, *entry.RefundOf)
+		if err != nil || charge == nil || !isRefundable(charge) {
+			log.Printf("[REFUND] la devolucion %d no tiene un cobro del proveedor para reintentarla", entry.ID)
+			continue
+		}
+
+		if err := s.sendRefund(ctx, entry, charge); err != nil {
+			log.Printf("[REFUND] la devolucion %d sigue pendiente: %s", entry.ID, err)
+		}
+	}
 }
 
-func GetSurcharge(paymentStatus string, totalPaid int64) int64 {
+// Proceso en segundo plano que reintenta las devoluciones pendientes, se detiene al cancelar ctx
+func (s *BookingService) StartRefundRetryJob(ctx context.Context, interval time.Duration) {
 
-	switch paymentStatus {
-	case "parcial":
-		return totalPaid * 50 / 100
-	case "total":
-		return totalPaid * 25 / 100
-	default:
-		return 0
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.RetryRefunds(ctx)
+			}
+		}
+	}()
+}
+
+func surchargeCharge(surcharge *payments.ProviderPayment) *payments.Payment {
+
+	if surcharge == nil {
+		return nil
+	}
+
+	providerID := surcharge.ID
+	return &payments.Payment{
+		Amount:        surcharge.Amount,
+		Type:          "total",
+		Method:        "mercadopago",
+		Status:        "aprobado",
+		MercadoPagoID: &providerID,
+		PaidAt:        surcharge.PaidAt,
+		Kind:          payments.KindCharge,
+		Concept:       payments.ConceptSurcharge,
+	}
+}
+
+// Registra el recargo cobrado junto con su devolucion total y la solicita al proveedor, la cita queda
+// en su turno original. Si la devolucion no llega al proveedor queda pendiente y se reintenta
+func (s *BookingService) refundSurcharge(ctx context.Context, existing *booking.Booking, surcharge *payments.ProviderPayment) error {
+
+	charge := surchargeCharge(surcharge)
+	if charge == nil {
+		return booking.ErrSlotTaken
+	}
+
+	// Una notificacion repetida encuentra el recargo ya registrado con su devolucion
+	recorded, err := s.paymentRepo.GetByProviderID(ctx, surcharge.ID)
+	if err != nil {
+		return errors.New("no fue posible verificar el pago del recargo")
+	}
+
+	if recorded != nil {
+		return nil
+	}
+
+	charge.BookingID = existing.ID
+	refund, err := pendingRefund(charge, charge.Amount)
+	if err != nil {
+		return err
+	}
+
+	if err := s.paymentRepo.CreateWithRefund(ctx, charge, refund); err != nil {
+		return errors.New("no fue posible registrar la devolucion del recargo")
+	}
+
+	if err := s.sendRefund(ctx, refund, charge); err != nil {
+		log.Printf("[REFUND] la devolucion %d del recargo de la cita %d queda pendiente de reintento: %s", refund.ID, existing.ID, err)
+	}
+
+	s.notifySvc.Notify(ctx, existing.ClientID, existing.ID, notification.TypeRescheduled,
+		fmt.Sprintf("El turno elegido ya no esta disponible, tu cita sigue el %s. Te devolveremos el recargo de $%.2f.", existing.Slot.Start.Format(noticeTimeFormat), charge.Amount))
+
+	return nil
+}
+
+// Cobro del saldo registrado por el barbero en el local (efectivo, tarjeta o transferencia)
+func (s *BookingService) RecordChairPayment(ctx context.Context, bookingID, barberID uint, isAdmin bool, amount float64, method string) (*payments.Ledger, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva no puede ser nulo")
+	}
+
+	if method != "efectivo" && method != "tarjeta" && method != "transferencia" {
+		return nil, errors.New("metodo de pago invalido, debe ser efectivo, tarjeta o transferencia")
+	}
+
+	if amount <= 0 {
+		return nil, errors.New("el monto debe ser mayor a cero")
+	}
+
+	// 1. Recuperar la reserva, solo su barbero o un administrador registran cobros
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	if !isAdmin && existing.Slot.BarberID != barberID {
+		return nil, errors.New("la cita no pertenece al barbero")
+	}
+
+	if !slices.Contains([]string{"confirmado", "reprogramado", "en_curso", "completado"}, existing.Status) {
+		return nil, errors.New("solo se pueden registrar cobros de citas confirmadas")
+	}
+
+	// 2. Registrar el cobro contra el saldo
+	now := time.Now()
+	recorder := barberID
+
+	ledger, err := s.paymentRepo.RecordCharge(ctx, &payments.Payment{
+		BookingID:  bookingID,
+		Amount:     amount,
+		Type:       "total",
+		Method:     method,
+		Status:     "aprobado",
+		PaidAt:     &now,
+		Kind:       payments.KindCharge,
+		Concept:    payments.ConceptBalance,
+		RecordedBy: &recorder,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Con el saldo en cero la reserva pasa a pagada, si su estado lo permite
+	actor := booking.NewActor(booking.ActorBarber, barberID)
+	if existing.Slot.BarberID != barberID {
+		actor.Role = booking.ActorAdmin
+	}
+
+	if ledger.BalanceDue <= 0.005 && booking.CanTransition(existing.Status, "pagado", actor.Role) == nil {
+		if err := s.bookingRepo.UpdateStatus(ctx, bookingID, "pagado", actor, "saldo cobrado en el local"); err != nil {
+			log.Printf("[BOOKING] la reserva %d quedo saldada pero no pudo marcarse como pagada: %s", bookingID, err)
+		}
 	}
+
+	return ledger, nil
+}
+
+// Registra que el cliente se presento y esta siendo atendido. Se permite desde un rato antes del turno
+func (s *BookingService) CheckIn(ctx context.Context, bookingID, userID uint, isAdmin bool) error {
+	_, err := s.closeTurn(ctx, bookingID, userID, isAdmin, "en_curso", "el cliente se presento", checkInWindow)
+	return err
+}
+
+// Marca la reserva como completada una vez comenzado el turno
+func (s *BookingService) Complete(ctx context.Context, bookingID, userID uint, isAdmin bool) error {
+	_, err := s.closeTurn(ctx, bookingID, userID, isAdmin, "completado", "turno completado", 0)
+	return err
+}
+
+// Marca que el cliente no se presento y aplica la politica de ausencias: lo abonado se pierde o se
+// devuelve como cupon, y al alcanzar las ausencias configuradas sus proximas reservas exigen el pago total
+func (s *BookingService) MarkNoShow(ctx context.Context, bookingID, userID uint, isAdmin bool) (*booking.NoShowResponse, error) {
+
+	// 1. Politica vigente, su mensaje queda como motivo del cambio de estado
+	noShow := s.policySvc.NoShow(ctx)
+
+	// 2. Marcar la ausencia
+	existing, err := s.closeTurn(ctx, bookingID, userID, isAdmin, "ausente", noShow.Message, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &booking.NoShowResponse{
+		Outcome: noShow.Outcome,
+		Message: noShow.Message,
+	}
+
+	// 3. Cupon por lo abonado, solo si la reserva tenia un pago aprobado
+	if noShow.Outcome == policyDomain.OutcomeCoupon {
+		payment, err := s.paymentRepo.GetByBookingID(ctx, bookingID)
+		if err != nil {
+			log.Printf("[BOOKING] no fue posible recuperar el pago de la reserva %d ausente: %s", bookingID, err)
+		}
+
+		if payment != nil && payment.Status == "aprobado" {
+			response.CouponPercent = noShow.Percentage
+			if err := s.issueCoupon(ctx, existing.ClientID, noShow.Percentage); err != nil {
+				log.Printf("[COUPON] no fue posible generar el cupon de la reserva %d ausente: %s", bookingID, err)
+			}
+		}
+	}
+
+	// 4. Ausencias acumuladas del cliente
+	count, err := s.bookingRepo.CountNoShows(ctx, existing.ClientID, noShow.Since(time.Now()))
+	if err != nil {
+		log.Printf("[BOOKING] no fue posible contar las ausencias del cliente %d: %s", existing.ClientID, err)
+		return response, nil
+	}
+
+	response.NoShows = count
+	response.PrepaymentRequired = noShow.PrepayAfter > 0 && count >= int64(noShow.PrepayAfter)
+
+	return response, nil
+}
+
+// Cambia el estado de una reserva que llego a su turno, solo su barbero o un administrador pueden hacerlo
+func (s *BookingService) closeTurn(ctx context.Context, bookingID, userID uint, isAdmin bool, status, reason string, early time.Duration) (*booking.Booking, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva no puede ser nulo")
+	}
+
+	// 1. Recuperar la reserva y validar el cambio de estado
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	actor, err := actorFor(existing, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := booking.CanTransition(existing.Status, status, actor.Role); err != nil {
+		return nil, err
+	}
+
+	// 2. Validar que el turno haya comenzado
+	if time.Now().Before(existing.Slot.Start.Add(-early)) {
+		return nil, errors.New("el turno todavia no comenzo")
+	}
+
+	if err := s.bookingRepo.UpdateStatus(ctx, bookingID, status, actor, reason); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// Marca las reservas cuyo turno termino hace un rato sin cerrarse como completadas o ausentes
+func (s *BookingService) FlagUnclosed(ctx context.Context) {
+
+	flagged, err := s.bookingRepo.FlagUnclosed(ctx, time.Now().Add(-unclosedGrace))
+	if err != nil {
+		log.Println("[BOOKING] error marcando reservas sin cerrar:", err)
+		return
+	}
+
+	if flagged > 0 {
+		log.Printf("[BOOKING] %d reservas terminaron sin marcarse completadas o ausentes", flagged)
+	}
+}
+
+// Proceso en segundo plano que marca las reservas sin cerrar, se detiene al cancelar ctx
+func (s *BookingService) StartUnclosedJob(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.FlagUnclosed(ctx)
+			}
+		}
+	}()
+}
+
+// Reservas sin cerrar de un barbero, los administradores ven las de todos los barberos
+func (s *BookingService) Unclosed(ctx context.Context, userID uint, isAdmin, isBarber bool) ([]booking.Booking, error) {
+
+	switch {
+	case isAdmin:
+		return s.bookingRepo.Unclosed(ctx, 0)
+	case isBarber:
+		return s.bookingRepo.Unclosed(ctx, userID)
+	default:
+		return nil, errors.New("usted no tiene autorizacion")
+	}
+}
+
+// Cancelacion por decision de la barberia (barbero enfermo, sobreturno)
+type ShopCancelRequest struct {
+	Compensation  string `json:"compensation"`   // reembolso (por defecto) o cupon
+	CouponPercent int    `json:"coupon_percent"` // porcentaje del cupon, por defecto 100
+	Reason        string `json:"reason"`
+}
+
+// Reprogramacion de todas las citas de un barbero en un rango horario
+type BulkRescheduleRequest struct {
+	BarberID       uint      `json:"barber_id"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	TargetBarberID uint      `json:"target_barber_id"` // barbero que toma las citas, 0 = el mismo
+	ShiftMinutes   int       `json:"shift_minutes"`    // desplazamiento de cada turno, puede ser negativo
+	Reason         string    `json:"reason"`
+}
+
+// Cancela la reserva por decision de la barberia, sin penalidad para el cliente: se le devuelve todo lo
+// abonado a traves del proveedor o se le entrega un cupon, y se le avisa de la cancelacion
+func (s *BookingService) ShopCancel(ctx context.Context, bookingID, userID uint, isAdmin bool, req ShopCancelRequest) (*booking.CancelationResponse, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva no puede ser nulo")
+	}
+
+	switch req.Compensation {
+	case "", policyDomain.OutcomeRefund:
+		req.Compensation = policyDomain.OutcomeRefund
+	case policyDomain.OutcomeCoupon:
+		if req.CouponPercent == 0 {
+			req.CouponPercent = 100
+		}
+		if req.CouponPercent < 0 || req.CouponPercent > 100 {
+			return nil, errors.New("el porcentaje del cupon debe estar entre 1 y 100")
+		}
+	default:
+		return nil, booking.ErrCompensationNotAllowed
+	}
+
+	// 1. Recuperar la reserva y validar la cancelacion antes de devolver nada
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	actor, err := staffActor(existing, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Cancelar, devolver y avisar al cliente
+	response, err := s.shopCancel(ctx, existing, actor, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Liberar los turnos
+	s.offerSlots(s.bookingSlots(ctx, existing))
+
+	return response, nil
+}
+
+// Cancela la reserva en nombre de la barberia y avisa al cliente. El turno lo ofrece quien llama
+func (s *BookingService) shopCancel(ctx context.Context, existing *booking.Booking, actor booking.Actor, req ShopCancelRequest) (*booking.CancelationResponse, error) {
+
+	bookingID := existing.ID
+
+	if err := booking.CanTransition(existing.Status, "cancelado", actor.Role); err != nil {
+		return nil, err
+	}
+
+	if existing.Slot.Start.Before(time.Now()) {
+		return nil, errors.New("la cita ya ocurrió")
+	}
+
+	response := &booking.CancelationResponse{Outcome: req.Compensation}
+
+	// 1. Calcular la devolucion de lo abonado
+	var refunds []refundRequest
+	if req.Compensation == policyDomain.OutcomeRefund {
+		ledger, err := s.paymentRepo.Ledger(ctx, bookingID)
+		if err != nil {
+			return nil, errors.New("no fue posible recuperar los pagos de la cita")
+		}
+
+		var manual float64
+		refunds, manual = pendingRefunds(ledger)
+
+		for _, r := range refunds {
+			response.RefundAmount += r.entry.Amount
+		}
+
+		response.RequiresRefund = len(refunds) > 0
+		response.RefundPercent = 100
+		response.ManualRefund = manual
+	}
+
+	// 2. Cancelar y registrar las devoluciones pendientes en una misma transaccion
+	reason := shopReason(req.Reason, "cancelado por la barberia")
+	if err := s.bookingRepo.CancelWithRefund(ctx, bookingID, actor, reason, refundEntries(refunds)...); err != nil {
+		if booking.IsTransitionError(err) {
+			return nil, err
+		}
+		return nil, errors.New("error cancelando la cita")
+	}
+
+	// Solicitar las devoluciones, las que el proveedor no acepte quedan pendientes y se reintentan
+	for _, r := range refunds {
+		if err := s.sendRefund(ctx, r.entry, r.charge); err != nil {
+			log.Printf("[REFUND] la devolucion %d de la cita %d queda pendiente de reintento: %s", r.entry.ID, bookingID, err)
+		}
+	}
+
+	if req.Compensation == policyDomain.OutcomeCoupon {
+		response.RequiresCoupon = true
+		response.CouponPercent = req.CouponPercent
+		if err := s.issueCoupon(ctx, existing.ClientID, req.CouponPercent); err != nil {
+			log.Printf("[COUPON] la cita %d se cancelo sin generar el cupon: %s", bookingID, err)
+		}
+	}
+
+	// 3. Avisar al cliente
+	message := fmt.Sprintf("La barberia cancelo tu turno del %s (%s).", existing.Slot.Start.Format(noticeTimeFormat), reason)
+	switch {
+	case response.RequiresCoupon:
+		message += fmt.Sprintf(" Recibirás un cupón del %d%%.", response.CouponPercent)
+	case response.RefundAmount > 0 || response.ManualRefund > 0:
+		message += fmt.Sprintf(" Te devolveremos $%.2f.", response.RefundAmount+response.ManualRefund)
+	}
+
+	s.notifySvc.Notify(ctx, existing.ClientID, bookingID, notification.TypeCanceled, message)
+
+	response.Canceled = true
+	response.Message = message
+	if response.ManualRefund > 0 {
+		response.Message = fmt.Sprintf("%s Hay $%.2f abonados por otros medios que deben devolverse a mano.", message, response.ManualRefund)
+	}
+
+	return response, nil
+}
+
+// Cancela la reserva porque el barbero modifico o elimino su turno, con el tratamiento de una cancelacion
+// de la barberia. El modulo de turnos ofrece los turnos liberados una vez aplicado el cambio
+func (s *BookingService) CancelForSlot(ctx context.Context, bookingID, barberID uint, reason string) error {
+
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return errors.New("no fue posible recuperar la cita")
+	}
+
+	actor, err := staffActor(existing, barberID, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.shopCancel(ctx, existing, actor, ShopCancelRequest{Compensation: policyDomain.OutcomeRefund, Reason: reason})
+	return err
+}
+
+// La reserva acompaño a su turno, que el barbero movio de horario: queda reprogramada y se avisa al cliente.
+// Una reserva pendiente de pago mantiene su estado, el pago que llegue vale para el nuevo horario
+func (s *BookingService) SlotMoved(ctx context.Context, bookingID, barberID uint, from time.Time, reason string) error {
+
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return errors.New("no fue posible recuperar la cita")
+	}
+
+	actor, err := staffActor(existing, barberID, false)
+	if err != nil {
+		return err
+	}
+
+	reason = shopReason(reason, "reprogramado por la barberia")
+
+	if existing.Status != "pendiente_pago" {
+		if err := s.bookingRepo.UpdateStatus(ctx, bookingID, "reprogramado", actor, reason); err != nil {
+			if booking.IsTransitionError(err) {
+				return err
+			}
+			return errors.New("no fue posible cambiar el estado a reprogramado")
+		}
+	}
+
+	s.notifySvc.Notify(ctx, existing.ClientID, bookingID, notification.TypeRescheduled,
+		fmt.Sprintf("La barberia reprogramo tu turno del %s para el %s (%s).", from.Format(noticeTimeFormat), existing.Slot.Start.Format(noticeTimeFormat), reason))
+
+	return nil
+}
+
+// Turnos que ocupa la reserva, las reservas sin turnos registrados solo ocupan el inicial
+func (s *BookingService) bookingSlots(ctx context.Context, b *booking.Booking) []uint {
+
+	slotIDs, err := s.bookingRepo.SlotIDs(ctx, b.ID)
+	if err != nil {
+		log.Printf("[BOOKING] error recuperando los turnos de la reserva %d: %s", b.ID, err)
+	}
+
+	if len(slotIDs) == 0 {
+		return []uint{b.SlotID}
+	}
+
+	return slotIDs
+}
+
+// Ofrece a la lista de espera los turnos que quedaron libres, una reserva de varios servicios libera varios
+func (s *BookingService) offerSlots(slotIDs []uint) {
+	go func() {
+		for _, slotID := range slotIDs {
+			s.waitlistSvc.OfferSlot(context.Background(), slotID)
+		}
+	}()
+}
+
+// Ofrece a la lista de espera un turno que quedo libre
+func (s *BookingService) OfferSlot(ctx context.Context, slotID uint) {
+	go s.waitlistSvc.OfferSlot(context.Background(), slotID)
+}
+
+// Reprograma la reserva por decision de la barberia, sin recargo para el cliente, y le avisa del nuevo turno
+func (s *BookingService) ShopReschedule(ctx context.Context, bookingID, slotID, userID uint, isAdmin bool, reason string) (*booking.RescheduleResponse, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva es necesario")
+	}
+
+	if slotID == 0 {
+		return nil, errors.New("el id del turno es necesario")
+	}
+
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	actor, err := staffActor(existing, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	freed := s.bookingSlots(ctx, existing)
+	if err := s.shopMove(ctx, existing, slotID, actor, shopReason(reason, "reprogramado por la barberia")); err != nil {
+		return nil, err
+	}
+
+	s.offerSlots(freed)
+
+	return &booking.RescheduleResponse{
+		Free:         true,
+		Reprogrammed: true,
+		Message:      "La cita fue reprogramada sin costo para el cliente.",
+	}, nil
+}
+
+// Mueve las citas de un barbero en un rango horario al mismo horario de otro barbero o desplazadas
+// en el tiempo. Cada cita se mueve por separado, las que no encuentran turno quedan informadas
+// para resolverlas a mano
+func (s *BookingService) BulkReschedule(ctx context.Context, userID uint, isAdmin bool, req BulkRescheduleRequest) ([]booking.BulkMoveResult, error) {
+
+	if req.BarberID == 0 {
+		return nil, errors.New("el id del barbero es necesario")
+	}
+
+	if !isAdmin && req.BarberID != userID {
+		return nil, errors.New("solo puede mover sus propias citas")
+	}
+
+	if !req.To.After(req.From) {
+		return nil, errors.New("el fin del rango debe ser posterior al inicio")
+	}
+
+	target := req.TargetBarberID
+	if target == 0 {
+		target = req.BarberID
+	}
+
+	shift := time.Duration(req.ShiftMinutes) * time.Minute
+	if target == req.BarberID && shift == 0 {
+		return nil, errors.New("indique otro barbero o un desplazamiento para las citas")
+	}
+
+	actor := booking.NewActor(booking.ActorBarber, userID)
+	if isAdmin {
+		actor.Role = booking.ActorAdmin
+	}
+
+	// 1. Citas del rango que todavia pueden reprogramarse
+	list, err := s.bookingRepo.ByBarberRange(ctx, req.BarberID, req.From, req.To, []string{"confirmado", "pagado", "reprogramado"})
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar las citas del rango")
+	}
+
+	// Al postergar se mueven primero las ultimas, asi cada cita encuentra libre el turno que deja la siguiente
+	if shift > 0 {
+		slices.Reverse(list)
+	}
+
+	// 2. Mover cada cita, los turnos liberados se ofrecen a la lista de espera al terminar
+	// para que una oferta no retenga el turno que necesita la cita siguiente
+	reason := shopReason(req.Reason, "reprogramado por la barberia")
+	results := make([]booking.BulkMoveResult, 0, len(list))
+	freed := make([]uint, 0, len(list))
+
+	for i := range list {
+		b := &list[i]
+		result := booking.BulkMoveResult{BookingID: b.ID, ClientID: b.ClientID, FromSlotID: b.SlotID}
+
+		slot, err := s.bookingRepo.FindSlot(ctx, target, b.Slot.Start.Add(shift))
+		switch {
+		case err != nil:
+			result.Error = "no fue posible recuperar el turno"
+		case slot == nil:
+			result.Error = booking.ErrSlotNotFound.Error()
+		default:
+			slotIDs := s.bookingSlots(ctx, b)
+			if err := s.shopMove(ctx, b, slot.ID, actor, reason); err != nil {
+				result.Error = err.Error()
+				break
+			}
+			result.ToSlotID = slot.ID
+			result.Moved = true
+			freed = append(freed, slotIDs...)
+		}
+
+		results = append(results, result)
+	}
+
+	s.offerSlots(freed)
+
+	return results, nil
+}
+
+// Mueve la reserva al turno indicado sin recargo y avisa al cliente. El turno anterior lo ofrece quien llama
+func (s *BookingService) shopMove(ctx context.Context, existing *booking.Booking, slotID uint, actor booking.Actor, reason string) error {
+
+	if err := booking.CanTransition(existing.Status, "reprogramado", actor.Role); err != nil {
+		return err
+	}
+
+	if existing.Slot.Start.Before(time.Now()) {
+		return errors.New("la cita ya ocurrió")
+	}
+
+	slot, err := s.bookingRepo.GetSlot(ctx, slotID)
+	if err != nil {
+		return errors.New("no fue posible recuperar el turno")
+	}
+
+	if slot == nil {
+		return booking.ErrSlotNotFound
+	}
+
+	if slot.Start.Before(time.Now()) {
+		return errors.New("el nuevo turno ya paso")
+	}
+
+	if err := s.bookingRepo.UpdateSlot(ctx, existing.ID, slotID); err != nil {
+		if booking.IsSlotError(err) {
+			return err
+		}
+		return errors.New("no fue posible reprogramar la cita")
+	}
+
+	if err := s.bookingRepo.UpdateStatus(ctx, existing.ID, "reprogramado", actor, reason); err != nil {
+		return errors.New("no fue posible cambiar el estado a reprogramado")
+	}
+
+	s.notifySvc.Notify(ctx, existing.ClientID, existing.ID, notification.TypeRescheduled,
+		fmt.Sprintf("La barberia reprogramo tu turno del %s para el %s (%s).", existing.Slot.Start.Format(noticeTimeFormat), slot.Start.Format(noticeTimeFormat), reason))
+
+	return nil
+}
+
+// Devolucion pendiente de registrar y el cobro del proveedor sobre el que se solicita
+type refundRequest struct {
+	entry  *payments.Payment
+	charge *payments.Payment
+}
+
+func refundEntries(refunds []refundRequest) []*payments.Payment {
+	entries := make([]*payments.Payment, 0, len(refunds))
+	for _, r := range refunds {
+		entries = append(entries, r.entry)
+	}
+	return entries
+}
+
+// Arma la devolucion de lo que resta de cada cobro aprobado por Mercado Pago. Lo abonado por otros
+// medios no se puede devolver por el proveedor y se informa para devolverlo a mano
+func pendingRefunds(ledger *payments.Ledger) ([]refundRequest, float64) {
+
+	refunded := make(map[uint]float64)
+	for _, p := range ledger.Payments {
+		if p.Kind == payments.KindRefund && p.RefundOf != nil && p.Status != "rechazado" {
+			refunded[*p.RefundOf] += p.Amount
+		}
+	}
+
+	var (
+		list   []refundRequest
+		manual float64
+	)
+
+	for i := range ledger.Payments {
+		p := &ledger.Payments[i]
+		if p.Kind != payments.KindCharge || p.Status != "aprobado" {
+			continue
+		}
+
+		remaining := math.Round((p.Amount-refunded[p.ID])*100) / 100
+		if remaining <= 0 {
+			continue
+		}
+
+		if !isRefundable(p) {
+			manual += remaining
+			continue
+		}
+
+		entry, err := pendingRefund(p, remaining)
+		if err != nil {
+			continue
+		}
+		list = append(list, refundRequest{entry: entry, charge: p})
+	}
+
+	return list, manual
+}
+
+// Rol con el que se actua sobre la reserva en nombre de la barberia: administrador o el barbero del turno
+func staffActor(b *booking.Booking, userID uint, isAdmin bool) (booking.Actor, error) {
+	switch {
+	case isAdmin:
+		return booking.NewActor(booking.ActorAdmin, userID), nil
+	case b.Slot.BarberID == userID:
+		return booking.NewActor(booking.ActorBarber, userID), nil
+	default:
+		return booking.Actor{}, errors.New("la cita no pertenece al barbero")
+	}
+}
+
+func shopReason(reason, fallback string) string {
+	if reason = strings.TrimSpace(reason); reason == "" {
+		return fallback
+	}
+	return reason
+}
+
+// Genera un cupon para el cliente, reintentando si el codigo ya existe
+func (s *BookingService) issueCoupon(ctx context.Context, clientID uint, percentage int) error {
+	const maxRetries = 5
+	var couponCode string
+	var err error
+
+	for i := range maxRetries {
+		couponCode, err = helpers.GenerateCouponCode(12)
+		if err != nil {
+			log.Println("No fue posible generar el código de 12")
+			return err
+		}
+
+		err = s.couponRepo.Create(ctx, &coupon.Coupon{
+			Code:               couponCode,
+			UserID:             clientID,
+			DiscountPercentage: float64(percentage),
+			ExpireAt:           time.Now().Add(7 * 24 * time.Hour),
+			IsAvailable:        true,
+		})
+		if err == nil {
+			// Éxito, salimos del bucle
+			log.Printf("Cupón creado: %s", couponCode)
+			return nil
+		}
+
+		// Si el error es por duplicado, seguimos intentando
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "UNIQUE") {
+			log.Printf("Código repetido, intentando de nuevo (%d/%d)", i+1, maxRetries)
+			continue
+		}
+
+		// Otro tipo de error
+		log.Printf("Error al crear cupón: %s", err)
+		return err
+	}
+
+	log.Println("No se pudo generar un código único después de varios intentos")
+	return errors.New("no se pudo generar un codigo de cupon unico")
+}
+
+// Historial de cambios de estado de la reserva, visible para el cliente, su barbero o un administrador
+func (s *BookingService) Timeline(ctx context.Context, bookingID, userID uint, isAdmin bool) ([]booking.BookingEvent, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva no puede ser nulo")
+	}
+
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	if _, err := actorFor(existing, userID, isAdmin); err != nil {
+		return nil, err
+	}
+
+	return s.bookingRepo.Events(ctx, bookingID)
+}
+
+// Rol con el que el usuario actua sobre la reserva: cliente si es su reserva, administrador,
+// o barbero si es su turno
+func actorFor(b *booking.Booking, userID uint, isAdmin bool) (booking.Actor, error) {
+	switch {
+	case b.ClientID == userID:
+		return booking.NewActor(booking.ActorClient, userID), nil
+	case isAdmin:
+		return booking.NewActor(booking.ActorAdmin, userID), nil
+	case b.Slot.BarberID == userID:
+		return booking.NewActor(booking.ActorBarber, userID), nil
+	default:
+		return booking.Actor{}, errors.New("la cita no pertenece al usuario")
+	}
+}
+
+// Registro de pagos de la reserva con su saldo pendiente, visible para el cliente, su barbero o un administrador
+func (s *BookingService) Ledger(ctx context.Context, bookingID, userID uint, isAdmin bool) (*payments.Ledger, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva no puede ser nulo")
+	}
+
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	if !isAdmin && existing.ClientID != userID && existing.Slot.BarberID != userID {
+		return nil, errors.New("la cita no pertenece al usuario")
+	}
+
+	return s.paymentRepo.Ledger(ctx, bookingID)
+}
+
+// Solo los cobros aprobados por Mercado Pago se pueden devolver a traves del proveedor
+func isRefundable(payment *payments.Payment) bool {
+	return payment != nil &&
+		payment.Kind != payments.KindRefund &&
+		payment.Method == "mercadopago" &&
+		payment.Status == "aprobado" &&
+		payment.MercadoPagoID != nil && *payment.MercadoPagoID != ""
+}
+
+// Las reservas que se abonan en el local no tienen pago de reserva
+func hasPayment(payment *payments.Payment) bool {
+	return payment != nil && payment.ID != 0
+}
+
+// La reserva solo se considera abonada cuando su cobro fue aprobado, un pago pendiente no cobro nada
+func isPaid(payment *payments.Payment) bool {
+	return hasPayment(payment) && payment.Status == "aprobado"
+}
+
+func refundAmount(refund *payments.Payment) float64 {
+	if refund == nil {
+		return 0
+	}
+	return refund.Amount
+}
+
+// Evalua la politica de cancelacion o reprogramacion para la reserva segun su barbero, servicios y tipo de pago
+func (s *BookingService) evaluatePolicy(ctx context.Context, action string, b *booking.Booking, paymentType string) (*policyDomain.Decision, error) {
+
+	serviceIDs := make([]uint, 0, len(b.BookingServices))
+	for _, bs := range b.BookingServices {
+		serviceIDs = append(serviceIDs, bs.ServiceID)
+	}
+
+	decision, err := s.policySvc.Evaluate(ctx, policyDomain.Subject{
+		Action:      action,
+		BarberID:    b.Slot.BarberID,
+		ServiceIDs:  serviceIDs,
+		PaymentType: paymentType,
+		Start:       b.Slot.Start,
+	})
+	if err != nil {
+		log.Println("[POLICY]", err.Error())
+		return nil, errors.New("no fue posible evaluar la politica de la cita")
+	}
+
+	return decision, nil
 }
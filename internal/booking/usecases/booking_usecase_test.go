@@ -0,0 +1,405 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/notification"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/ezep02/rodeo/internal/booking/domain/waitlist"
+	policyDomain "github.com/ezep02/rodeo/internal/policy/domain"
+	policy "github.com/ezep02/rodeo/internal/policy/usecase"
+)
+
+// Reserva en memoria, registra por que camino se cancelo
+type fakeCancelBookingRepo struct {
+	booking.BookingRepository
+
+	booking     booking.Booking
+	cancelErr   error
+	moveErr     error
+	refunds     []*payments.Payment
+	rescheduled []*payments.Payment
+	slotIDs     []uint
+	calls       []string
+}
+
+func (r *fakeCancelBookingRepo) SlotIDs(ctx context.Context, bookingID uint) ([]uint, error) {
+	return r.slotIDs, nil
+}
+
+func (r *fakeCancelBookingRepo) RescheduleWithCharge(ctx context.Context, bookingID, slotID uint, actor booking.Actor, charge *payments.Payment) error {
+	if r.moveErr != nil {
+		return r.moveErr
+	}
+	r.rescheduled = append(r.rescheduled, charge)
+	return nil
+}
+
+func (r *fakeCancelBookingRepo) GetByID(ctx context.Context, bookingID uint) (*booking.Booking, error) {
+	b := r.booking
+	return &b, nil
+}
+
+func (r *fakeCancelBookingRepo) Cancel(ctx context.Context, bookingID uint, actor booking.Actor, reason string) error {
+	r.calls = append(r.calls, "sin cargo")
+	return nil
+}
+
+func (r *fakeCancelBookingRepo) CancelWithRefund(ctx context.Context, bookingID uint, actor booking.Actor, reason string, refunds ...*payments.Payment) error {
+	if r.cancelErr != nil {
+		return r.cancelErr
+	}
+	r.calls = append(r.calls, "con devolucion")
+	r.refunds = append(r.refunds, refunds...)
+	return nil
+}
+
+type fakeCancelPaymentRepo struct {
+	payments.PaymentRepository
+
+	payment  *payments.Payment
+	refunded []*payments.Payment
+}
+
+func (r *fakeCancelPaymentRepo) GetByProviderID(ctx context.Context, providerPaymentID string) (*payments.Payment, error) {
+	return nil, nil
+}
+
+func (r *fakeCancelPaymentRepo) CreateWithRefund(ctx context.Context, charge, refund *payments.Payment) error {
+	charge.ID = 99
+	refund.RefundOf = &charge.ID
+	r.refunded = append(r.refunded, refund)
+	return nil
+}
+
+func (r *fakeCancelPaymentRepo) MarkAsPaid(ctx context.Context, paymentID uint, mpPaymentID string) error {
+	r.payment.Status = "aprobado"
+	r.payment.MercadoPagoID = &mpPaymentID
+	return nil
+}
+
+func (r *fakeCancelPaymentRepo) GetByBookingID(ctx context.Context, bookingID uint) (*payments.Payment, error) {
+	return r.payment, nil
+}
+
+func (r *fakeCancelPaymentRepo) Ledger(ctx context.Context, bookingID uint) (*payments.Ledger, error) {
+	return &payments.Ledger{BookingID: bookingID, Payments: []payments.Payment{*r.payment}}, nil
+}
+
+func (r *fakeCancelPaymentRepo) Update(ctx context.Context, p *payments.Payment) error {
+	return nil
+}
+
+// Proveedor que registra las devoluciones solicitadas y puede rechazarlas
+// Discrepancias registradas para revision
+type fakeReconRepo struct {
+	created []payments.Discrepancy
+}
+
+func (r *fakeReconRepo) Create(ctx context.Context, d *payments.Discrepancy) (bool, error) {
+	r.created = append(r.created, *d)
+	return true, nil
+}
+
+func (r *fakeReconRepo) List(ctx context.Context, status string, limit int) ([]payments.Discrepancy, error) {
+	return r.created, nil
+}
+
+type fakeRefundGateway struct {
+	payments.Gateway
+
+	fail    bool
+	refunds []string
+}
+
+func (g *fakeRefundGateway) Refund(ctx context.Context, paymentID string, amount float64) (*payments.ProviderRefund, error) {
+	g.refunds = append(g.refunds, paymentID)
+	if g.fail {
+		return nil, errors.New("el proveedor no responde")
+	}
+	return &payments.ProviderRefund{ID: "refund-1", PaymentID: paymentID, Amount: amount, Status: "aprobado"}, nil
+}
+
+type fakeNotificationRepo struct {
+	notification.NotificationRepository
+}
+
+func (fakeNotificationRepo) Create(ctx context.Context, n *notification.Notification) error {
+	return nil
+}
+
+// El turno liberado no se ofrece a nadie
+type fakeIdleWaitlistRepo struct {
+	waitlist.WaitlistRepository
+}
+
+func (fakeIdleWaitlistRepo) GetSlot(ctx context.Context, slotID uint) (*waitlist.Slot, error) {
+	return nil, errors.New("sin turno")
+}
+
+// Registra los turnos que se ofrecen a la lista de espera
+type fakeOfferedWaitlistRepo struct {
+	fakeIdleWaitlistRepo
+
+	offered chan uint
+}
+
+func (r fakeOfferedWaitlistRepo) GetSlot(ctx context.Context, slotID uint) (*waitlist.Slot, error) {
+	r.offered <- slotID
+	return nil, errors.New("sin turno")
+}
+
+func newCancelCase(payment *payments.Payment) (*BookingService, *fakeCancelBookingRepo) {
+	svc, bookingRepo, _ := newCancelCaseWithGateway(payment, &fakeRefundGateway{})
+	return svc, bookingRepo
+}
+
+func newCancelCaseWithGateway(payment *payments.Payment, gateway *fakeRefundGateway) (*BookingService, *fakeCancelBookingRepo, *fakeRefundGateway) {
+
+	start := time.Now().Add(72 * time.Hour)
+	bookingRepo := &fakeCancelBookingRepo{booking: booking.Booking{
+		ID:       10,
+		ClientID: 5,
+		SlotID:   3,
+		Status:   "pendiente_pago",
+		Slot:     booking.Slot{ID: 3, BarberID: 7, Start: start, End: start.Add(30 * time.Minute)},
+	}}
+
+	svc := NewBookingService(
+		bookingRepo,
+		&fakeCancelPaymentRepo{payment: payment},
+		nil,
+		&fakeReconRepo{},
+		gateway,
+		nil,
+		NewWaitlistService(fakeIdleWaitlistRepo{}, DefaultWaitlistHold),
+		policy.NewPolicyService(fakePolicyRepo{}),
+		NewNotificationService(fakeNotificationRepo{}, nil),
+	)
+
+	return svc, bookingRepo, gateway
+}
+
+func approvedCharge() *payments.Payment {
+	mercadoPagoID := "pay-1"
+	return &payments.Payment{ID: 1, BookingID: 10, Amount: 500, Type: "parcial", Method: "mercadopago", Status: "aprobado", Kind: payments.KindCharge, MercadoPagoID: &mercadoPagoID}
+}
+
+// Si la cancelacion falla no se devuelve nada, la cita sigue vigente con su pago
+func TestShopCancelDoesNotRefundWhenCancelFails(t *testing.T) {
+
+	svc, bookingRepo, gateway := newCancelCaseWithGateway(approvedCharge(), &fakeRefundGateway{})
+	bookingRepo.booking.Status = "confirmado"
+	bookingRepo.cancelErr = booking.ErrInvalidTransition
+
+	if err := svc.CancelForSlot(context.Background(), 10, 7, "turno eliminado"); !errors.Is(err, booking.ErrInvalidTransition) {
+		t.Fatalf("se esperaba ErrInvalidTransition, se obtuvo %v", err)
+	}
+
+	if len(gateway.refunds) != 0 {
+		t.Fatalf("no deberia solicitarse ninguna devolucion, se solicitaron %v", gateway.refunds)
+	}
+}
+
+// La devolucion se registra con la cancelacion y luego se solicita, si el proveedor falla queda pendiente
+func TestShopCancelRecordsRefundsWithCancel(t *testing.T) {
+
+	for _, fail := range []bool{false, true} {
+		svc, bookingRepo, gateway := newCancelCaseWithGateway(approvedCharge(), &fakeRefundGateway{fail: fail})
+		bookingRepo.booking.Status = "confirmado"
+
+		if err := svc.CancelForSlot(context.Background(), 10, 7, "turno eliminado"); err != nil {
+			t.Fatalf("proveedor fallando %v: %v", fail, err)
+		}
+
+		if len(bookingRepo.refunds) != 1 || bookingRepo.refunds[0].Amount != 500 || bookingRepo.refunds[0].Status != "pendiente" {
+			t.Fatalf("la cancelacion deberia registrar la devolucion pendiente de 500, se obtuvo %+v", bookingRepo.refunds)
+		}
+
+		if len(gateway.refunds) != 1 || gateway.refunds[0] != "pay-1" {
+			t.Fatalf("se esperaba solicitar la devolucion del pago pay-1, se obtuvo %v", gateway.refunds)
+		}
+	}
+}
+
+func TestCancelWithoutApprovedChargeIsFree(t *testing.T) {
+
+	mercadoPagoID := "pay-1"
+	cases := map[string]*payments.Payment{
+		"sin pago":                  nil,
+		"checkout sin completar":    {ID: 1, Amount: 500, Type: "parcial", Method: "mercadopago", Status: "pendiente"},
+		"pago rechazado":            {ID: 1, Amount: 500, Type: "parcial", Method: "mercadopago", Status: "rechazado", MercadoPagoID: &mercadoPagoID},
+		"transferencia sin aprobar": {ID: 1, Amount: 1000, Type: "total", Method: "transferencia", Status: "pendiente"},
+	}
+
+	for name, payment := range cases {
+		svc, bookingRepo := newCancelCase(payment)
+
+		preview, err := svc.CalculateCancelationConsequences(context.Background(), 10)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if preview.Outcome != policyDomain.OutcomeFree || preview.RequiresCoupon || preview.RequiresRefund {
+			t.Fatalf("%s: la vista previa deberia ser sin cargo, se obtuvo %+v", name, preview)
+		}
+
+		res, err := svc.CancelBooking(context.Background(), 10, 5, false, "")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if res.RequiresCoupon || res.RequiresRefund || len(bookingRepo.calls) != 1 || bookingRepo.calls[0] != "sin cargo" {
+			t.Fatalf("%s: se esperaba una cancelacion sin cargo, se obtuvo %v (%+v)", name, bookingRepo.calls, res)
+		}
+	}
+}
+
+func TestIsPaid(t *testing.T) {
+
+	cases := map[string]struct {
+		payment *payments.Payment
+		want    bool
+	}{
+		"sin pago":  {nil, false},
+		"sin id":    {&payments.Payment{Status: "aprobado"}, false},
+		"pendiente": {&payments.Payment{ID: 1, Status: "pendiente"}, false},
+		"aprobado":  {&payments.Payment{ID: 1, Status: "aprobado"}, true},
+	}
+
+	for name, tc := range cases {
+		if got := isPaid(tc.payment); got != tc.want {
+			t.Errorf("%s: se esperaba %v, se obtuvo %v", name, tc.want, got)
+		}
+	}
+}
+
+func paidSurcharge() *payments.ProviderPayment {
+	now := time.Now()
+	return &payments.ProviderPayment{ID: "pay-surcharge", Status: "aprobado", Amount: 150, PaidAt: &now}
+}
+
+func TestRescheduleWithSurchargeMovesAndRecordsTogether(t *testing.T) {
+
+	svc, bookingRepo, gateway := newCancelCaseWithGateway(approvedCharge(), &fakeRefundGateway{})
+	bookingRepo.booking.Status = "confirmado"
+
+	if err := svc.RescheduleWithSurcharge(context.Background(), 10, 4, paidSurcharge()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bookingRepo.rescheduled) != 1 || bookingRepo.rescheduled[0].Amount != 150 || bookingRepo.rescheduled[0].Concept != payments.ConceptSurcharge {
+		t.Fatalf("el recargo deberia registrarse con la reprogramacion, se obtuvo %+v", bookingRepo.rescheduled)
+	}
+
+	if len(gateway.refunds) != 0 {
+		t.Fatalf("no deberia devolverse el recargo, se solicitaron %v", gateway.refunds)
+	}
+}
+
+// El turno nuevo se ocupo mientras se pagaba el recargo: la cita no se mueve y el recargo se devuelve
+func TestRescheduleWithSurchargeRefundsWhenSlotTaken(t *testing.T) {
+
+	svc, bookingRepo, gateway := newCancelCaseWithGateway(approvedCharge(), &fakeRefundGateway{})
+	bookingRepo.booking.Status = "confirmado"
+	bookingRepo.moveErr = booking.ErrSlotTaken
+
+	if err := svc.RescheduleWithSurcharge(context.Background(), 10, 4, paidSurcharge()); err != nil {
+		t.Fatalf("la notificacion no deberia reintentarse, se obtuvo %v", err)
+	}
+
+	paymentRepo := svc.paymentRepo.(*fakeCancelPaymentRepo)
+	if len(paymentRepo.refunded) != 1 || paymentRepo.refunded[0].Amount != 150 || *paymentRepo.refunded[0].RefundOf != 99 {
+		t.Fatalf("se esperaba la devolucion pendiente del recargo, se obtuvo %+v", paymentRepo.refunded)
+	}
+
+	if len(gateway.refunds) != 1 || gateway.refunds[0] != "pay-surcharge" {
+		t.Fatalf("se esperaba solicitar la devolucion del recargo, se obtuvo %v", gateway.refunds)
+	}
+}
+
+// El pago de un grupo llega cuando la reserva ya fue cancelada: el cobro queda registrado para revision
+func TestMarkCoveredAsPaidReportsInactiveBooking(t *testing.T) {
+
+	pending := &payments.Payment{ID: 1, BookingID: 10, Amount: 500, Type: "total", Method: "mercadopago", Status: "pendiente", Kind: payments.KindCharge}
+	svc, bookingRepo, _ := newCancelCaseWithGateway(pending, &fakeRefundGateway{})
+	bookingRepo.booking.Status = "cancelado"
+
+	info := &payments.ProviderPayment{ID: "pay-group", Status: "aprobado", Amount: 500}
+	if err := svc.markCoveredAsPaid(context.Background(), []booking.Booking{bookingRepo.booking}, info); err != nil {
+		t.Fatalf("la notificacion no deberia reintentarse, se obtuvo %v", err)
+	}
+
+	recon := svc.reconRepo.(*fakeReconRepo)
+	if len(recon.created) != 1 {
+		t.Fatalf("se esperaba una discrepancia, se obtuvo %+v", recon.created)
+	}
+
+	got := recon.created[0]
+	if got.Type != payments.DiscrepancyCanceled || got.Status != "revision" || got.BookingID != 10 || got.ProviderID != "pay-group" {
+		t.Fatalf("discrepancia inesperada %+v", got)
+	}
+}
+
+// Cancelar una reserva de varios servicios ofrece todos sus turnos, no solo el inicial
+func TestCancelOffersEveryBookingSlot(t *testing.T) {
+
+	svc, bookingRepo := newCancelCase(nil)
+	bookingRepo.slotIDs = []uint{3, 4, 5}
+
+	offered := make(chan uint, 3)
+	svc.waitlistSvc = NewWaitlistService(fakeOfferedWaitlistRepo{offered: offered}, DefaultWaitlistHold)
+
+	if _, err := svc.CancelBooking(context.Background(), 10, 5, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range bookingRepo.slotIDs {
+		select {
+		case got := <-offered:
+			if got != want {
+				t.Fatalf("se esperaba ofrecer el turno %d, se ofrecio %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("el turno %d no se ofrecio a la lista de espera", want)
+		}
+	}
+}
+
+// Registra el checkout pedido al proveedor
+type fakeCheckoutGateway struct {
+	payments.Gateway
+
+	req payments.CheckoutRequest
+}
+
+func (g *fakeCheckoutGateway) CreateCheckout(ctx context.Context, req payments.CheckoutRequest) (*payments.Checkout, error) {
+	g.req = req
+	return &payments.Checkout{ID: "pref-1", InitPoint: "http://localhost/pay/pref-1"}, nil
+}
+
+// El checkout del recargo se identifica en el proveedor y vence como el de una reserva
+func TestReschedulePrefHasReferenceAndExpiry(t *testing.T) {
+
+	t.Setenv("NGROK_URL", "http://localhost")
+
+	svc, bookingRepo, _ := newCancelCaseWithGateway(approvedCharge(), &fakeRefundGateway{})
+	gateway := &fakeCheckoutGateway{}
+	svc.gateway = gateway
+
+	if _, err := svc.CreateReschedulePref(context.Background(), bookingRepo.booking, *approvedCharge(), 4, 150); err != nil {
+		t.Fatal(err)
+	}
+
+	if gateway.req.ExternalReference != payments.RescheduleReference(10, 4) {
+		t.Fatalf("referencia externa inesperada %q", gateway.req.ExternalReference)
+	}
+
+	if gateway.req.ExpiresAt == nil || gateway.req.ExpiresAt.After(time.Now().Add(DefaultBookingExpiry)) {
+		t.Fatalf("el checkout deberia vencer dentro de %s, vence %v", DefaultBookingExpiry, gateway.req.ExpiresAt)
+	}
+}
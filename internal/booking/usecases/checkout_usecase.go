@@ -0,0 +1,429 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/ezep02/rodeo/internal/booking/domain/services"
+	"github.com/ezep02/rodeo/internal/booking/helpers"
+	policyDomain "github.com/ezep02/rodeo/internal/policy/domain"
+	policy "github.com/ezep02/rodeo/internal/policy/usecase"
+	pricingDomain "github.com/ezep02/rodeo/internal/pricing/domain"
+	pricing "github.com/ezep02/rodeo/internal/pricing/usecase"
+)
+
+// Tiempo por defecto para completar el pago por Mercado Pago antes de que la reserva venza
+const DefaultBookingExpiry = 5 * time.Minute
+
+// Porcentaje del total que se abona como seña
+const DepositPercentage = 50
+
+// Personas que se pueden reservar en un checkout grupal
+const maxGroupAttendees = 6
+
+type CheckoutService struct {
+	checkoutRepo booking.CheckoutRepository
+	bookingRepo  booking.BookingRepository
+	pricingSvc   *pricing.PricingService
+	couponSvc    *CouponService
+	policySvc    *policy.PolicyService
+	expiry       time.Duration
+}
+
+func NewCheckoutService(
+	checkoutRepo booking.CheckoutRepository,
+	bookingRepo booking.BookingRepository,
+	pricingSvc *pricing.PricingService,
+	couponSvc *CouponService,
+	policySvc *policy.PolicyService,
+	expiry time.Duration,
+) *CheckoutService {
+	if expiry <= 0 {
+		expiry = DefaultBookingExpiry
+	}
+	return &CheckoutService{checkoutRepo, bookingRepo, pricingSvc, couponSvc, policySvc, expiry}
+}
+
+// Datos enviados por el cliente para reservar un turno
+type CheckoutRequest struct {
+	SlotID            uint   `json:"slot_id"`
+	ServicesID        []uint `json:"services_id"`
+	PaymentPercentage int64  `json:"payment_percentage"` // 50 para seña, 100 para total
+	CouponCode        string `json:"coupon_code"`
+	Method            string `json:"method"` // mercadopago o transferencia
+}
+
+// Crea la reserva, el pago y los servicios seleccionados de forma atomica
+func (s *CheckoutService) Checkout(ctx context.Context, req CheckoutRequest, clientID uint) (*booking.Checkout, error) {
+
+	if req.Method != "mercadopago" && req.Method != "transferencia" {
+		return nil, errors.New("metodo de pago invalido")
+	}
+
+	// 1. Validar la solicitud y cotizar los servicios con las promociones vigentes y el cupon
+	quote, couponCode, err := s.price(ctx, req, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Los clientes con ausencias previas deben abonar el total
+	if req.PaymentPercentage < 100 && s.requiresPrepayment(ctx, clientID) {
+		return nil, booking.ErrPrepaymentRequired
+	}
+
+	// 2. Armar booking, payment y servicios
+	checkout := s.newCheckout(req, quote, couponCode, clientID)
+
+	// 3. Persistir todo en una transaccion
+	if err := s.checkoutRepo.Create(ctx, checkout); err != nil {
+		if booking.IsSlotError(err) {
+			return nil, err
+		}
+		return nil, errors.New("no fue posible crear la reserva")
+	}
+
+	return checkout, nil
+}
+
+// Datos de cada persona de una reserva grupal
+type GroupAttendee struct {
+	Name       string `json:"name"`
+	SlotID     uint   `json:"slot_id"`
+	ServicesID []uint `json:"services_id"`
+}
+
+// Reserva de varias personas, cada una con sus servicios y su turno, abonada en un unico checkout
+type GroupCheckoutRequest struct {
+	Attendees         []GroupAttendee `json:"attendees"`
+	PaymentPercentage int64           `json:"payment_percentage"` // 50 para seña, 100 para total
+}
+
+// Crea el grupo y la reserva, el pago y los servicios de cada asistente de forma atomica.
+// Los turnos pueden ser simultaneos con distintos barberos o consecutivos; si alguno no esta libre no se reserva ninguno
+func (s *CheckoutService) GroupCheckout(ctx context.Context, req GroupCheckoutRequest, clientID uint) (*booking.GroupCheckout, error) {
+
+	if len(req.Attendees) < 2 || len(req.Attendees) > maxGroupAttendees {
+		return nil, fmt.Errorf("la reserva grupal debe tener entre 2 y %d personas", maxGroupAttendees)
+	}
+
+	// Los clientes con ausencias previas deben abonar el total
+	if req.PaymentPercentage < 100 && s.requiresPrepayment(ctx, clientID) {
+		return nil, booking.ErrPrepaymentRequired
+	}
+
+	// 1. Validar y cotizar cada asistente
+	checkouts := make([]*booking.Checkout, 0, len(req.Attendees))
+	seen := make(map[uint]bool, len(req.Attendees))
+
+	for _, attendee := range req.Attendees {
+		name := strings.TrimSpace(attendee.Name)
+		if name == "" {
+			return nil, errors.New("cada persona de la reserva debe tener un nombre")
+		}
+
+		if seen[attendee.SlotID] {
+			return nil, errors.New("cada persona de la reserva debe tener su propio turno")
+		}
+		seen[attendee.SlotID] = true
+
+		attendeeReq := CheckoutRequest{
+			SlotID:            attendee.SlotID,
+			ServicesID:        attendee.ServicesID,
+			PaymentPercentage: req.PaymentPercentage,
+			Method:            "mercadopago",
+		}
+
+		quote, _, err := s.price(ctx, attendeeReq, clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		checkout := s.newCheckout(attendeeReq, quote, nil, clientID)
+		checkout.Booking.AttendeeName = name
+		checkouts = append(checkouts, checkout)
+	}
+
+	// 2. Todas las reservas vencen juntas, se abonan con el mismo checkout
+	expiresAt := time.Now().Add(s.expiry)
+	group := &booking.GroupCheckout{
+		Group:     &booking.BookingGroup{ClientID: clientID},
+		Attendees: checkouts,
+	}
+
+	for _, checkout := range checkouts {
+		checkout.Booking.ExpiresAt = &expiresAt
+		group.AmountDue += checkout.Payment.Amount
+	}
+
+	// 3. Persistir todo en una transaccion
+	if err := s.checkoutRepo.CreateGroup(ctx, group.Group, checkouts); err != nil {
+		if booking.IsSlotError(err) {
+			return nil, err
+		}
+		return nil, errors.New("no fue posible crear la reserva grupal")
+	}
+
+	return group, nil
+}
+
+func (s *CheckoutService) SetGroupCheckout(ctx context.Context, groupID uint, checkout *payments.Checkout) error {
+	return s.checkoutRepo.SetGroupCheckout(ctx, groupID, checkout)
+}
+
+// Deja sin efecto las reservas de un checkout cuyo pago no pudo crearse en el proveedor: vencen en el
+// momento y sus turnos quedan libres sin esperar al job de vencimiento
+func (s *CheckoutService) Abort(ctx context.Context, bookingIDs []uint, reason string) {
+	for _, id := range bookingIDs {
+		if err := s.bookingRepo.UpdateStatus(ctx, id, "expirado", booking.SystemActor(), reason); err != nil {
+			log.Printf("[CHECKOUT] no fue posible dejar sin efecto la reserva %d, vencera con el job: %s", id, err)
+		}
+	}
+}
+
+// Arma la reserva, su pago (seña o total) y sus servicios a partir de la cotizacion
+func (s *CheckoutService) newCheckout(req CheckoutRequest, quote *pricingDomain.Quote, couponCode *string, clientID uint) *booking.Checkout {
+
+	bookingServices := make([]services.BookingServices, 0, len(quote.Items))
+	for _, item := range quote.Items {
+		bookingServices = append(bookingServices, services.BookingServices{
+			ServiceID: uint(item.ServiceID),
+		})
+	}
+
+	totalAmount := quote.Total
+	discountAmount := quote.PromoDiscount + quote.CouponDiscount
+
+	// Los pagos por Mercado Pago expiran si no se completan
+	newBooking := &booking.Booking{
+		SlotID:         req.SlotID,
+		ClientID:       clientID,
+		Status:         "pendiente_pago",
+		TotalAmount:    totalAmount,
+		CouponCode:     couponCode,
+		DiscountAmount: discountAmount,
+	}
+
+	if req.Method == "mercadopago" {
+		expiresAt := time.Now().Add(s.expiry)
+		newBooking.ExpiresAt = &expiresAt
+	}
+
+	// Seña o total
+	paymentAmount, paymentType := paymentSplit(totalAmount, req.PaymentPercentage)
+
+	return &booking.Checkout{
+		Booking: newBooking,
+		Payment: &payments.Payment{
+			Amount: paymentAmount,
+			Type:   paymentType,
+			Method: req.Method,
+			Status: "pendiente",
+		},
+		Services: bookingServices,
+		Duration: quote.Duration,
+		Quote:    quote,
+	}
+}
+
+// Cotiza una reserva sin crear nada: precios, seña o total y la politica de cancelacion y reprogramacion
+func (s *CheckoutService) Quote(ctx context.Context, req CheckoutRequest, clientID uint) (*booking.QuoteResponse, error) {
+
+	// Sin metodo se cotiza el pago por el proveedor
+	if req.Method == "" {
+		req.Method = "mercadopago"
+	}
+
+	if req.Method != "mercadopago" && req.Method != "transferencia" {
+		return nil, errors.New("metodo de pago invalido")
+	}
+
+	// 1. Validar la solicitud y cotizar los servicios
+	quote, _, err := s.price(ctx, req, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Recuperar el turno y su disponibilidad
+	slot, err := s.bookingRepo.GetSlot(ctx, req.SlotID)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar el turno")
+	}
+
+	if slot == nil {
+		return nil, booking.ErrSlotNotFound
+	}
+
+	// Mismas verificaciones que el checkout (turnos consecutivos, ausencias, ofertas de la lista de espera) sin bloquear
+	available := true
+	if err := s.checkoutRepo.CheckAvailability(ctx, req.SlotID, quote.Duration, clientID); err != nil {
+		if !booking.IsSlotError(err) {
+			return nil, errors.New("no fue posible verificar el turno")
+		}
+		available = false
+	}
+
+	// 3. Calcular seña y total, los clientes con ausencias previas deben abonar el total y no tienen seña
+	prepayment := s.requiresPrepayment(ctx, clientID)
+	if prepayment {
+		req.PaymentPercentage = 100
+	}
+
+	amountDue, paymentType := paymentSplit(quote.Total, req.PaymentPercentage)
+
+	var deposit float64
+	switch {
+	case prepayment:
+	case paymentType == "parcial":
+		deposit = amountDue
+	default:
+		deposit = pricing.Percentage(quote.Total, DepositPercentage)
+	}
+
+	promos := make([]pricingDomain.Promotion, 0)
+	for _, item := range quote.Items {
+		if item.Promotion != nil {
+			promos = append(promos, *item.Promotion)
+		}
+	}
+
+	// 4. Politica que aplicaria si la reserva se confirmara ahora
+	subject := policyDomain.Subject{
+		Action:      policyDomain.ActionCancel,
+		BarberID:    slot.BarberID,
+		ServiceIDs:  req.ServicesID,
+		PaymentType: paymentType,
+		Start:       slot.Start,
+	}
+
+	cancelation, err := s.policySvc.Evaluate(ctx, subject)
+	if err != nil {
+		return nil, errors.New("no fue posible evaluar la politica de cancelacion")
+	}
+
+	subject.Action = policyDomain.ActionReschedule
+	rescheduleDecision, err := s.policySvc.Evaluate(ctx, subject)
+	if err != nil {
+		return nil, errors.New("no fue posible evaluar la politica de reprogramacion")
+	}
+
+	// Los pagos por transferencia no se pueden devolver por el proveedor
+	cancelationPolicy := helpers.CalculateConsequences(cancelation, req.Method != "transferencia")
+	if cancelationPolicy.RequiresRefund {
+		cancelationPolicy.RefundAmount = pricing.Percentage(amountDue, float64(cancelationPolicy.RefundPercent))
+	}
+
+	reschedule := &booking.ReschedulePolicy{
+		Free:    true,
+		Message: rescheduleDecision.Message,
+	}
+
+	if rescheduleDecision.Outcome == policyDomain.OutcomeSurcharge && rescheduleDecision.Percentage > 0 {
+		reschedule.Free = false
+		reschedule.SurchargePercentage = rescheduleDecision.Percentage
+		reschedule.SurchargeAmount = pricing.Percentage(amountDue, float64(reschedule.SurchargePercentage))
+	}
+
+	return &booking.QuoteResponse{
+		Slot:        *slot,
+		Available:   available,
+		Quote:       quote,
+		Promotions:  promos,
+		PaymentType: paymentType,
+		AmountDue:   amountDue,
+		Deposit:     deposit,
+		FullAmount:  quote.Total,
+		Prepayment:  prepayment,
+		Cancelation: cancelationPolicy,
+		Reschedule:  reschedule,
+	}, nil
+}
+
+// Valida la solicitud, el cupon y cotiza los servicios. El cupon se marca como usado recien cuando se aprueba el pago
+func (s *CheckoutService) price(ctx context.Context, req CheckoutRequest, clientID uint) (*pricingDomain.Quote, *string, error) {
+
+	if clientID == 0 {
+		return nil, nil, errors.New("el id del cliente es necesario")
+	}
+
+	if req.SlotID == 0 {
+		return nil, nil, errors.New("el id del turno es necesario")
+	}
+
+	if len(req.ServicesID) == 0 {
+		return nil, nil, errors.New("debe seleccionar al menos un servicio")
+	}
+
+	if req.PaymentPercentage <= 0 || req.PaymentPercentage > 100 {
+		return nil, nil, errors.New("el porcentaje de pago debe estar entre 1 y 100")
+	}
+
+	var (
+		couponCode       *string
+		couponPercentage float64
+	)
+
+	if req.CouponCode != "" {
+		validCoupon, err := s.couponSvc.ValidateForUser(ctx, req.CouponCode, clientID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		couponPercentage = validCoupon.DiscountPercentage
+		couponCode = &validCoupon.Code
+	}
+
+	quote, err := s.pricingSvc.Quote(ctx, uniqueIDs(req.ServicesID), time.Now(), couponPercentage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return quote, couponCode, nil
+}
+
+// Indica si el cliente alcanzo las ausencias que exigen el pago total segun la politica de ausencias.
+// Si no se pueden contar no se le exige, la reserva sigue su curso normal
+func (s *CheckoutService) requiresPrepayment(ctx context.Context, clientID uint) bool {
+
+	noShow := s.policySvc.NoShow(ctx)
+	if noShow.PrepayAfter <= 0 {
+		return false
+	}
+
+	count, err := s.bookingRepo.CountNoShows(ctx, clientID, noShow.Since(time.Now()))
+	if err != nil {
+		log.Println("[CHECKOUT] error contando ausencias del cliente:", err)
+		return false
+	}
+
+	return count >= int64(noShow.PrepayAfter)
+}
+
+// Monto a cobrar y tipo de pago (seña o total) segun el porcentaje elegido
+func paymentSplit(total float64, percentage int64) (float64, string) {
+	if percentage < 100 {
+		return pricing.Percentage(total, float64(percentage)), "parcial"
+	}
+	return total, "total"
+}
+
+// Elimina ids repetidos manteniendo el orden
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+
+	return out
+}
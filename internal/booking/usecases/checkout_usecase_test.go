@@ -0,0 +1,199 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	policyDomain "github.com/ezep02/rodeo/internal/policy/domain"
+	policy "github.com/ezep02/rodeo/internal/policy/usecase"
+	pricingDomain "github.com/ezep02/rodeo/internal/pricing/domain"
+	pricing "github.com/ezep02/rodeo/internal/pricing/usecase"
+)
+
+// Un unico servicio de 1000 sin promociones
+type fakePricingRepo struct{}
+
+func (fakePricingRepo) ServicesByIDs(ctx context.Context, ids []uint) ([]pricingDomain.Service, error) {
+	return []pricingDomain.Service{{ID: 1, Name: "Corte", Price: 1000, Duration: 30}}, nil
+}
+
+func (fakePricingRepo) ActivePromotions(ctx context.Context, serviceIDs []uint, at time.Time) ([]pricingDomain.Promotion, error) {
+	return nil, nil
+}
+
+// Sin reglas configuradas, se aplica la politica por defecto
+type fakePolicyRepo struct {
+	policyDomain.PolicyRepository
+}
+
+func (fakePolicyRepo) ActiveByAction(ctx context.Context, action string) ([]policyDomain.PolicyRule, error) {
+	return nil, nil
+}
+
+func (fakePolicyRepo) GetNoShow(ctx context.Context) (*policyDomain.NoShowPolicy, error) {
+	return &policyDomain.NoShowPolicy{Outcome: policyDomain.OutcomeForfeitDeposit, PrepayAfter: 2}, nil
+}
+
+type fakeQuoteBookingRepo struct {
+	booking.BookingRepository
+
+	noShows int64
+}
+
+func (r *fakeQuoteBookingRepo) GetSlot(ctx context.Context, slotID uint) (*booking.Slot, error) {
+	start := time.Now().Add(72 * time.Hour)
+	return &booking.Slot{ID: slotID, BarberID: 7, Start: start, End: start.Add(30 * time.Minute)}, nil
+}
+
+func (r *fakeQuoteBookingRepo) CountNoShows(ctx context.Context, clientID uint, since time.Time) (int64, error) {
+	return r.noShows, nil
+}
+
+// Registra si la verificacion de disponibilidad recibio la duracion cotizada
+type fakeQuoteCheckoutRepo struct {
+	booking.CheckoutRepository
+
+	err      error
+	duration int
+}
+
+func (r *fakeQuoteCheckoutRepo) CheckAvailability(ctx context.Context, slotID uint, duration int, clientID uint) error {
+	r.duration = duration
+	return r.err
+}
+
+func newQuoteCase(noShows int64, availability error) (*CheckoutService, *fakeQuoteCheckoutRepo) {
+
+	checkoutRepo := &fakeQuoteCheckoutRepo{err: availability}
+	svc := NewCheckoutService(
+		checkoutRepo,
+		&fakeQuoteBookingRepo{noShows: noShows},
+		pricing.NewPricingService(fakePricingRepo{}),
+		nil,
+		policy.NewPolicyService(fakePolicyRepo{}),
+		0,
+	)
+
+	return svc, checkoutRepo
+}
+
+func quoteRequest(percentage int64) CheckoutRequest {
+	return CheckoutRequest{SlotID: 3, ServicesID: []uint{1}, PaymentPercentage: percentage, Method: "mercadopago"}
+}
+
+func TestQuoteDepositUsesDepositPercentage(t *testing.T) {
+
+	svc, _ := newQuoteCase(0, nil)
+
+	res, err := svc.Quote(context.Background(), quoteRequest(100), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := pricing.Percentage(1000, DepositPercentage); res.Deposit != want {
+		t.Fatalf("se esperaba una seña de %v, se obtuvo %v", want, res.Deposit)
+	}
+
+	if res.AmountDue != 1000 || res.PaymentType != "total" {
+		t.Fatalf("se esperaba abonar el total, se obtuvo %v (%s)", res.AmountDue, res.PaymentType)
+	}
+}
+
+func TestQuoteWithoutDepositWhenPrepaymentRequired(t *testing.T) {
+
+	svc, _ := newQuoteCase(2, nil)
+
+	res, err := svc.Quote(context.Background(), quoteRequest(50), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Prepayment || res.PaymentType != "total" || res.AmountDue != 1000 {
+		t.Fatalf("se esperaba el pago total por ausencias previas, se obtuvo %+v", res)
+	}
+
+	if res.Deposit != 0 {
+		t.Fatalf("no deberia ofrecerse seña, se obtuvo %v", res.Deposit)
+	}
+}
+
+func TestQuoteAvailabilityUsesCheckoutChecks(t *testing.T) {
+
+	for _, err := range []error{booking.ErrSlotTaken, booking.ErrSlotTooShort, booking.ErrSlotUnavailable} {
+		svc, checkoutRepo := newQuoteCase(0, err)
+
+		res, qerr := svc.Quote(context.Background(), quoteRequest(50), 5)
+		if qerr != nil {
+			t.Fatal(qerr)
+		}
+
+		if res.Available {
+			t.Fatalf("%v: el turno no deberia informarse disponible", err)
+		}
+
+		if checkoutRepo.duration != 30 {
+			t.Fatalf("la disponibilidad deberia verificarse con la duracion cotizada, se uso %d", checkoutRepo.duration)
+		}
+	}
+
+	svc, _ := newQuoteCase(0, nil)
+	res, err := svc.Quote(context.Background(), quoteRequest(50), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Available || res.Deposit != 500 {
+		t.Fatalf("se esperaba el turno disponible con una seña de 500, se obtuvo %+v", res)
+	}
+}
+
+// Las cancelaciones con anticipacion devuelven todo lo abonado
+type fakeRefundPolicyRepo struct {
+	fakePolicyRepo
+}
+
+func (fakeRefundPolicyRepo) ActiveByAction(ctx context.Context, action string) ([]policyDomain.PolicyRule, error) {
+	if action != policyDomain.ActionCancel {
+		return nil, nil
+	}
+	return []policyDomain.PolicyRule{{ID: 1, Action: action, Outcome: policyDomain.OutcomeRefund, Percentage: 100}}, nil
+}
+
+// La cotizacion anticipa la devolucion solo si el pago puede devolverse por el proveedor
+func TestQuoteCancelationDependsOnMethod(t *testing.T) {
+
+	cases := []struct {
+		method string
+		refund bool
+	}{
+		{"", true},
+		{"mercadopago", true},
+		{"transferencia", false},
+	}
+
+	for _, tc := range cases {
+		svc, _ := newQuoteCase(0, nil)
+		svc.policySvc = policy.NewPolicyService(fakeRefundPolicyRepo{})
+
+		req := quoteRequest(100)
+		req.Method = tc.method
+
+		res, err := svc.Quote(context.Background(), req, 5)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.method, err)
+		}
+
+		if res.Cancelation.RequiresRefund != tc.refund || res.Cancelation.RequiresCoupon == tc.refund {
+			t.Fatalf("%q: se esperaba devolucion %v, se obtuvo %+v", tc.method, tc.refund, res.Cancelation)
+		}
+	}
+
+	svc, _ := newQuoteCase(0, nil)
+	req := quoteRequest(100)
+	req.Method = "efectivo"
+	if _, err := svc.Quote(context.Background(), req, 5); err == nil {
+		t.Fatal("se esperaba rechazar un metodo de pago invalido")
+	}
+}
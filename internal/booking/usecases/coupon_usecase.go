@@ -3,6 +3,7 @@ package usecases
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/domain/coupon"
 )
@@ -30,6 +31,47 @@ func (s *CouponService) GetCouponByCode(ctx context.Context, code string) (*coup
 	return s.couponRepo.GetByCode(ctx, code)
 }
 
+// Verifica que el cupon exista, pertenezca al usuario, este disponible y no haya expirado
+func (s *CouponService) ValidateForUser(ctx context.Context, code string, userID uint) (*coupon.Coupon, error) {
+
+	existing, err := s.GetCouponByCode(ctx, code)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar el cupón")
+	}
+
+	if existing == nil {
+		return nil, errors.New("el cupón no existe")
+	}
+
+	if existing.UserID != userID {
+		return nil, errors.New("el cupón no pertenece al usuario")
+	}
+
+	if !existing.IsAvailable {
+		return nil, coupon.ErrCouponUnavailable
+	}
+
+	if !existing.ExpireAt.IsZero() && time.Now().After(existing.ExpireAt) {
+		return nil, errors.New("el cupón expiró")
+	}
+
+	if existing.DiscountPercentage <= 0 || existing.DiscountPercentage > 100 {
+		return nil, errors.New("el cupón tiene un descuento invalido")
+	}
+
+	// El cupon se canjea al aprobarse el pago, mientras tanto queda retenido por la reserva pendiente
+	held, err := s.couponRepo.HeldByPendingBooking(ctx, code)
+	if err != nil {
+		return nil, errors.New("no fue posible verificar el cupón")
+	}
+
+	if held {
+		return nil, coupon.ErrCouponInUse
+	}
+
+	return existing, nil
+}
+
 func (s *CouponService) GetCouponsByUserID(ctx context.Context, userID uint) ([]coupon.Coupon, error) {
 	if userID == 0 {
 		return nil, errors.New("userID no puede ser cero")
@@ -41,5 +83,5 @@ func (s *CouponService) MarkCouponAsUsed(ctx context.Context, code string) error
 	if code == "" {
 		return errors.New("code no puede ser vacío")
 	}
-	return s.couponRepo.UpdateStatus(ctx, code)
+	return s.couponRepo.Redeem(ctx, code)
 }
@@ -0,0 +1,62 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/coupon"
+)
+
+// Repositorio en memoria con un unico cupon
+type fakeCouponRepo struct {
+	coupon.CouponRepository
+
+	coupon coupon.Coupon
+	held   bool
+}
+
+func (r *fakeCouponRepo) GetByCode(ctx context.Context, code string) (*coupon.Coupon, error) {
+	c := r.coupon
+	return &c, nil
+}
+
+func (r *fakeCouponRepo) HeldByPendingBooking(ctx context.Context, code string) (bool, error) {
+	return r.held, nil
+}
+
+func newCouponCase(available, held bool) *CouponService {
+	return NewCouponService(&fakeCouponRepo{
+		coupon: coupon.Coupon{Code: "ABC123", UserID: 5, DiscountPercentage: 20, IsAvailable: available, ExpireAt: time.Now().Add(24 * time.Hour)},
+		held:   held,
+	})
+}
+
+func TestValidateForUserRejectsRedeemedCoupon(t *testing.T) {
+
+	_, err := newCouponCase(false, false).ValidateForUser(context.Background(), "ABC123", 5)
+	if !errors.Is(err, coupon.ErrCouponUnavailable) {
+		t.Fatalf("se esperaba ErrCouponUnavailable, se obtuvo %v", err)
+	}
+}
+
+func TestValidateForUserRejectsCouponHeldByPendingBooking(t *testing.T) {
+
+	_, err := newCouponCase(true, true).ValidateForUser(context.Background(), "ABC123", 5)
+	if !errors.Is(err, coupon.ErrCouponInUse) {
+		t.Fatalf("se esperaba ErrCouponInUse, se obtuvo %v", err)
+	}
+}
+
+func TestValidateForUserAcceptsFreeCoupon(t *testing.T) {
+
+	c, err := newCouponCase(true, false).ValidateForUser(context.Background(), "ABC123", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.DiscountPercentage != 20 {
+		t.Fatalf("se esperaba un descuento de 20, se obtuvo %v", c.DiscountPercentage)
+	}
+}
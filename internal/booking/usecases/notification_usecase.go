@@ -0,0 +1,71 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/notification"
+)
+
+// Cantidad de notificaciones devueltas al cliente
+const notificationsLimit = 50
+
+type NotificationService struct {
+	notificationRepo notification.NotificationRepository
+	publisher        notification.Publisher
+}
+
+func NewNotificationService(notificationRepo notification.NotificationRepository, publisher notification.Publisher) *NotificationService {
+	return &NotificationService{notificationRepo, publisher}
+}
+
+// Guarda el aviso para el cliente y avisa por el canal en vivo que tiene notificaciones nuevas.
+// El canal llega a todos los conectados, por eso solo lleva el id del usuario y no el contenido
+func (s *NotificationService) Notify(ctx context.Context, userID, bookingID uint, kind, message string) {
+
+	n := &notification.Notification{
+		UserID:    userID,
+		BookingID: &bookingID,
+		Type:      kind,
+		Message:   message,
+	}
+
+	if err := s.notificationRepo.Create(ctx, n); err != nil {
+		log.Printf("[NOTIFICATION] error guardando el aviso para el usuario %d: %s", userID, err)
+		return
+	}
+
+	if s.publisher == nil {
+		return
+	}
+
+	raw, err := json.Marshal(map[string]any{
+		"type": "notificacion",
+		"data": map[string]any{"user_id": userID},
+	})
+	if err != nil {
+		return
+	}
+
+	s.publisher.Broadcast(string(raw))
+}
+
+func (s *NotificationService) ListByUser(ctx context.Context, userID uint) ([]notification.Notification, error) {
+
+	if userID == 0 {
+		return nil, errors.New("el id del usuario no puede ser nulo")
+	}
+
+	return s.notificationRepo.ListByUser(ctx, userID, notificationsLimit)
+}
+
+func (s *NotificationService) MarkRead(ctx context.Context, id, userID uint) error {
+
+	if id == 0 {
+		return errors.New("el id de la notificacion es necesario")
+	}
+
+	return s.notificationRepo.MarkRead(ctx, id, userID)
+}
@@ -3,6 +3,7 @@ package usecases
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/booking/domain/payments"
@@ -56,3 +57,32 @@ func (s *PaymentService) MarkAsPaid(ctx context.Context, paymentID uint, mpPayme
 
 	return s.paymentRepo.MarkAsPaid(ctx, paymentID, mpPaymentID)
 }
+
+// Confirma las devoluciones pendientes a partir de la notificacion del proveedor.
+// Devuelve false si el pago no tiene devoluciones, para seguir con el flujo de cobro
+func (s *PaymentService) ConfirmRefunds(ctx context.Context, info *payments.ProviderPayment) (bool, error) {
+
+	if info == nil || info.RefundedAmount <= 0 {
+		return false, nil
+	}
+
+	charge, err := s.paymentRepo.GetByProviderID(ctx, info.ID)
+	if err != nil {
+		return true, err
+	}
+
+	if charge == nil {
+		return true, errors.New("no existe un cobro para el pago informado")
+	}
+
+	confirmed, err := s.paymentRepo.ConfirmRefunds(ctx, info.ID, info.RefundedAmount)
+	if err != nil {
+		return true, err
+	}
+
+	if confirmed > 0 {
+		log.Printf("[REFUND] %d devoluciones confirmadas para el pago %d", confirmed, charge.ID)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,156 @@
+package usecases
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+)
+
+// Tamaño maximo de un comprobante de transferencia
+const MaxReceiptSize = 5 << 20
+
+var receiptTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+type ReceiptService struct {
+	paymentRepo payments.PaymentRepository
+	bookingRepo booking.BookingRepository
+	storage     payments.ReceiptStorage
+	bookingSvc  *BookingService
+}
+
+func NewReceiptService(paymentRepo payments.PaymentRepository, bookingRepo booking.BookingRepository, storage payments.ReceiptStorage, bookingSvc *BookingService) *ReceiptService {
+	return &ReceiptService{paymentRepo, bookingRepo, storage, bookingSvc}
+}
+
+// Sube el comprobante de la transferencia de una reserva del cliente y lo deja pendiente de revision
+func (s *ReceiptService) Upload(ctx context.Context, bookingID, clientID uint, file io.Reader) (*payments.Payment, error) {
+
+	if bookingID == 0 {
+		return nil, errors.New("el id de la reserva no puede ser nulo")
+	}
+
+	// 1. Validar reserva y pago
+	payment, err := s.pendingTransfer(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.bookingRepo.GetByID(ctx, bookingID)
+	if err != nil || existing == nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	if existing.ClientID != clientID {
+		return nil, errors.New("la cita no pertenece al usuario")
+	}
+
+	if existing.Status != "pendiente_pago" {
+		return nil, errors.New("la reserva no tiene un pago pendiente")
+	}
+
+	// 2. Validar el archivo por su contenido, no por la extension
+	data, err := io.ReadAll(io.LimitReader(file, MaxReceiptSize+1))
+	if err != nil {
+		return nil, errors.New("no fue posible leer el comprobante")
+	}
+
+	if len(data) == 0 || len(data) > MaxReceiptSize || !slices.Contains(receiptTypes, http.DetectContentType(data)) {
+		return nil, payments.ErrInvalidReceipt
+	}
+
+	// 3. Subir a Cloudinary, el nombre fijo por pago reemplaza un comprobante anterior
+	url, err := s.storage.UploadReceipt(ctx, bytes.NewReader(data), fmt.Sprintf("booking_%d_payment_%d", bookingID, payment.ID))
+	if err != nil {
+		log.Println("[RECEIPT] error subiendo comprobante:", err)
+		return nil, errors.New("no fue posible subir el comprobante")
+	}
+
+	if err := s.paymentRepo.AttachReceipt(ctx, payment.ID, url); err != nil {
+		return nil, errors.New("no fue posible guardar el comprobante")
+	}
+
+	return s.paymentRepo.GetByBookingID(ctx, bookingID)
+}
+
+// Cola de revision: transferencias pendientes con comprobante, junto a su reserva
+func (s *ReceiptService) Pending(ctx context.Context) ([]booking.ReceiptReview, error) {
+
+	list, err := s.paymentRepo.PendingReceipts(ctx)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar los comprobantes")
+	}
+
+	reviews := make([]booking.ReceiptReview, 0, len(list))
+	for _, payment := range list {
+
+		existing, err := s.bookingRepo.GetByID(ctx, payment.BookingID)
+		if err != nil {
+			return nil, errors.New("no fue posible recuperar la cita")
+		}
+
+		// Reservas vencidas o canceladas ya no se pueden confirmar
+		if existing == nil || existing.Status != "pendiente_pago" {
+			continue
+		}
+
+		reviews = append(reviews, booking.ReceiptReview{Booking: *existing, Payment: payment})
+	}
+
+	return reviews, nil
+}
+
+// Aprueba la transferencia: el pago queda aprobado y la reserva confirmada
+func (s *ReceiptService) Approve(ctx context.Context, bookingID uint, actor booking.Actor) error {
+
+	payment, err := s.pendingTransfer(ctx, bookingID)
+	if err != nil {
+		return err
+	}
+
+	if payment.ReceiptURL == nil {
+		return errors.New("la reserva no tiene un comprobante para revisar")
+	}
+
+	return s.bookingSvc.MarkAsPaid(ctx, bookingID, actor)
+}
+
+// Rechaza el comprobante, el cliente puede subir uno nuevo mientras la reserva siga pendiente
+func (s *ReceiptService) Reject(ctx context.Context, bookingID uint, note string) error {
+
+	payment, err := s.pendingTransfer(ctx, bookingID)
+	if err != nil {
+		return err
+	}
+
+	if payment.ReceiptURL == nil {
+		return errors.New("la reserva no tiene un comprobante para revisar")
+	}
+
+	if note == "" {
+		note = "El comprobante no pudo ser verificado"
+	}
+
+	return s.paymentRepo.RejectReceipt(ctx, payment.ID, note)
+}
+
+func (s *ReceiptService) pendingTransfer(ctx context.Context, bookingID uint) (*payments.Payment, error) {
+
+	payment, err := s.paymentRepo.GetByBookingID(ctx, bookingID)
+	if err != nil || payment == nil || payment.ID == 0 {
+		return nil, errors.New("no fue posible recuperar el pago de la cita")
+	}
+
+	if payment.Method != "transferencia" || payment.Status != "pendiente" {
+		return nil, errors.New("el pago de la reserva no es una transferencia pendiente")
+	}
+
+	return payment, nil
+}
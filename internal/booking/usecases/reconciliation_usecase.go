@@ -0,0 +1,282 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+)
+
+const (
+	// Pagos pendientes recuperados por pagina, la corrida recorre todas las paginas
+	reconcileBatch = 100
+
+	// Antiguedad maxima de los pagos a conciliar, los checkouts vencidos hace mas tiempo ya no se consultan
+	reconcileWindow = 48 * time.Hour
+)
+
+var ErrReconciliationRunning = errors.New("ya hay una conciliacion en curso")
+
+// Concilia los pagos pendientes con el proveedor, por si una notificacion se perdio
+type ReconciliationService struct {
+	paymentRepo payments.PaymentRepository
+	reconRepo   payments.ReconciliationRepository
+	bookingRepo booking.BookingRepository
+	gateway     payments.Gateway
+	bookingSvc  *BookingService
+	paymentSvc  *PaymentService
+	seriesSvc   *SeriesService
+
+	running sync.Mutex // evita corridas superpuestas entre el job y la ejecucion manual
+}
+
+func NewReconciliationService(paymentRepo payments.PaymentRepository, reconRepo payments.ReconciliationRepository, bookingRepo booking.BookingRepository, gateway payments.Gateway, bookingSvc *BookingService, paymentSvc *PaymentService, seriesSvc *SeriesService) *ReconciliationService {
+	return &ReconciliationService{
+		paymentRepo: paymentRepo,
+		reconRepo:   reconRepo,
+		bookingRepo: bookingRepo,
+		gateway:     gateway,
+		bookingSvc:  bookingSvc,
+		paymentSvc:  paymentSvc,
+		seriesSvc:   seriesSvc,
+	}
+}
+
+// Consulta al proveedor cada pago pendiente con checkout o id de pago, repara los que
+// fueron aprobados y registra las discrepancias encontradas
+func (s *ReconciliationService) Run(ctx context.Context) (*payments.ReconciliationReport, error) {
+
+	if !s.running.TryLock() {
+		return nil, ErrReconciliationRunning
+	}
+	defer s.running.Unlock()
+
+	report := &payments.ReconciliationReport{
+		StartedAt:     time.Now(),
+		Discrepancies: []payments.Discrepancy{},
+	}
+
+	since := time.Now().Add(-reconcileWindow)
+
+	var afterID uint
+	for {
+		// 1. Pagos pendientes en el sistema, por paginas para que los que siguen pendientes no tapen a los nuevos
+		pending, err := s.paymentRepo.PendingWithProvider(ctx, since, afterID, reconcileBatch)
+		if err != nil {
+			if report.Checked == 0 {
+				return nil, errors.New("no fue posible recuperar los pagos pendientes")
+			}
+			report.Errors++
+			log.Println("[RECONCILIATION] error recuperando los pagos pendientes:", err)
+			break
+		}
+
+		// 2. Conciliar uno por uno, un error no corta la corrida
+		for i := range pending {
+			report.Checked++
+
+			found, err := s.reconcile(ctx, &pending[i])
+			if err != nil {
+				report.Errors++
+				log.Printf("[RECONCILIATION] error conciliando el pago %d: %s", pending[i].ID, err)
+			}
+
+			for _, d := range found {
+				if d.Status == "reparado" {
+					report.Repaired++
+				}
+
+				if _, err := s.reconRepo.Create(ctx, &d); err != nil {
+					log.Println("[RECONCILIATION] error registrando discrepancia:", err)
+				}
+
+				report.Discrepancies = append(report.Discrepancies, d)
+			}
+		}
+
+		if len(pending) < reconcileBatch || ctx.Err() != nil {
+			break
+		}
+		afterID = pending[len(pending)-1].ID
+	}
+
+	report.FinishedAt = time.Now()
+
+	if len(report.Discrepancies) > 0 || report.Errors > 0 {
+		log.Printf("[RECONCILIATION] %d pagos revisados, %d reparados, %d discrepancias, %d errores",
+			report.Checked, report.Repaired, len(report.Discrepancies), report.Errors)
+	}
+
+	return report, nil
+}
+
+func (s *ReconciliationService) StartReconciliationJob(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.Run(ctx); err != nil && !errors.Is(err, ErrReconciliationRunning) {
+					log.Println("[RECONCILIATION]", err)
+				}
+			}
+		}
+	}()
+}
+
+// Discrepancias registradas, status reparado o revision (vacio para todas)
+func (s *ReconciliationService) Discrepancies(ctx context.Context, status string) ([]payments.Discrepancy, error) {
+
+	if status != "" && status != "reparado" && status != "revision" {
+		return nil, errors.New("el status debe ser reparado o revision")
+	}
+
+	return s.reconRepo.List(ctx, status, 200)
+}
+
+func (s *ReconciliationService) reconcile(ctx context.Context, payment *payments.Payment) ([]payments.Discrepancy, error) {
+
+	existing, err := s.bookingRepo.GetByID(ctx, payment.BookingID)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar la cita")
+	}
+
+	// 1. Pagos del proveedor: por id si ya se conoce, si no por la referencia del checkout,
+	// que en los grupos y las series es la del checkout compartido por todas sus reservas
+	var found []payments.ProviderPayment
+
+	if payment.MercadoPagoID != nil && *payment.MercadoPagoID != "" {
+		info, err := s.gateway.GetPayment(ctx, *payment.MercadoPagoID)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, *info)
+	} else {
+		list, err := s.gateway.SearchPayments(ctx, checkoutReference(payment, existing))
+		if err != nil {
+			return nil, err
+		}
+		found = list
+	}
+
+	var approved, refunded []payments.ProviderPayment
+	for _, p := range found {
+		switch p.Status {
+		case "aprobado":
+			approved = append(approved, p)
+		case "reembolsado":
+			refunded = append(refunded, p)
+		}
+	}
+
+	var discrepancies []payments.Discrepancy
+
+	// 2. Devuelto en el proveedor sin haberse confirmado, lo revisa un administrador
+	for _, p := range refunded {
+		discrepancies = append(discrepancies, discrepancy(payment, p, payments.DiscrepancyRefunded, "revision",
+			"El pago fue devuelto en el proveedor y nunca se confirmo en el sistema"))
+	}
+
+	if len(approved) == 0 {
+		return discrepancies, nil
+	}
+
+	// 3. Mas de un pago aprobado para el mismo checkout, el resto se debe devolver a mano
+	paid := approved[0]
+	for _, p := range approved[1:] {
+		discrepancies = append(discrepancies, discrepancy(payment, p, payments.DiscrepancyDuplicate, "revision",
+			fmt.Sprintf("Pago aprobado duplicado, ya se concilio el pago %s", paid.ID)))
+	}
+
+	// El checkout compartido abona todas las reservas del grupo o la serie, se repara como su notificacion
+	if existing != nil && (existing.GroupID != nil || existing.SeriesID != nil) {
+		if err := s.markCoveredAsPaid(ctx, existing, &paid); err != nil {
+			return discrepancies, err
+		}
+
+		discrepancies = append(discrepancies, discrepancy(payment, paid, payments.DiscrepancyApproved, "reparado",
+			"Pago compartido aprobado sin notificacion, se confirmaron los pagos y las reservas del checkout"))
+		return discrepancies, nil
+	}
+
+	if math.Abs(paid.Amount-payment.Amount) > 0.01 {
+		discrepancies = append(discrepancies, discrepancy(payment, paid, payments.DiscrepancyAmount, "revision",
+			fmt.Sprintf("El proveedor aprobo %.2f y el sistema esperaba %.2f", paid.Amount, payment.Amount)))
+		return discrepancies, nil
+	}
+
+	// 4. La reserva ya fue cancelada o rechazada, el cobro queda para revisar. Las vencidas
+	// se intentan recuperar si sus turnos siguen libres
+	if existing == nil || (existing.Status != "expirado" && !slices.Contains(booking.ActiveStatuses, existing.Status)) {
+		discrepancies = append(discrepancies, discrepancy(payment, paid, payments.DiscrepancyCanceled, "revision",
+			"El pago fue aprobado pero la reserva ya no esta activa"))
+		return discrepancies, nil
+	}
+
+	// 5. Reparar igual que la notificacion: aprobar el pago y confirmar la reserva si sigue pendiente
+	if err := s.paymentSvc.MarkAsPaid(ctx, payment.ID, paid.ID); err != nil {
+		return discrepancies, fmt.Errorf("payment fallo actualizando status a pagado: %w", err)
+	}
+
+	if existing.Status == "pendiente_pago" || existing.Status == "expirado" {
+		if err := s.bookingSvc.MarkAsPaid(ctx, existing.ID, booking.SystemActor()); err != nil {
+			if errors.Is(err, booking.ErrBookingExpired) {
+				discrepancies = append(discrepancies, discrepancy(payment, paid, payments.DiscrepancyCanceled, "revision",
+					"El pago fue aprobado despues del vencimiento y el turno ya fue tomado"))
+				return discrepancies, nil
+			}
+			return discrepancies, fmt.Errorf("booking fallo actualizando status a confirmado: %w", err)
+		}
+	}
+
+	discrepancies = append(discrepancies, discrepancy(payment, paid, payments.DiscrepancyApproved, "reparado",
+		"Pago aprobado sin notificacion, se confirmo el pago y la reserva"))
+
+	return discrepancies, nil
+}
+
+// Referencia externa del checkout que abona el pago
+func checkoutReference(payment *payments.Payment, b *booking.Booking) string {
+	switch {
+	case b != nil && b.GroupID != nil:
+		return payments.GroupReference(*b.GroupID)
+	case b != nil && b.SeriesID != nil:
+		return payments.SeriesReference(*b.SeriesID)
+	default:
+		return payments.ExternalReference(payment.ID)
+	}
+}
+
+// Aprueba los pagos y confirma las reservas del grupo o la serie de b, las inactivas quedan para revision
+func (s *ReconciliationService) markCoveredAsPaid(ctx context.Context, b *booking.Booking, paid *payments.ProviderPayment) error {
+	if b.GroupID != nil {
+		return s.bookingSvc.MarkGroupAsPaid(ctx, *b.GroupID, paid)
+	}
+	return s.seriesSvc.MarkAsPaid(ctx, *b.SeriesID, paid)
+}
+
+func discrepancy(payment *payments.Payment, provider payments.ProviderPayment, kind, status, detail string) payments.Discrepancy {
+	return payments.Discrepancy{
+		PaymentID:      payment.ID,
+		BookingID:      payment.BookingID,
+		ProviderID:     provider.ID,
+		Type:           kind,
+		LocalStatus:    payment.Status,
+		ProviderStatus: provider.Status,
+		LocalAmount:    payment.Amount,
+		ProviderAmount: provider.Amount,
+		Status:         status,
+		Detail:         detail,
+	}
+}
@@ -0,0 +1,120 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	policy "github.com/ezep02/rodeo/internal/policy/usecase"
+)
+
+// Reservas de un grupo en memoria, registra las que se confirman
+type fakeGroupBookingRepo struct {
+	*fakeCancelBookingRepo
+
+	confirmed []uint
+}
+
+func (r *fakeGroupBookingRepo) ByGroup(ctx context.Context, groupID uint) ([]booking.Booking, error) {
+	return []booking.Booking{r.booking}, nil
+}
+
+func (r *fakeGroupBookingRepo) MarkAsPaid(ctx context.Context, bookingID uint, actor booking.Actor) error {
+	r.confirmed = append(r.confirmed, bookingID)
+	return nil
+}
+
+// Proveedor que responde la busqueda por referencia externa
+type fakeSearchGateway struct {
+	payments.Gateway
+
+	found    []payments.ProviderPayment
+	searched []string
+}
+
+func (g *fakeSearchGateway) SearchPayments(ctx context.Context, externalReference string) ([]payments.ProviderPayment, error) {
+	g.searched = append(g.searched, externalReference)
+	return g.found, nil
+}
+
+// El pago de un grupo se busca por la referencia del checkout compartido y confirma sus reservas,
+// aunque el monto aprobado cubra a todos los asistentes y no coincida con el de cada pago
+func TestReconcileGroupPaymentByGroupReference(t *testing.T) {
+
+	groupID := uint(4)
+	preferenceID := "pref-group"
+	pending := &payments.Payment{ID: 1, BookingID: 10, Amount: 500, Type: "total", Method: "mercadopago", Status: "pendiente", Kind: payments.KindCharge, PreferenceID: &preferenceID}
+
+	_, cancelRepo, _ := newCancelCaseWithGateway(pending, &fakeRefundGateway{})
+	cancelRepo.booking.GroupID = &groupID
+	bookingRepo := &fakeGroupBookingRepo{fakeCancelBookingRepo: cancelRepo}
+
+	paymentRepo := &fakeCancelPaymentRepo{payment: pending}
+	gateway := &fakeSearchGateway{found: []payments.ProviderPayment{{ID: "pay-group", Status: "aprobado", Amount: 1500}}}
+
+	bookingSvc := NewBookingService(bookingRepo, paymentRepo, nil, &fakeReconRepo{}, gateway, nil,
+		NewWaitlistService(fakeIdleWaitlistRepo{}, DefaultWaitlistHold), policy.NewPolicyService(fakePolicyRepo{}), NewNotificationService(fakeNotificationRepo{}, nil))
+	svc := NewReconciliationService(paymentRepo, &fakeReconRepo{}, bookingRepo, gateway, bookingSvc, NewPaymentService(paymentRepo), nil)
+
+	found, err := svc.reconcile(context.Background(), pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gateway.searched) != 1 || gateway.searched[0] != "group-4" {
+		t.Fatalf("se esperaba buscar por la referencia del grupo, se busco %v", gateway.searched)
+	}
+
+	if len(bookingRepo.confirmed) != 1 || bookingRepo.confirmed[0] != 10 || pending.Status != "aprobado" {
+		t.Fatalf("se esperaba aprobar el pago y confirmar la reserva, confirmadas %v, pago %s", bookingRepo.confirmed, pending.Status)
+	}
+
+	if len(found) != 1 || found[0].Type != payments.DiscrepancyApproved || found[0].Status != "reparado" {
+		t.Fatalf("se esperaba el pago reparado, se obtuvo %+v", found)
+	}
+}
+
+// Pagos pendientes en memoria, paginados por id como el repositorio
+type fakePendingPaymentRepo struct {
+	payments.PaymentRepository
+
+	pending []payments.Payment
+}
+
+func (r *fakePendingPaymentRepo) PendingWithProvider(ctx context.Context, since time.Time, afterID uint, limit int) ([]payments.Payment, error) {
+	var page []payments.Payment
+	for _, p := range r.pending {
+		if p.ID > afterID && len(page) < limit {
+			page = append(page, p)
+		}
+	}
+	return page, nil
+}
+
+// Los pagos que siguen pendientes en el proveedor no impiden conciliar a los mas nuevos
+func TestRunReconcilesEveryPage(t *testing.T) {
+
+	paymentRepo := &fakePendingPaymentRepo{}
+	for id := uint(1); id <= reconcileBatch*2+5; id++ {
+		paymentRepo.pending = append(paymentRepo.pending, payments.Payment{ID: id, BookingID: 10, Amount: 500, Method: "mercadopago", Status: "pendiente", Kind: payments.KindCharge})
+	}
+
+	_, bookingRepo, _ := newCancelCaseWithGateway(nil, &fakeRefundGateway{})
+	gateway := &fakeSearchGateway{}
+	svc := NewReconciliationService(paymentRepo, &fakeReconRepo{}, bookingRepo, gateway, nil, nil, nil)
+
+	report, err := svc.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Checked != len(paymentRepo.pending) || len(gateway.searched) != len(paymentRepo.pending) {
+		t.Fatalf("se esperaban %d pagos revisados, se revisaron %d", len(paymentRepo.pending), report.Checked)
+	}
+
+	if last := gateway.searched[len(gateway.searched)-1]; last != payments.ExternalReference(reconcileBatch*2+5) {
+		t.Fatalf("el ultimo pago revisado deberia ser el mas nuevo, se obtuvo %s", last)
+	}
+}
@@ -0,0 +1,429 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	"github.com/ezep02/rodeo/internal/booking/domain/services"
+	pricingDomain "github.com/ezep02/rodeo/internal/pricing/domain"
+	pricing "github.com/ezep02/rodeo/internal/pricing/usecase"
+)
+
+const (
+	// Turnos que puede reservar una serie
+	maxSeriesOccurrences = 26
+
+	// Intervalo maximo entre turnos de una serie, en semanas
+	maxSeriesIntervalWeeks = 12
+)
+
+// Estados de una reserva de la serie que todavia pueden cancelarse
+var seriesCancelable = []string{"pendiente_pago", "confirmado", "pagado", "reprogramado"}
+
+type SeriesService struct {
+	seriesRepo   booking.SeriesRepository
+	checkoutRepo booking.CheckoutRepository
+	bookingRepo  booking.BookingRepository
+	gateway      payments.Gateway
+	pricingSvc   *pricing.PricingService
+	checkoutSvc  *CheckoutService
+	bookingSvc   *BookingService
+}
+
+func NewSeriesService(
+	seriesRepo booking.SeriesRepository,
+	checkoutRepo booking.CheckoutRepository,
+	bookingRepo booking.BookingRepository,
+	gateway payments.Gateway,
+	pricingSvc *pricing.PricingService,
+	checkoutSvc *CheckoutService,
+	bookingSvc *BookingService,
+) *SeriesService {
+	return &SeriesService{seriesRepo, checkoutRepo, bookingRepo, gateway, pricingSvc, checkoutSvc, bookingSvc}
+}
+
+// Datos enviados por el cliente para crear una serie recurrente
+type SeriesRequest struct {
+	BarberID      uint       `json:"barber_id"`
+	Start         time.Time  `json:"start"`          // primer turno, fija el dia y la hora
+	IntervalWeeks int        `json:"interval_weeks"` // 1 semanal, 2 quincenal, etc.
+	Count         int        `json:"count"`          // cantidad de turnos, o bien
+	Until         *time.Time `json:"until"`          // fecha hasta la que se repite
+	ServicesID    []uint     `json:"services_id"`
+	PaymentMode   string     `json:"payment_mode"` // por_turno o prepago
+}
+
+// Crea la serie y reserva por adelantado cada turno disponible. Los turnos que no se pueden
+// reservar se informan y no cortan la serie. En las series prepagas cada turno queda pendiente
+// de pago hasta que se abona el checkout de la serie completa
+func (s *SeriesService) Create(ctx context.Context, req SeriesRequest, clientID uint) (*booking.SeriesResponse, error) {
+
+	// 1. Validar la solicitud
+	dates, err := seriesDates(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientID == 0 {
+		return nil, errors.New("el id del cliente es necesario")
+	}
+
+	// Los clientes con ausencias previas deben abonar el total por adelantado
+	if req.PaymentMode == booking.SeriesPerOccurrence && s.checkoutSvc.requiresPrepayment(ctx, clientID) {
+		return nil, booking.ErrPrepaymentRequired
+	}
+
+	// 2. Cotizar los servicios una vez, todos los turnos de la serie tienen el mismo precio
+	quote, err := s.pricingSvc.Quote(ctx, uniqueIDs(req.ServicesID), time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Crear la serie
+	series := &booking.BookingSeries{
+		ClientID:      clientID,
+		BarberID:      req.BarberID,
+		Start:         dates[0],
+		IntervalWeeks: req.IntervalWeeks,
+		Count:         req.Count,
+		Until:         req.Until,
+		PaymentMode:   req.PaymentMode,
+		Status:        "activa",
+	}
+
+	if err := s.seriesRepo.Create(ctx, series); err != nil {
+		return nil, errors.New("no fue posible crear la serie")
+	}
+
+	// 4. Reservar cada turno, las series prepagas vencen juntas si no se abonan a tiempo
+	var expiresAt *time.Time
+	if req.PaymentMode == booking.SeriesPrepaid {
+		at := time.Now().Add(s.checkoutSvc.expiry)
+		expiresAt = &at
+	}
+
+	response := &booking.SeriesResponse{Series: series, Skipped: []booking.SeriesSkip{}}
+
+	for _, at := range dates {
+		placed, err := s.place(ctx, series, at, quote, expiresAt)
+		if err != nil {
+			response.Skipped = append(response.Skipped, booking.SeriesSkip{Start: at, Error: err.Error()})
+			continue
+		}
+
+		series.Bookings = append(series.Bookings, *placed.Booking)
+		if placed.Payment != nil {
+			response.AmountDue += placed.Payment.Amount
+		}
+	}
+
+	if len(series.Bookings) == 0 {
+		if err := s.seriesRepo.Delete(ctx, series.ID); err != nil {
+			log.Println("[SERIES] error eliminando la serie sin turnos:", err)
+		}
+		return nil, booking.ErrSeriesEmpty
+	}
+
+	if req.PaymentMode != booking.SeriesPrepaid {
+		return response, nil
+	}
+
+	// 5. Un unico checkout para la serie prepaga, cubre los pagos de todos sus turnos.
+	// Si no se puede crear, las reservas se dejan sin efecto y la serie queda cancelada
+	initPoint, err := s.createCheckout(ctx, series, response.AmountDue, expiresAt)
+	if err != nil {
+		log.Printf("[SERIES] error creando el checkout de la serie %d: %s", series.ID, err)
+		s.abort(context.WithoutCancel(ctx), series)
+		return nil, errors.New("no fue posible crear el link de pago de la serie")
+	}
+
+	series.PaymentURL = &initPoint
+	response.InitPoint = initPoint
+
+	return response, nil
+}
+
+// Reserva el turno del barbero que comienza en at, con los servicios ya cotizados
+func (s *SeriesService) place(ctx context.Context, series *booking.BookingSeries, at time.Time, quote *pricingDomain.Quote, expiresAt *time.Time) (*booking.Checkout, error) {
+
+	slot, err := s.bookingRepo.FindSlot(ctx, series.BarberID, at)
+	if err != nil {
+		return nil, errors.New("no fue posible verificar el turno")
+	}
+
+	if slot == nil {
+		return nil, booking.ErrSlotNotFound
+	}
+
+	bookingServices := make([]services.BookingServices, 0, len(quote.Items))
+	for _, item := range quote.Items {
+		bookingServices = append(bookingServices, services.BookingServices{
+			ServiceID: uint(item.ServiceID),
+		})
+	}
+
+	seriesID := series.ID
+	checkout := &booking.Checkout{
+		Booking: &booking.Booking{
+			SlotID:         slot.ID,
+			ClientID:       series.ClientID,
+			Status:         "confirmado",
+			TotalAmount:    quote.Total,
+			DiscountAmount: quote.PromoDiscount,
+			SeriesID:       &seriesID,
+		},
+		Services: bookingServices,
+		Duration: quote.Duration,
+		Quote:    quote,
+	}
+
+	// Los turnos de la serie prepaga se abonan completos con el checkout de la serie
+	if series.PaymentMode == booking.SeriesPrepaid {
+		checkout.Booking.Status = "pendiente_pago"
+		checkout.Booking.ExpiresAt = expiresAt
+		checkout.Payment = &payments.Payment{
+			Amount: quote.Total,
+			Type:   "total",
+			Method: "mercadopago",
+			Status: "pendiente",
+		}
+	}
+
+	if err := s.checkoutRepo.Create(ctx, checkout); err != nil {
+		if booking.IsSlotError(err) {
+			return nil, err
+		}
+		log.Printf("[SERIES] error reservando el turno %d de la serie %d: %s", slot.ID, series.ID, err)
+		return nil, errors.New("no fue posible reservar el turno")
+	}
+
+	checkout.Booking.Slot = *slot
+
+	return checkout, nil
+}
+
+// Libera los turnos de una serie prepaga cuyo checkout no pudo crearse y la cancela
+func (s *SeriesService) abort(ctx context.Context, series *booking.BookingSeries) {
+
+	ids := make([]uint, 0, len(series.Bookings))
+	for _, b := range series.Bookings {
+		ids = append(ids, b.ID)
+	}
+
+	s.checkoutSvc.Abort(ctx, ids, "no fue posible crear el pago de la serie en el proveedor")
+
+	if err := s.seriesRepo.UpdateStatus(ctx, series.ID, "cancelada"); err != nil {
+		log.Printf("[SERIES] no fue posible cancelar la serie %d: %s", series.ID, err)
+	}
+}
+
+func (s *SeriesService) createCheckout(ctx context.Context, series *booking.BookingSeries, amount float64, expiresAt *time.Time) (string, error) {
+
+	var (
+		notification_url = os.Getenv("NGROK_URL")
+	)
+
+	if notification_url == "" {
+		return "", errors.New("no fue posible recuperar las variables de entorno")
+	}
+
+	checkout, err := s.gateway.CreateCheckout(ctx, payments.CheckoutRequest{
+		Title:           fmt.Sprintf("Serie de %d turnos", len(series.Bookings)),
+		Amount:          amount,
+		Quantity:        1,
+		NotificationURL: fmt.Sprintf("%s/api/v1/mercado_pago/notification", notification_url),
+		BackURL:         "http://localhost:5173",
+		Metadata: map[string]any{
+			"series_id": series.ID,
+			"user_id":   series.ClientID,
+		},
+		ExternalReference: payments.SeriesReference(series.ID),
+		ExpiresAt:         expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Sin el checkout guardado en los pagos la conciliacion no podria encontrar el pago de la serie
+	if err := s.seriesRepo.SetCheckout(ctx, series.ID, checkout); err != nil {
+		return "", err
+	}
+
+	return checkout.InitPoint, nil
+}
+
+// Aprueba los pagos pendientes de la serie con el pago del proveedor y confirma sus reservas
+func (s *SeriesService) MarkAsPaid(ctx context.Context, seriesID uint, paymentInfo *payments.ProviderPayment) error {
+
+	series, err := s.seriesRepo.GetByID(ctx, seriesID)
+	if err != nil {
+		return err
+	}
+
+	return s.bookingSvc.markCoveredAsPaid(ctx, series.Bookings, paymentInfo)
+}
+
+// Serie con sus reservas, visible para su cliente o un administrador
+func (s *SeriesService) GetByID(ctx context.Context, seriesID, userID uint, isAdmin bool) (*booking.BookingSeries, error) {
+
+	if seriesID == 0 {
+		return nil, errors.New("el id de la serie es necesario")
+	}
+
+	series, err := s.seriesRepo.GetByID(ctx, seriesID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin && series.ClientID != userID {
+		return nil, errors.New("la serie no pertenece al usuario")
+	}
+
+	return series, nil
+}
+
+func (s *SeriesService) ListByClient(ctx context.Context, clientID uint) ([]booking.BookingSeries, error) {
+	return s.seriesRepo.ListByClient(ctx, clientID)
+}
+
+// Cancela un turno de la serie aplicando la politica de cancelacion, la serie sigue vigente
+func (s *SeriesService) CancelOccurrence(ctx context.Context, seriesID, bookingID, userID uint, isAdmin bool, compensation string) (*booking.CancelationResponse, error) {
+
+	series, err := s.GetByID(ctx, seriesID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := slices.IndexFunc(series.Bookings, func(b booking.Booking) bool { return b.ID == bookingID })
+	if idx < 0 {
+		return nil, errors.New("la reserva no pertenece a la serie")
+	}
+
+	// El checkout de la serie prepaga cubre todos sus turnos, antes de abonarlo solo se cancela completa
+	if series.Bookings[idx].Status == "pendiente_pago" {
+		return nil, errors.New("la serie todavia no fue abonada, solo puede cancelarse completa")
+	}
+
+	return s.bookingSvc.CancelBooking(ctx, bookingID, userID, isAdmin, compensation)
+}
+
+// Cancela los turnos futuros de la serie, cada uno con la politica de cancelacion, y da la serie por cancelada.
+// Los turnos que no se pueden cancelar se informan y no cortan el proceso
+func (s *SeriesService) CancelSeries(ctx context.Context, seriesID, userID uint, isAdmin bool, compensation string) ([]booking.SeriesCancelResult, error) {
+
+	series, err := s.GetByID(ctx, seriesID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	if series.Status == "cancelada" {
+		return nil, errors.New("la serie ya fue cancelada")
+	}
+
+	results := []booking.SeriesCancelResult{}
+	now := time.Now()
+
+	for _, b := range series.Bookings {
+		if !slices.Contains(seriesCancelable, b.Status) || b.Slot.Start.Before(now) {
+			continue
+		}
+
+		result := booking.SeriesCancelResult{BookingID: b.ID}
+
+		var cancelation *booking.CancelationResponse
+		if b.Status == "pendiente_pago" {
+			cancelation, err = s.cancelUnpaid(ctx, &b, userID, isAdmin)
+		} else {
+			cancelation, err = s.bookingSvc.CancelBooking(ctx, b.ID, userID, isAdmin, compensation)
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Cancelation = cancelation
+
+		results = append(results, result)
+	}
+
+	if err := s.seriesRepo.UpdateStatus(ctx, seriesID, "cancelada"); err != nil {
+		return nil, errors.New("no fue posible cancelar la serie")
+	}
+
+	return results, nil
+}
+
+// Cancela sin cargo un turno de la serie prepaga que todavia no fue abonado
+func (s *SeriesService) cancelUnpaid(ctx context.Context, b *booking.Booking, userID uint, isAdmin bool) (*booking.CancelationResponse, error) {
+
+	actor, err := actorFor(b, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bookingSvc.cancelUnpaid(ctx, b, actor)
+}
+
+// Fechas de los turnos de la serie. Se suman semanas sobre la fecha local para conservar la hora del turno
+func seriesDates(req SeriesRequest) ([]time.Time, error) {
+
+	if req.BarberID == 0 {
+		return nil, errors.New("el id del barbero es necesario")
+	}
+
+	if len(req.ServicesID) == 0 {
+		return nil, errors.New("debe seleccionar al menos un servicio")
+	}
+
+	if req.PaymentMode != booking.SeriesPerOccurrence && req.PaymentMode != booking.SeriesPrepaid {
+		return nil, errors.New("la forma de pago debe ser por_turno o prepago")
+	}
+
+	if req.IntervalWeeks < 1 || req.IntervalWeeks > maxSeriesIntervalWeeks {
+		return nil, fmt.Errorf("el intervalo debe estar entre 1 y %d semanas", maxSeriesIntervalWeeks)
+	}
+
+	if (req.Count > 0) == (req.Until != nil) {
+		return nil, errors.New("debe indicar la cantidad de turnos o la fecha de fin, no ambas")
+	}
+
+	if req.Count < 0 || req.Count > maxSeriesOccurrences {
+		return nil, fmt.Errorf("la serie puede tener hasta %d turnos", maxSeriesOccurrences)
+	}
+
+	start := req.Start.Local()
+	if !start.After(time.Now()) {
+		return nil, errors.New("el primer turno debe ser futuro")
+	}
+
+	if req.Until != nil && req.Until.Before(start) {
+		return nil, errors.New("la fecha de fin debe ser posterior al primer turno")
+	}
+
+	dates := make([]time.Time, 0, maxSeriesOccurrences)
+	for i := 0; i < maxSeriesOccurrences; i++ {
+		at := start.AddDate(0, 0, 7*req.IntervalWeeks*i)
+
+		if req.Count > 0 && i >= req.Count {
+			break
+		}
+		if req.Until != nil && at.After(*req.Until) {
+			break
+		}
+
+		dates = append(dates, at)
+	}
+
+	// Con fecha de fin la serie no puede superar el maximo de turnos
+	if req.Until != nil && !start.AddDate(0, 0, 7*req.IntervalWeeks*maxSeriesOccurrences).After(*req.Until) {
+		return nil, fmt.Errorf("la serie puede tener hasta %d turnos", maxSeriesOccurrences)
+	}
+
+	return dates, nil
+}
@@ -0,0 +1,106 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+	policy "github.com/ezep02/rodeo/internal/policy/usecase"
+	pricing "github.com/ezep02/rodeo/internal/pricing/usecase"
+)
+
+// Series en memoria, registra el estado final
+type fakeSeriesRepo struct {
+	booking.SeriesRepository
+
+	status string
+}
+
+func (r *fakeSeriesRepo) Create(ctx context.Context, series *booking.BookingSeries) error {
+	series.ID = 4
+	r.status = series.Status
+	return nil
+}
+
+func (r *fakeSeriesRepo) UpdateStatus(ctx context.Context, seriesID uint, status string) error {
+	r.status = status
+	return nil
+}
+
+// Cada turno pedido existe y queda reservado, registra las reservas que se dejan sin efecto
+type fakeSeriesBookingRepo struct {
+	booking.BookingRepository
+
+	expired []uint
+}
+
+func (r *fakeSeriesBookingRepo) FindSlot(ctx context.Context, barberID uint, start time.Time) (*booking.Slot, error) {
+	return &booking.Slot{ID: uint(start.Unix() % 1000), BarberID: barberID, Start: start, End: start.Add(30 * time.Minute)}, nil
+}
+
+func (r *fakeSeriesBookingRepo) UpdateStatus(ctx context.Context, bookingID uint, status string, actor booking.Actor, reason string) error {
+	if status == "expirado" {
+		r.expired = append(r.expired, bookingID)
+	}
+	return nil
+}
+
+type fakeSeriesCheckoutRepo struct {
+	booking.CheckoutRepository
+
+	nextID uint
+}
+
+func (r *fakeSeriesCheckoutRepo) Create(ctx context.Context, checkout *booking.Checkout) error {
+	r.nextID++
+	checkout.Booking.ID = r.nextID
+	return nil
+}
+
+// El proveedor no acepta crear el checkout
+type fakeFailingGateway struct {
+	payments.Gateway
+}
+
+func (fakeFailingGateway) CreateCheckout(ctx context.Context, req payments.CheckoutRequest) (*payments.Checkout, error) {
+	return nil, errors.New("el proveedor no responde")
+}
+
+// Si el checkout de una serie prepaga falla, sus reservas se liberan y la serie queda cancelada
+func TestSeriesCheckoutFailureAbortsBookings(t *testing.T) {
+
+	t.Setenv("NGROK_URL", "http://localhost")
+
+	var (
+		seriesRepo   = &fakeSeriesRepo{}
+		bookingRepo  = &fakeSeriesBookingRepo{}
+		checkoutRepo = &fakeSeriesCheckoutRepo{}
+		pricingSvc   = pricing.NewPricingService(fakePricingRepo{})
+		checkoutSvc  = NewCheckoutService(checkoutRepo, bookingRepo, pricingSvc, nil, policy.NewPolicyService(fakePolicyRepo{}), DefaultBookingExpiry)
+		svc          = NewSeriesService(seriesRepo, checkoutRepo, bookingRepo, fakeFailingGateway{}, pricingSvc, checkoutSvc, nil)
+	)
+
+	_, err := svc.Create(context.Background(), SeriesRequest{
+		BarberID:      7,
+		Start:         time.Now().Add(72 * time.Hour),
+		IntervalWeeks: 1,
+		Count:         3,
+		ServicesID:    []uint{1},
+		PaymentMode:   booking.SeriesPrepaid,
+	}, 5)
+	if err == nil {
+		t.Fatal("se esperaba el error del checkout de la serie")
+	}
+
+	if !slices.Equal(bookingRepo.expired, []uint{1, 2, 3}) {
+		t.Fatalf("se esperaba liberar las 3 reservas de la serie, se liberaron %v", bookingRepo.expired)
+	}
+
+	if seriesRepo.status != "cancelada" {
+		t.Fatalf("la serie deberia quedar cancelada, esta %s", seriesRepo.status)
+	}
+}
@@ -0,0 +1,274 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/waitlist"
+)
+
+// Tiempo por defecto que un turno ofrecido queda retenido para el cliente
+const DefaultWaitlistHold = 30 * time.Minute
+
+type WaitlistService struct {
+	waitlistRepo waitlist.WaitlistRepository
+	hold         time.Duration
+}
+
+func NewWaitlistService(waitlistRepo waitlist.WaitlistRepository, hold time.Duration) *WaitlistService {
+	if hold <= 0 {
+		hold = DefaultWaitlistHold
+	}
+	return &WaitlistService{waitlistRepo, hold}
+}
+
+// Anota al cliente en la lista de espera, el rango de fechas se toma en dias completos
+func (s *WaitlistService) Join(ctx context.Context, entry *waitlist.WaitlistEntry) error {
+
+	if entry == nil || entry.ClientID == 0 {
+		return errors.New("la anotacion no es valida")
+	}
+
+	var (
+		from = time.Date(entry.DateFrom.Year(), entry.DateFrom.Month(), entry.DateFrom.Day(), 0, 0, 0, 0, time.Local)
+		to   = time.Date(entry.DateTo.Year(), entry.DateTo.Month(), entry.DateTo.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	)
+
+	if entry.DateFrom.IsZero() || entry.DateTo.IsZero() || !to.After(from) {
+		return errors.New("el rango de fechas no es valido")
+	}
+
+	if to.Before(time.Now()) {
+		return errors.New("el rango de fechas ya paso")
+	}
+
+	if to.Sub(from) > 60*24*time.Hour {
+		return errors.New("el rango de fechas no puede superar los 60 dias")
+	}
+
+	entry.ID = 0
+	entry.DateFrom = from
+	entry.DateTo = to
+	entry.Status = "esperando"
+	entry.Offers = nil
+
+	if err := s.waitlistRepo.Create(ctx, entry); err != nil {
+		return errors.New("no fue posible anotarse en la lista de espera")
+	}
+
+	// Puede que ya haya un turno libre que le sirva
+	go s.matchEntry(context.Background(), *entry)
+
+	return nil
+}
+
+func (s *WaitlistService) ListByClient(ctx context.Context, clientID uint) ([]waitlist.WaitlistEntry, error) {
+	return s.waitlistRepo.ListByClient(ctx, clientID)
+}
+
+// Da de baja la anotacion del cliente, si tenia un turno ofrecido pasa al siguiente
+func (s *WaitlistService) Leave(ctx context.Context, entryID, clientID uint) error {
+
+	entry, err := s.waitlistRepo.GetByID(ctx, entryID)
+	if err != nil {
+		return err
+	}
+
+	if entry.ClientID != clientID {
+		return waitlist.ErrEntryNotFound
+	}
+
+	var heldSlot uint
+	for _, o := range entry.Offers {
+		if o.Status == "ofrecido" {
+			heldSlot = o.SlotID
+		}
+	}
+
+	if err := s.waitlistRepo.Cancel(ctx, entryID); err != nil {
+		return errors.New("no fue posible salir de la lista de espera")
+	}
+
+	if heldSlot != 0 {
+		go s.OfferSlot(context.Background(), heldSlot)
+	}
+
+	return nil
+}
+
+// El cliente rechaza el turno ofrecido, se le ofrece al siguiente de la lista
+func (s *WaitlistService) Decline(ctx context.Context, offerID, clientID uint) error {
+
+	offer, err := s.waitlistRepo.GetOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.waitlistRepo.GetByID(ctx, offer.WaitlistEntryID)
+	if err != nil || entry.ClientID != clientID {
+		return waitlist.ErrOfferNotFound
+	}
+
+	if err := s.waitlistRepo.CloseOffer(ctx, offerID, "rechazado"); err != nil {
+		return err
+	}
+
+	go s.OfferSlot(context.Background(), offer.SlotID)
+
+	return nil
+}
+
+// Ofrece un turno que se libero al primer cliente de la lista de espera al que le sirva.
+// El turno queda retenido para ese cliente durante la ventana de espera.
+func (s *WaitlistService) OfferSlot(ctx context.Context, slotID uint) {
+
+	slot, err := s.waitlistRepo.GetSlot(ctx, slotID)
+	if err != nil || slot.Start.Before(time.Now()) {
+		return
+	}
+
+	// El turno debe seguir libre (otra reserva u oferta pudo haberlo tomado)
+	free, err := s.waitlistRepo.FreeSlots(ctx, &slot.BarberID, slot.Start, slot.Start.Add(24*time.Hour))
+	if err != nil || len(free) == 0 || free[0].ID != slot.ID {
+		return
+	}
+
+	candidates, err := s.waitlistRepo.Candidates(ctx, slot)
+	if err != nil {
+		log.Println("[WAITLIST] error recuperando candidatos:", err)
+		return
+	}
+
+	for _, entry := range candidates {
+		if !s.fits(ctx, entry.ID, free, 0) {
+			continue
+		}
+
+		// Si otra reserva tomo el turno no se ofrece a nadie mas
+		if err := s.offer(ctx, entry.ID, slot.ID); err == nil || errors.Is(err, waitlist.ErrSlotTaken) {
+			return
+		}
+	}
+}
+
+// Vence las ofertas que no fueron reclamadas a tiempo y pasa cada turno al siguiente de la lista
+func (s *WaitlistService) ExpireOffers(ctx context.Context) {
+
+	offers, err := s.waitlistRepo.ExpiredOffers(ctx, time.Now())
+	if err != nil {
+		log.Println("[WAITLIST] error recuperando ofertas vencidas:", err)
+		return
+	}
+
+	for _, offer := range offers {
+		if err := s.waitlistRepo.CloseOffer(ctx, offer.ID, "vencido"); err != nil {
+			continue
+		}
+		s.OfferSlot(ctx, offer.SlotID)
+	}
+}
+
+// Busca turnos libres para las anotaciones en espera, en orden de llegada
+func (s *WaitlistService) MatchWaiting(ctx context.Context) {
+
+	entries, err := s.waitlistRepo.Waiting(ctx)
+	if err != nil {
+		log.Println("[WAITLIST] error recuperando la lista de espera:", err)
+		return
+	}
+
+	for _, entry := range entries {
+		s.matchEntry(ctx, entry)
+	}
+}
+
+// Proceso en segundo plano que vence ofertas y ofrece los turnos que se liberaron
+// (reservas vencidas, turnos nuevos, cancelaciones hechas por el barbero)
+func (s *WaitlistService) StartWaitlistJob(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.ExpireOffers(ctx)
+				s.MatchWaiting(ctx)
+			}
+		}
+	}()
+}
+
+// Ofrece a la anotacion el primer turno libre de su rango que cubra sus servicios
+func (s *WaitlistService) matchEntry(ctx context.Context, entry waitlist.WaitlistEntry) {
+
+	free, err := s.waitlistRepo.FreeSlots(ctx, entry.BarberID, entry.DateFrom, entry.DateTo)
+	if err != nil {
+		log.Println("[WAITLIST] error recuperando turnos libres:", err)
+		return
+	}
+
+	offered := make(map[uint]bool, len(entry.Offers))
+	for _, o := range entry.Offers {
+		offered[o.SlotID] = true
+	}
+
+	for i, slot := range free {
+		if offered[slot.ID] || !s.fits(ctx, entry.ID, free, i) {
+			continue
+		}
+
+		if err := s.offer(ctx, entry.ID, slot.ID); err == nil {
+			return
+		}
+	}
+}
+
+func (s *WaitlistService) offer(ctx context.Context, entryID, slotID uint) error {
+
+	offer := &waitlist.WaitlistOffer{
+		WaitlistEntryID: entryID,
+		SlotID:          slotID,
+		Status:          "ofrecido",
+		ExpiresAt:       time.Now().Add(s.hold),
+	}
+
+	if err := s.waitlistRepo.CreateOffer(ctx, offer); err != nil {
+		return err
+	}
+
+	log.Printf("[WAITLIST] turno %d ofrecido a la anotacion %d hasta %s", slotID, entryID, offer.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// Indica si desde free[i] hay turnos libres consecutivos del mismo barbero para los servicios
+func (s *WaitlistService) fits(ctx context.Context, entryID uint, free []waitlist.Slot, i int) bool {
+
+	duration, err := s.waitlistRepo.ServicesDuration(ctx, entryID)
+	if err != nil {
+		return false
+	}
+
+	var (
+		needed  = time.Duration(duration) * time.Minute
+		covered = free[i].End.Sub(free[i].Start)
+		cursor  = free[i].End
+	)
+
+	for j := i + 1; j < len(free) && covered < needed; j++ {
+		if free[j].Start.After(cursor) {
+			break
+		}
+		if free[j].BarberID != free[i].BarberID || !free[j].Start.Equal(cursor) {
+			continue
+		}
+		covered += free[j].End.Sub(free[j].Start)
+		cursor = free[j].End
+	}
+
+	return covered >= needed
+}
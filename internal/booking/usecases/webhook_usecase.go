@@ -0,0 +1,238 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+	"github.com/ezep02/rodeo/internal/booking/domain/payments"
+)
+
+const (
+	// Intentos antes de dar una notificacion por fallida
+	MaxWebhookAttempts = 8
+
+	// Primer reintento, luego se duplica en cada intento
+	webhookRetryBase = time.Minute
+
+	// Si el proceso se corta antes de terminar, la notificacion se retoma pasado este tiempo
+	webhookLease = 2 * time.Minute
+)
+
+type WebhookService struct {
+	webhookRepo payments.WebhookRepository
+	gateway     payments.Gateway
+	bookingSvc  *BookingService
+	paymentSvc  *PaymentService
+	seriesSvc   *SeriesService
+}
+
+func NewWebhookService(webhookRepo payments.WebhookRepository, gateway payments.Gateway, bookingSvc *BookingService, paymentSvc *PaymentService, seriesSvc *SeriesService) *WebhookService {
+	return &WebhookService{webhookRepo, gateway, bookingSvc, paymentSvc, seriesSvc}
+}
+
+// Registra y procesa una notificacion del proveedor. Las entregas repetidas se ignoran
+// y las que fallan quedan en la cola de reintentos, por lo que solo devuelve error si no se pudo registrar
+func (s *WebhookService) Handle(ctx context.Context, eventID, topic, resourceID string) (bool, error) {
+
+	if eventID == "" || resourceID == "" {
+		return false, payments.ErrMissingWebhookData
+	}
+
+	if topic != payments.TopicPayment && topic != payments.TopicReschedule {
+		return false, errors.New("topico de notificacion invalido")
+	}
+
+	lease := time.Now().Add(webhookLease)
+	event := &payments.WebhookEvent{
+		EventID:       eventID,
+		Topic:         topic,
+		ResourceID:    resourceID,
+		Status:        "pendiente",
+		NextAttemptAt: &lease,
+	}
+
+	// 1. Registrar, si ya existia es una entrega repetida
+	created, err := s.webhookRepo.Create(ctx, event)
+	if err != nil {
+		return false, errors.New("no fue posible registrar la notificacion")
+	}
+
+	if !created {
+		return false, nil
+	}
+
+	// 2. Procesar, si falla se reintenta desde la cola
+	s.run(ctx, event)
+
+	return true, nil
+}
+
+// Reintenta las notificaciones pendientes cuyo turno ya llego
+func (s *WebhookService) RetryPending(ctx context.Context) {
+
+	events, err := s.webhookRepo.Due(ctx, time.Now(), 50)
+	if err != nil {
+		log.Println("[WEBHOOK] error recuperando notificaciones pendientes:", err)
+		return
+	}
+
+	for i := range events {
+		s.run(ctx, &events[i])
+	}
+}
+
+func (s *WebhookService) StartWebhookRetryJob(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.RetryPending(ctx)
+			}
+		}
+	}()
+}
+
+func (s *WebhookService) run(ctx context.Context, event *payments.WebhookEvent) {
+
+	if err := s.process(ctx, event); err != nil {
+
+		var next *time.Time
+		if attempt := event.Attempts + 1; attempt < MaxWebhookAttempts {
+			at := time.Now().Add(webhookRetryBase * time.Duration(math.Pow(2, float64(attempt-1))))
+			next = &at
+		}
+
+		log.Printf("[WEBHOOK] error procesando la notificacion %s (intento %d): %s", event.EventID, event.Attempts+1, err)
+		if err := s.webhookRepo.MarkFailed(ctx, event.ID, err.Error(), next); err != nil {
+			log.Println("[WEBHOOK] error registrando el fallo:", err)
+		}
+		return
+	}
+
+	if err := s.webhookRepo.MarkProcessed(ctx, event.ID); err != nil {
+		log.Println("[WEBHOOK] error marcando la notificacion como procesada:", err)
+	}
+}
+
+func (s *WebhookService) process(ctx context.Context, event *payments.WebhookEvent) error {
+
+	// 1. Consultar el pago en el proveedor, nunca se confia en el contenido de la notificacion
+	paymentInfo, err := s.gateway.GetPayment(ctx, event.ResourceID)
+	if err != nil {
+		return err
+	}
+
+	switch event.Topic {
+	case payments.TopicReschedule:
+		return s.processReschedule(ctx, paymentInfo)
+	default:
+		return s.processPayment(ctx, paymentInfo)
+	}
+}
+
+func (s *WebhookService) processPayment(ctx context.Context, paymentInfo *payments.ProviderPayment) error {
+
+	// 1. Si el pago tiene devoluciones, la notificacion confirma la devolucion y no un cobro
+	isRefund, err := s.paymentSvc.ConfirmRefunds(ctx, paymentInfo)
+	if err != nil {
+		return err
+	}
+
+	if isRefund || paymentInfo.Status != "aprobado" {
+		return nil
+	}
+
+	// 2. El pago de una serie prepaga confirma todos sus turnos
+	if _, ok := paymentInfo.Metadata["series_id"]; ok {
+		seriesID, err := metadataID(paymentInfo.Metadata, "series_id")
+		if err != nil {
+			return err
+		}
+		return s.seriesSvc.MarkAsPaid(ctx, seriesID, paymentInfo)
+	}
+
+	// El pago de una reserva grupal confirma la reserva de cada asistente
+	if _, ok := paymentInfo.Metadata["group_id"]; ok {
+		groupID, err := metadataID(paymentInfo.Metadata, "group_id")
+		if err != nil {
+			return err
+		}
+		return s.bookingSvc.MarkGroupAsPaid(ctx, groupID, paymentInfo)
+	}
+
+	// 3. Leer metadata
+	bookingID, err := metadataID(paymentInfo.Metadata, "booking_id")
+	if err != nil {
+		return err
+	}
+
+	paymentID, err := metadataID(paymentInfo.Metadata, "payment_id")
+	if err != nil {
+		return err
+	}
+
+	// 4. Actualizar payment y booking
+	if err := s.paymentSvc.MarkAsPaid(ctx, paymentID, paymentInfo.ID); err != nil {
+		return fmt.Errorf("payment fallo actualizando status a pagado: %w", err)
+	}
+
+	if err := s.bookingSvc.MarkAsPaid(ctx, bookingID, booking.SystemActor()); err != nil {
+		// Reintentar no cambia el resultado, el pago queda aprobado y se resuelve a mano
+		if errors.Is(err, booking.ErrBookingExpired) || booking.IsTransitionError(err) {
+			return s.bookingSvc.ReportUnconfirmedPayment(ctx, paymentID, paymentInfo, err)
+		}
+		return fmt.Errorf("booking fallo actualizando status a confirmado: %w", err)
+	}
+
+	return nil
+}
+
+func (s *WebhookService) processReschedule(ctx context.Context, paymentInfo *payments.ProviderPayment) error {
+
+	if paymentInfo.Status != "aprobado" {
+		return nil
+	}
+
+	// 1. Leer metadata
+	bookingID, err := metadataID(paymentInfo.Metadata, "booking_id")
+	if err != nil {
+		return err
+	}
+
+	slotID, err := metadataID(paymentInfo.Metadata, "slot_id")
+	if err != nil {
+		return err
+	}
+
+	// 2. Realizar reprogramacion
+	if err := s.bookingSvc.RescheduleWithSurcharge(ctx, bookingID, slotID, paymentInfo); err != nil {
+		if booking.IsTransitionError(err) {
+			log.Printf("[WEBHOOK] el recargo %s no pudo reprogramar la reserva %d: %s", paymentInfo.ID, bookingID, err)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Lee un id de la metadata del proveedor, que llega como numero JSON (float64)
+func metadataID(metadata map[string]any, key string) (uint, error) {
+
+	value, ok := metadata[key].(float64)
+	if !ok || value <= 0 || value != math.Trunc(value) {
+		return 0, fmt.Errorf("metadata %s invalida", key)
+	}
+
+	return uint(value), nil
+}
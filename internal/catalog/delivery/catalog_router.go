@@ -6,6 +6,8 @@ import (
 	"github.com/ezep02/rodeo/internal/catalog/delivery/http"
 	"github.com/ezep02/rodeo/internal/catalog/repository"
 	"github.com/ezep02/rodeo/internal/catalog/usecase"
+	pricingRepository "github.com/ezep02/rodeo/internal/pricing/repository"
+	pricingUsecase "github.com/ezep02/rodeo/internal/pricing/usecase"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -27,6 +29,10 @@ func NewCatalogRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client) {
 	promoRepo := repository.NewGormPromoRepo(cnn, redis)
 	promoSvc := usecase.NewPromoService(promoRepo)
 
+	// Motor de precios compartido con las reservas
+	pricingRepo := pricingRepository.NewGormPricingRepo(cnn, redis)
+	pricingSvc := pricingUsecase.NewPricingService(pricingRepo)
+
 	// Repositorio y caso de uso de medias
 	mediaRepo := repository.NewGormMediaRepo(cnn, redis)
 	mediaSvc := usecase.NewMediaService(mediaRepo)
@@ -50,8 +56,9 @@ func NewCatalogRoutes(r *gin.RouterGroup, cnn *gorm.DB, redis *redis.Client) {
 	// TODO: Aqui crear los endpoint necesarios para realizar operaciones crud para PROMOCIONES
 	promo := r.Group("/promotion")
 	{
-		promoHandler := http.NewPromoHandler(promoSvc)
+		promoHandler := http.NewPromoHandler(promoSvc, pricingSvc)
 		promo.POST("/", promoHandler.Create)
+		promo.GET("/active/:id", promoHandler.Active)
 		promo.GET("/page/:id/:offset", promoHandler.ListByServiceId)
 		promo.PUT("/:id", promoHandler.Update)
 		promo.DELETE("/:id", promoHandler.Delete)
@@ -5,19 +5,22 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/ezep02/rodeo/internal/catalog/domain/promotions"
 	"github.com/ezep02/rodeo/internal/catalog/usecase"
+	pricing "github.com/ezep02/rodeo/internal/pricing/usecase"
 	"github.com/ezep02/rodeo/pkg/jwt"
 	"github.com/gin-gonic/gin"
 )
 
 type PromoHandler struct {
-	promoSvc *usecase.PromoService
+	promoSvc   *usecase.PromoService
+	pricingSvc *pricing.PricingService
 }
 
-func NewPromoHandler(promoSvc *usecase.PromoService) *PromoHandler {
-	return &PromoHandler{promoSvc}
+func NewPromoHandler(promoSvc *usecase.PromoService, pricingSvc *pricing.PricingService) *PromoHandler {
+	return &PromoHandler{promoSvc, pricingSvc}
 }
 
 type CreatePromoReq struct {
@@ -193,3 +196,27 @@ func (h *PromoHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "promocion eliminada correctamente"})
 }
+
+// Devuelve el precio vigente de un servicio con la mejor promocion activa aplicada
+func (h *PromoHandler) Active(c *gin.Context) {
+
+	var (
+		svcIdStr = c.Param("id")
+	)
+
+	// 1. Parsear id
+	parsedSvcId, err := strconv.ParseUint(svcIdStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando datos"})
+		return
+	}
+
+	// 2. Cotizar el servicio en este momento
+	price, err := h.pricingSvc.ActivePromotion(c.Request.Context(), uint(parsedSvcId), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
@@ -50,6 +50,7 @@ func (h *ServiceHandler) Create(c *gin.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
+		Duration:    req.Duration,
 	}
 
 	if err := h.svc.Create(c, req_constructor); err != nil {
@@ -140,6 +141,7 @@ func (h *ServiceHandler) Update(c *gin.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
+		Duration:    req.Duration,
 		IsActive:    req.IsActive,
 		ID:          id,
 	}
@@ -9,6 +9,7 @@ type Service struct {
 	Name        string    `json:"name" gorm:"size:100;not null"`
 	Description string    `json:"description" gorm:"type:text"`
 	Price       float64   `json:"price" gorm:"type:decimal(10,2);not null"`
+	Duration    int       `json:"duration_minutes" gorm:"column:duration_minutes;default:30;not null"`
 	IsActive    bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
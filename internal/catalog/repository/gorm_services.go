@@ -99,12 +99,13 @@ func (r *GormServiceRepository) Update(ctx context.Context, id uint, data *servi
 	}
 
 	updates := map[string]any{
-		"name":        data.Name,
-		"price":       data.Price,
-		"description": data.Description,
-		"preview_url": data.PreviewURL,
-		"is_active":   data.IsActive,
-		"updated_at":  time.Now(),
+		"name":             data.Name,
+		"price":            data.Price,
+		"duration_minutes": data.Duration,
+		"description":      data.Description,
+		"preview_url":      data.PreviewURL,
+		"is_active":        data.IsActive,
+		"updated_at":       time.Now(),
 	}
 
 	if err := r.db.WithContext(ctx).Model(&service.Service{}).Where("id = ?", id).Updates(updates).Error; err != nil {
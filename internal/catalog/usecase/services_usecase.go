@@ -27,6 +27,15 @@ func (s *ServicesService) Create(ctx context.Context, service *service.Service)
 		return errors.New("el producto debe tener un precio mayor o igual a cero")
 	}
 
+	// 3. Validar la duracion, por defecto un turno de 30 minutos
+	if service.Duration == 0 {
+		service.Duration = 30
+	}
+
+	if service.Duration < 0 {
+		return errors.New("la duracion del servicio debe ser mayor a cero")
+	}
+
 	return s.svcRepo.Create(ctx, service)
 }
 
@@ -49,6 +58,11 @@ func (s *ServicesService) Update(ctx context.Context, id uint, service *service.
 		return errors.New("el servicio debe tener un precio mayor o igual a cero")
 	}
 
+	// 3. Validar la duracion
+	if service.Duration <= 0 {
+		return errors.New("la duracion del servicio debe ser mayor a cero")
+	}
+
 	return s.svcRepo.Update(ctx, id, service)
 }
 
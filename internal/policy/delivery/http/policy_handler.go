@@ -0,0 +1,170 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ezep02/rodeo/internal/policy/domain"
+	"github.com/ezep02/rodeo/internal/policy/usecase"
+	"github.com/ezep02/rodeo/pkg/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+type PolicyHandler struct {
+	policySvc *usecase.PolicyService
+}
+
+func NewPolicyHandler(policySvc *usecase.PolicyService) *PolicyHandler {
+	return &PolicyHandler{policySvc}
+}
+
+func (h *PolicyHandler) List(c *gin.Context) {
+
+	// 1. Validar sesion del usuario
+	if !h.authorize(c) {
+		return
+	}
+
+	rules, err := h.policySvc.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no fue posible recuperar las reglas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *PolicyHandler) Create(c *gin.Context) {
+
+	var req domain.PolicyRule
+
+	// 1. Validar sesion del usuario
+	if !h.authorize(c) {
+		return
+	}
+
+	// 2. Parsing de datos
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	req.ID = 0
+	if err := h.policySvc.Create(c.Request.Context(), &req); err != nil {
+		c.JSON(policyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, req)
+}
+
+func (h *PolicyHandler) Update(c *gin.Context) {
+
+	var req domain.PolicyRule
+
+	// 1. Validar sesion del usuario
+	if !h.authorize(c) {
+		return
+	}
+
+	// 2. Parsing de datos
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando datos"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	if err := h.policySvc.Update(c.Request.Context(), uint(id), &req); err != nil {
+		c.JSON(policyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	req.ID = uint(id)
+	c.JSON(http.StatusOK, req)
+}
+
+func (h *PolicyHandler) Delete(c *gin.Context) {
+
+	// 1. Validar sesion del usuario
+	if !h.authorize(c) {
+		return
+	}
+
+	// 2. Parsing de datos
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando datos"})
+		return
+	}
+
+	if err := h.policySvc.Delete(c.Request.Context(), uint(id)); err != nil {
+		c.JSON(policyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "regla eliminada correctamente"})
+}
+
+func (h *PolicyHandler) GetNoShow(c *gin.Context) {
+
+	// 1. Validar sesion del usuario
+	if !h.authorize(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.policySvc.NoShow(c.Request.Context()))
+}
+
+func (h *PolicyHandler) UpdateNoShow(c *gin.Context) {
+
+	var req domain.NoShowPolicy
+
+	// 1. Validar sesion del usuario
+	if !h.authorize(c) {
+		return
+	}
+
+	// 2. Parsing de datos
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "algo no fue bien recuperando los datos de la consulta"})
+		return
+	}
+
+	if err := h.policySvc.UpdateNoShow(c.Request.Context(), &req); err != nil {
+		c.JSON(policyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// Solo los administradores pueden editar la politica
+func (h *PolicyHandler) authorize(c *gin.Context) bool {
+
+	existing, err := jwt.VerifyUserSession(c, os.Getenv("AUTH_TOKEN"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if !existing.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene autorizacion"})
+		return false
+	}
+
+	return true
+}
+
+func policyErrorStatus(err error) int {
+	if errors.Is(err, domain.ErrRuleNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
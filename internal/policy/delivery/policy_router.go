@@ -0,0 +1,32 @@
+package delivery
+
+import (
+	"log"
+
+	"github.com/ezep02/rodeo/internal/policy/delivery/http"
+	"github.com/ezep02/rodeo/internal/policy/repository"
+	"github.com/ezep02/rodeo/internal/policy/usecase"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+func NewPolicyRouter(r *gin.RouterGroup, db *gorm.DB, redis *redis.Client) {
+
+	log.Println("[POLICY ROUTES] Setting up policy routes")
+
+	policyRepo := repository.NewGormPolicyRepo(db, redis)
+	policySvc := usecase.NewPolicyService(policyRepo)
+
+	// Reglas de cancelacion, reprogramacion y ausencias, solo administradores
+	policy := r.Group("/policy")
+	{
+		policyHandler := http.NewPolicyHandler(policySvc)
+		policy.GET("/rules", policyHandler.List)
+		policy.POST("/rules", policyHandler.Create)
+		policy.PUT("/rules/:id", policyHandler.Update)
+		policy.DELETE("/rules/:id", policyHandler.Delete)
+		policy.GET("/no-show", policyHandler.GetNoShow)
+		policy.PUT("/no-show", policyHandler.UpdateNoShow)
+	}
+}
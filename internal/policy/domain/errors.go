@@ -0,0 +1,10 @@
+package domain
+
+import "errors"
+
+var (
+	ErrRuleNotFound   = errors.New("la regla no existe")
+	ErrInvalidAction  = errors.New("la accion debe ser cancelacion o reprogramacion")
+	ErrInvalidOutcome = errors.New("el resultado no es valido para la accion")
+	ErrInvalidNoShow  = errors.New("la politica de ausencias solo admite pierde_sena o cupon")
+)
@@ -0,0 +1,15 @@
+package domain
+
+import "context"
+
+type PolicyRepository interface {
+	List(ctx context.Context) ([]PolicyRule, error)
+	ActiveByAction(ctx context.Context, action string) ([]PolicyRule, error)
+	GetByID(ctx context.Context, id uint) (*PolicyRule, error)
+	Create(ctx context.Context, rule *PolicyRule) error
+	Update(ctx context.Context, id uint, rule *PolicyRule) error
+	Delete(ctx context.Context, id uint) error
+	// Politica de ausencias, nil si nunca se configuro
+	GetNoShow(ctx context.Context) (*NoShowPolicy, error)
+	SaveNoShow(ctx context.Context, policy *NoShowPolicy) error
+}
@@ -0,0 +1,79 @@
+package domain
+
+import "time"
+
+// Acciones sobre una reserva evaluadas por la politica
+const (
+	ActionCancel     = "cancelacion"
+	ActionReschedule = "reprogramacion"
+)
+
+// Resultados posibles de una regla
+const (
+	OutcomeCoupon         = "cupon"       // se entrega un cupon por el porcentaje de lo abonado
+	OutcomeRefund         = "reembolso"   // se devuelve el porcentaje de lo abonado
+	OutcomeForfeitDeposit = "pierde_sena" // se pierde lo abonado
+	OutcomeSurcharge      = "recargo"     // se cobra un recargo del porcentaje de lo abonado
+	OutcomeFree           = "sin_cargo"   // sin costo ni devolucion
+)
+
+// Regla de cancelacion o reprogramacion para un tramo de horas de anticipacion.
+// Las reglas con ServiceID o BarberID pisan a las generales para ese servicio o barbero.
+type PolicyRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Action      string    `gorm:"type:enum('cancelacion','reprogramacion');not null" json:"action"`
+	BarberID    *uint     `gorm:"default:null" json:"barber_id"`                                  // override por barbero
+	ServiceID   *uint     `gorm:"default:null" json:"service_id"`                                 // override por servicio
+	PaymentType string    `gorm:"type:enum('','total','parcial');default:''" json:"payment_type"` // vacio = cualquiera
+	MinHours    int       `gorm:"not null;default:0" json:"min_hours"`                            // horas de anticipacion desde (inclusive)
+	MaxHours    *int      `gorm:"default:null" json:"max_hours"`                                  // hasta (exclusive), nil = sin limite
+	Outcome     string    `gorm:"type:enum('cupon','reembolso','pierde_sena','recargo','sin_cargo');not null" json:"outcome"`
+	Percentage  int       `gorm:"not null;default:0" json:"percentage"`
+	AllowChoice bool      `gorm:"default:false" json:"allow_choice"` // el cliente puede elegir cupon o reembolso
+	Message     string    `gorm:"size:255" json:"message"`
+	IsActive    *bool     `gorm:"default:true" json:"is_active"` // nil al editar = no cambia
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Datos de la reserva sobre los que se evalua la politica
+type Subject struct {
+	Action      string
+	BarberID    uint
+	ServiceIDs  []uint
+	PaymentType string // total o parcial
+	Start       time.Time
+	At          time.Time // momento de la evaluacion, por defecto ahora
+}
+
+// Resultado de evaluar la politica
+type Decision struct {
+	RuleID      *uint   `json:"rule_id"` // nil si se aplico la politica por defecto
+	Action      string  `json:"action"`
+	Outcome     string  `json:"outcome"`
+	Percentage  int     `json:"percentage"`
+	HoursBefore float64 `json:"hours_before"`
+	AllowChoice bool    `json:"allow_choice"`
+	Message     string  `json:"message"`
+}
+
+// Politica de ausencias, una unica configuracion para todo el local. Define que pasa con lo
+// abonado cuando el cliente no se presenta y a partir de cuantas ausencias se le exige pagar
+// el total al reservar
+type NoShowPolicy struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Outcome     string    `gorm:"type:enum('pierde_sena','cupon');not null;default:'pierde_sena'" json:"outcome"`
+	Percentage  int       `gorm:"not null;default:0" json:"percentage"`   // porcentaje de lo abonado devuelto como cupon
+	PrepayAfter int       `gorm:"not null;default:0" json:"prepay_after"` // ausencias que exigen pago total, 0 = nunca
+	WindowDays  int       `gorm:"not null;default:0" json:"window_days"`  // dias en que se cuentan las ausencias, 0 = siempre
+	Message     string    `gorm:"size:255" json:"message"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Desde cuando se cuentan las ausencias del cliente, el tiempo cero cuenta todas
+func (p *NoShowPolicy) Since(now time.Time) time.Time {
+	if p.WindowDays <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -p.WindowDays)
+}
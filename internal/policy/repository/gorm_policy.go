@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/policy/domain"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type GormPolicyRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormPolicyRepo(db *gorm.DB, redis *redis.Client) domain.PolicyRepository {
+	return &GormPolicyRepository{db, redis}
+}
+
+func (r *GormPolicyRepository) List(ctx context.Context) ([]domain.PolicyRule, error) {
+	var rules []domain.PolicyRule
+
+	if err := r.db.WithContext(ctx).
+		Order("action ASC, min_hours DESC, id ASC").
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Reglas activas de la accion, se cachean porque se evaluan en cada cotizacion y cancelacion
+func (r *GormPolicyRepository) ActiveByAction(ctx context.Context, action string) ([]domain.PolicyRule, error) {
+
+	var (
+		rules    []domain.PolicyRule
+		cacheKey = fmt.Sprintf("policy:%s", action)
+	)
+
+	if cached, err := r.redis.Get(ctx, cacheKey).Result(); err == nil {
+		if err := json.Unmarshal([]byte(cached), &rules); err == nil {
+			return rules, nil
+		}
+	}
+
+	if err := r.db.WithContext(ctx).
+		Where("action = ? AND is_active = ?", action, true).
+		Order("id ASC").
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	if raw, err := json.Marshal(rules); err == nil {
+		if err := r.redis.Set(ctx, cacheKey, raw, 10*time.Minute).Err(); err != nil {
+			log.Println("Error cacheando politicas:", err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *GormPolicyRepository) GetByID(ctx context.Context, id uint) (*domain.PolicyRule, error) {
+	var rule domain.PolicyRule
+
+	if err := r.db.WithContext(ctx).Where("id = ?", id).Take(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrRuleNotFound
+		}
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func (r *GormPolicyRepository) Create(ctx context.Context, rule *domain.PolicyRule) error {
+	if err := r.db.WithContext(ctx).Create(rule).Error; err != nil {
+		return err
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+// Reemplaza la regla, is_active solo cambia si se envio para no desactivar reglas al editarlas
+func (r *GormPolicyRepository) Update(ctx context.Context, id uint, rule *domain.PolicyRule) error {
+
+	fields := map[string]any{
+		"action":       rule.Action,
+		"barber_id":    rule.BarberID,
+		"service_id":   rule.ServiceID,
+		"payment_type": rule.PaymentType,
+		"min_hours":    rule.MinHours,
+		"max_hours":    rule.MaxHours,
+		"outcome":      rule.Outcome,
+		"percentage":   rule.Percentage,
+		"allow_choice": rule.AllowChoice,
+		"message":      rule.Message,
+	}
+
+	if rule.IsActive != nil {
+		fields["is_active"] = *rule.IsActive
+	}
+
+	if err := r.db.WithContext(ctx).
+		Model(&domain.PolicyRule{}).
+		Where("id = ?", id).
+		Updates(fields).Error; err != nil {
+		return err
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+func (r *GormPolicyRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.PolicyRule{}, id).Error; err != nil {
+		return err
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+// Politica de ausencias, se cachea porque se consulta en cada checkout
+func (r *GormPolicyRepository) GetNoShow(ctx context.Context) (*domain.NoShowPolicy, error) {
+
+	var (
+		policy   domain.NoShowPolicy
+		cacheKey = "policy:ausencia"
+	)
+
+	if cached, err := r.redis.Get(ctx, cacheKey).Result(); err == nil {
+		if err := json.Unmarshal([]byte(cached), &policy); err == nil {
+			return &policy, nil
+		}
+	}
+
+	if err := r.db.WithContext(ctx).Order("id ASC").Take(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if raw, err := json.Marshal(policy); err == nil {
+		if err := r.redis.Set(ctx, cacheKey, raw, 10*time.Minute).Err(); err != nil {
+			log.Println("Error cacheando politica de ausencias:", err)
+		}
+	}
+
+	return &policy, nil
+}
+
+// Guarda la politica de ausencias, siempre en la misma fila
+func (r *GormPolicyRepository) SaveNoShow(ctx context.Context, policy *domain.NoShowPolicy) error {
+	policy.ID = 1
+	if err := r.db.WithContext(ctx).Save(policy).Error; err != nil {
+		return err
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+func (r *GormPolicyRepository) invalidate(ctx context.Context) {
+	if err := r.redis.Del(ctx, "policy:"+domain.ActionCancel, "policy:"+domain.ActionReschedule, "policy:ausencia").Err(); err != nil {
+		log.Println("Error invalidando cache de politicas:", err)
+	}
+}
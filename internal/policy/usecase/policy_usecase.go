@@ -0,0 +1,341 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/policy/domain"
+)
+
+type PolicyService struct {
+	policyRepo domain.PolicyRepository
+}
+
+func NewPolicyService(policyRepo domain.PolicyRepository) *PolicyService {
+	return &PolicyService{policyRepo}
+}
+
+// Politica por defecto, se aplica cuando ninguna regla de la base coincide
+var defaultRules = []domain.PolicyRule{
+	{Action: domain.ActionCancel, PaymentType: "total", MaxHours: intPtr(24), Outcome: domain.OutcomeCoupon, Percentage: 50,
+		Message: "La cancelación está dentro de las 24 horas. Recibirás un cupón del 50%."},
+	{Action: domain.ActionCancel, PaymentType: "parcial", MaxHours: intPtr(24), Outcome: domain.OutcomeForfeitDeposit,
+		Message: "La cancelación está dentro de las 24 horas. Perderás la seña abonada."},
+	{Action: domain.ActionCancel, PaymentType: "total", MinHours: 24, Outcome: domain.OutcomeCoupon, Percentage: 75,
+		Message: "La cancelación está fuera de las 24 horas. Recibirás un cupón del 75%."},
+	{Action: domain.ActionCancel, PaymentType: "parcial", MinHours: 24, Outcome: domain.OutcomeCoupon, Percentage: 25,
+		Message: "La cancelación está fuera de las 24 horas. Recibirás un cupón del 25%."},
+	{Action: domain.ActionReschedule, PaymentType: "total", MaxHours: intPtr(24), Outcome: domain.OutcomeSurcharge, Percentage: 25,
+		Message: "La reprogramación es dentro de las 24 horas. Se aplicará un recargo del 25%."},
+	{Action: domain.ActionReschedule, PaymentType: "parcial", MaxHours: intPtr(24), Outcome: domain.OutcomeSurcharge, Percentage: 50,
+		Message: "La reprogramación es dentro de las 24 horas. Se aplicará un recargo del 50%."},
+	{Action: domain.ActionReschedule, MinHours: 24, Outcome: domain.OutcomeFree,
+		Message: "Podés reprogramar sin costo hasta 24 horas antes del turno."},
+	{Action: domain.ActionCancel, Outcome: domain.OutcomeFree},
+	{Action: domain.ActionReschedule, Outcome: domain.OutcomeFree},
+}
+
+// Evalua la politica para la reserva. Entre las reglas que coinciden con el tramo de horas gana
+// la mas especifica: por servicio, luego por barbero, luego general; a igualdad, la que fija el tipo de pago
+func (s *PolicyService) Evaluate(ctx context.Context, subject domain.Subject) (*domain.Decision, error) {
+
+	if subject.Action != domain.ActionCancel && subject.Action != domain.ActionReschedule {
+		return nil, domain.ErrInvalidAction
+	}
+
+	at := subject.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	hours := subject.Start.Sub(at).Hours()
+
+	// 1. Reglas configuradas, si no se pueden leer se aplica la politica por defecto
+	rules, err := s.policyRepo.ActiveByAction(ctx, subject.Action)
+	if err != nil {
+		log.Println("[POLICY] error recuperando reglas, se usa la politica por defecto:", err)
+		rules = nil
+	}
+
+	rule := bestMatch(rules, subject, hours)
+	if rule == nil {
+		rule = bestMatch(defaultRules, subject, hours)
+	}
+
+	if rule == nil {
+		return nil, errors.New("no hay una politica aplicable")
+	}
+
+	decision := &domain.Decision{
+		Action:      rule.Action,
+		Outcome:     rule.Outcome,
+		Percentage:  rule.Percentage,
+		HoursBefore: hours,
+		AllowChoice: rule.AllowChoice,
+		Message:     rule.Message,
+	}
+
+	if rule.ID != 0 {
+		id := rule.ID
+		decision.RuleID = &id
+	}
+
+	if decision.Message == "" {
+		decision.Message = defaultMessage(rule)
+	}
+
+	return decision, nil
+}
+
+func (s *PolicyService) List(ctx context.Context) ([]domain.PolicyRule, error) {
+	return s.policyRepo.List(ctx)
+}
+
+func (s *PolicyService) Create(ctx context.Context, rule *domain.PolicyRule) error {
+
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+
+	return s.policyRepo.Create(ctx, rule)
+}
+
+func (s *PolicyService) Update(ctx context.Context, id uint, rule *domain.PolicyRule) error {
+
+	if id == 0 {
+		return errors.New("el id de la regla es necesario")
+	}
+
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+
+	if _, err := s.policyRepo.GetByID(ctx, id); err != nil {
+		return err
+	}
+
+	return s.policyRepo.Update(ctx, id, rule)
+}
+
+func (s *PolicyService) Delete(ctx context.Context, id uint) error {
+
+	if id == 0 {
+		return errors.New("el id de la regla es necesario")
+	}
+
+	if _, err := s.policyRepo.GetByID(ctx, id); err != nil {
+		return err
+	}
+
+	return s.policyRepo.Delete(ctx, id)
+}
+
+// Politica de ausencias por defecto, se aplica mientras no se configure una
+var defaultNoShow = domain.NoShowPolicy{
+	Outcome:     domain.OutcomeForfeitDeposit,
+	PrepayAfter: 2,
+	WindowDays:  180,
+	Message:     "No te presentaste al turno, perdiste la seña abonada.",
+}
+
+// Politica de ausencias vigente, si no se puede leer se aplica la politica por defecto
+func (s *PolicyService) NoShow(ctx context.Context) *domain.NoShowPolicy {
+
+	policy, err := s.policyRepo.GetNoShow(ctx)
+	if err != nil {
+		log.Println("[POLICY] error recuperando la politica de ausencias, se usa la politica por defecto:", err)
+	}
+
+	if policy == nil {
+		defaults := defaultNoShow
+		return &defaults
+	}
+
+	return policy
+}
+
+func (s *PolicyService) UpdateNoShow(ctx context.Context, policy *domain.NoShowPolicy) error {
+
+	if policy == nil {
+		return errors.New("la politica es necesaria")
+	}
+
+	switch policy.Outcome {
+	case domain.OutcomeCoupon:
+		if policy.Percentage <= 0 || policy.Percentage > 100 {
+			return errors.New("el porcentaje debe estar entre 1 y 100")
+		}
+	case domain.OutcomeForfeitDeposit:
+		policy.Percentage = 0
+	default:
+		return domain.ErrInvalidNoShow
+	}
+
+	if policy.PrepayAfter < 0 || policy.WindowDays < 0 {
+		return errors.New("las ausencias y los dias no pueden ser negativos")
+	}
+
+	if policy.Message == "" {
+		policy.Message = noShowMessage(policy)
+	}
+
+	return s.policyRepo.SaveNoShow(ctx, policy)
+}
+
+func noShowMessage(policy *domain.NoShowPolicy) string {
+	if policy.Outcome == domain.OutcomeCoupon {
+		return fmt.Sprintf("No te presentaste al turno, recibirás un cupón del %d%% de lo abonado.", policy.Percentage)
+	}
+	return "No te presentaste al turno, perdiste la seña abonada."
+}
+
+func validateRule(rule *domain.PolicyRule) error {
+
+	if rule == nil {
+		return errors.New("la regla es necesaria")
+	}
+
+	switch rule.Action {
+	case domain.ActionCancel:
+		if !slices.Contains([]string{domain.OutcomeCoupon, domain.OutcomeRefund, domain.OutcomeForfeitDeposit, domain.OutcomeFree}, rule.Outcome) {
+			return domain.ErrInvalidOutcome
+		}
+	case domain.ActionReschedule:
+		if !slices.Contains([]string{domain.OutcomeSurcharge, domain.OutcomeFree}, rule.Outcome) {
+			return domain.ErrInvalidOutcome
+		}
+	default:
+		return domain.ErrInvalidAction
+	}
+
+	if rule.PaymentType != "" && rule.PaymentType != "total" && rule.PaymentType != "parcial" {
+		return errors.New("el tipo de pago debe ser total o parcial")
+	}
+
+	if rule.MinHours < 0 {
+		return errors.New("las horas minimas no pueden ser negativas")
+	}
+
+	if rule.MaxHours != nil && *rule.MaxHours <= rule.MinHours {
+		return errors.New("las horas maximas deben ser mayores a las minimas")
+	}
+
+	// Solo se puede elegir entre cupon y reembolso
+	if rule.Outcome != domain.OutcomeCoupon && rule.Outcome != domain.OutcomeRefund {
+		rule.AllowChoice = false
+	}
+
+	switch rule.Outcome {
+	case domain.OutcomeCoupon, domain.OutcomeRefund, domain.OutcomeSurcharge:
+		if rule.Percentage <= 0 || rule.Percentage > 100 {
+			return errors.New("el porcentaje debe estar entre 1 y 100")
+		}
+	default:
+		rule.Percentage = 0
+	}
+
+	return nil
+}
+
+// Devuelve la regla mas especifica que coincide, a igualdad gana la de menor id
+func bestMatch(rules []domain.PolicyRule, subject domain.Subject, hours float64) *domain.PolicyRule {
+
+	var (
+		best      *domain.PolicyRule
+		bestScore = -1
+	)
+
+	for i := range rules {
+		rule := &rules[i]
+
+		if !matches(rule, subject, hours) {
+			continue
+		}
+
+		score := 0
+		if rule.ServiceID != nil {
+			score += 4
+		}
+		if rule.BarberID != nil {
+			score += 2
+		}
+		if rule.PaymentType != "" {
+			score++
+		}
+
+		if score > bestScore || (score == bestScore && rule.ID < best.ID) {
+			best, bestScore = rule, score
+		}
+	}
+
+	return best
+}
+
+func matches(rule *domain.PolicyRule, subject domain.Subject, hours float64) bool {
+
+	if rule.Action != subject.Action {
+		return false
+	}
+
+	if rule.BarberID != nil && *rule.BarberID != subject.BarberID {
+		return false
+	}
+
+	if rule.ServiceID != nil && !slices.Contains(subject.ServiceIDs, *rule.ServiceID) {
+		return false
+	}
+
+	if rule.PaymentType != "" && rule.PaymentType != subject.PaymentType {
+		return false
+	}
+
+	if hours < float64(rule.MinHours) {
+		return false
+	}
+
+	if rule.MaxHours != nil && hours >= float64(*rule.MaxHours) {
+		return false
+	}
+
+	return true
+}
+
+func defaultMessage(rule *domain.PolicyRule) string {
+
+	window := "en cualquier momento"
+	if rule.MinHours > 0 {
+		window = fmt.Sprintf("con %d horas o mas de anticipacion", rule.MinHours)
+	}
+	if rule.MaxHours != nil {
+		window = fmt.Sprintf("dentro de las %d horas previas al turno", *rule.MaxHours)
+		if rule.MinHours > 0 {
+			window = fmt.Sprintf("entre %d y %d horas antes del turno", rule.MinHours, *rule.MaxHours)
+		}
+	}
+
+	if rule.Action == domain.ActionReschedule {
+		if rule.Outcome == domain.OutcomeSurcharge {
+			return fmt.Sprintf("La reprogramación %s tiene un recargo del %d%%.", window, rule.Percentage)
+		}
+		return fmt.Sprintf("La reprogramación %s no tiene costo.", window)
+	}
+
+	switch rule.Outcome {
+	case domain.OutcomeCoupon:
+		return fmt.Sprintf("La cancelación %s te otorga un cupón del %d%%.", window, rule.Percentage)
+	case domain.OutcomeRefund:
+		return fmt.Sprintf("La cancelación %s te devuelve el %d%% de lo abonado.", window, rule.Percentage)
+	case domain.OutcomeForfeitDeposit:
+		return fmt.Sprintf("La cancelación %s implica perder la seña abonada.", window)
+	default:
+		return fmt.Sprintf("La cancelación %s no tiene costo.", window)
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/ezep02/rodeo/internal/policy/domain"
+)
+
+func uintPtr(v uint) *uint { return &v }
+
+// Tramos generales de cancelacion: menos de 24 horas, de 24 a 48 y 48 o mas
+func tiers() []domain.PolicyRule {
+	return []domain.PolicyRule{
+		{ID: 1, Action: domain.ActionCancel, MinHours: 0, MaxHours: intPtr(24), Outcome: domain.OutcomeForfeitDeposit},
+		{ID: 2, Action: domain.ActionCancel, MinHours: 24, MaxHours: intPtr(48), Outcome: domain.OutcomeCoupon},
+		{ID: 3, Action: domain.ActionCancel, MinHours: 48, Outcome: domain.OutcomeRefund},
+	}
+}
+
+func TestBestMatchTierBoundaries(t *testing.T) {
+
+	subject := domain.Subject{Action: domain.ActionCancel, BarberID: 7, ServiceIDs: []uint{1}, PaymentType: "parcial"}
+
+	cases := []struct {
+		name  string
+		hours float64
+		want  uint
+	}{
+		{"turno inminente", 0, 1},
+		{"justo antes de 24 horas", 23.99, 1},
+		{"24 horas entra en el tramo siguiente", 24, 2},
+		{"justo antes de 48 horas", 47.99, 2},
+		{"48 horas entra en el tramo sin limite", 48, 3},
+		{"mucha anticipacion", 500, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := bestMatch(tiers(), subject, tc.hours)
+			if got == nil || got.ID != tc.want {
+				t.Fatalf("se esperaba la regla %d, se obtuvo %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBestMatchOverridePrecedence(t *testing.T) {
+
+	var (
+		general = domain.PolicyRule{ID: 10, Action: domain.ActionCancel, Outcome: domain.OutcomeRefund}
+		payment = domain.PolicyRule{ID: 11, Action: domain.ActionCancel, PaymentType: "parcial", Outcome: domain.OutcomeCoupon}
+		barber  = domain.PolicyRule{ID: 12, Action: domain.ActionCancel, BarberID: uintPtr(7), Outcome: domain.OutcomeFree}
+		service = domain.PolicyRule{ID: 13, Action: domain.ActionCancel, ServiceID: uintPtr(1), Outcome: domain.OutcomeForfeitDeposit}
+		twin    = domain.PolicyRule{ID: 9, Action: domain.ActionCancel, BarberID: uintPtr(7), Outcome: domain.OutcomeCoupon}
+		other   = domain.PolicyRule{ID: 14, Action: domain.ActionCancel, BarberID: uintPtr(8), ServiceID: uintPtr(2), Outcome: domain.OutcomeFree}
+	)
+
+	subject := domain.Subject{Action: domain.ActionCancel, BarberID: 7, ServiceIDs: []uint{1, 3}, PaymentType: "parcial"}
+
+	cases := []struct {
+		name  string
+		rules []domain.PolicyRule
+		want  uint
+	}{
+		{"solo la general", []domain.PolicyRule{general}, 10},
+		{"el tipo de pago pisa a la general", []domain.PolicyRule{general, payment}, 11},
+		{"el barbero pisa al tipo de pago", []domain.PolicyRule{general, payment, barber}, 12},
+		{"el servicio pisa al barbero", []domain.PolicyRule{general, payment, barber, service}, 13},
+		{"a igual especificidad gana la de menor id", []domain.PolicyRule{barber, twin}, 9},
+		{"las reglas de otro barbero o servicio no aplican", []domain.PolicyRule{other, general}, 10},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := bestMatch(tc.rules, subject, 10)
+			if got == nil || got.ID != tc.want {
+				t.Fatalf("se esperaba la regla %d, se obtuvo %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+
+	subject := domain.Subject{Action: domain.ActionCancel, BarberID: 7, ServiceIDs: []uint{1}, PaymentType: "total"}
+
+	cases := []struct {
+		name  string
+		rule  domain.PolicyRule
+		hours float64
+		want  bool
+	}{
+		{"regla general", domain.PolicyRule{Action: domain.ActionCancel}, 5, true},
+		{"otra accion", domain.PolicyRule{Action: domain.ActionReschedule}, 5, false},
+		{"otro barbero", domain.PolicyRule{Action: domain.ActionCancel, BarberID: uintPtr(8)}, 5, false},
+		{"servicio que no esta en la reserva", domain.PolicyRule{Action: domain.ActionCancel, ServiceID: uintPtr(2)}, 5, false},
+		{"otro tipo de pago", domain.PolicyRule{Action: domain.ActionCancel, PaymentType: "parcial"}, 5, false},
+		{"minimo inclusivo", domain.PolicyRule{Action: domain.ActionCancel, MinHours: 5}, 5, true},
+		{"por debajo del minimo", domain.PolicyRule{Action: domain.ActionCancel, MinHours: 5}, 4.99, false},
+		{"maximo exclusivo", domain.PolicyRule{Action: domain.ActionCancel, MaxHours: intPtr(5)}, 5, false},
+		{"turno ya comenzado", domain.PolicyRule{Action: domain.ActionCancel}, -1, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := tc.rule
+			if got := matches(&rule, subject, tc.hours); got != tc.want {
+				t.Fatalf("se esperaba %v, se obtuvo %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type PricingRepository interface {
+	ServicesByIDs(ctx context.Context, ids []uint) ([]Service, error)
+	ActivePromotions(ctx context.Context, serviceIDs []uint, at time.Time) ([]Promotion, error)
+}
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// Servicio con su precio de lista
+type Service struct {
+	ID       uint64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name     string  `json:"name" gorm:"size:100;not null"`
+	Price    float64 `json:"price" gorm:"type:decimal(10,2);not null"`
+	Duration int     `json:"duration_minutes" gorm:"column:duration_minutes"`
+}
+
+// Promocion vigente de un servicio (percentage o fixed)
+type Promotion struct {
+	ID        uint64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	ServiceID uint64     `json:"service_id" gorm:"not null;index"`
+	Discount  float64    `json:"discount" gorm:"not null"`
+	Type      string     `json:"type" gorm:"type:enum('percentage','fixed');default:'percentage'"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"`
+}
+
+// Precio desglosado de un servicio
+type LineItem struct {
+	ServiceID      uint64     `json:"service_id"`
+	Name           string     `json:"name"`
+	Duration       int        `json:"duration_minutes"`
+	ListPrice      float64    `json:"list_price"`
+	Promotion      *Promotion `json:"promotion,omitempty"`
+	PromoDiscount  float64    `json:"promo_discount"`
+	CouponDiscount float64    `json:"coupon_discount"`
+	FinalPrice     float64    `json:"final_price"`
+}
+
+// Cotizacion completa de un conjunto de servicios
+type Quote struct {
+	Items          []LineItem `json:"items"`
+	ListTotal      float64    `json:"list_total"`
+	PromoDiscount  float64    `json:"promo_discount"`
+	CouponDiscount float64    `json:"coupon_discount"`
+	Total          float64    `json:"total"`
+	Duration       int        `json:"duration_minutes"` // duracion total de los servicios
+	PricedAt       time.Time  `json:"priced_at"`
+}
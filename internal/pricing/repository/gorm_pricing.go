@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/pricing/domain"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type GormPricingRepository struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func NewGormPricingRepo(db *gorm.DB, redis *redis.Client) domain.PricingRepository {
+	return &GormPricingRepository{db, redis}
+}
+
+func (r *GormPricingRepository) ServicesByIDs(ctx context.Context, ids []uint) ([]domain.Service, error) {
+	var list []domain.Service
+
+	if err := r.db.WithContext(ctx).
+		Select("id", "name", "price", "duration_minutes").
+		Where("id IN ?", ids).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Promociones vigentes en el momento indicado, una promocion sin fecha de fin no expira
+func (r *GormPricingRepository) ActivePromotions(ctx context.Context, serviceIDs []uint, at time.Time) ([]domain.Promotion, error) {
+	var list []domain.Promotion
+
+	if err := r.db.WithContext(ctx).
+		Where("service_id IN ?", serviceIDs).
+		Where("start_date <= ?", at).
+		Where("end_date IS NULL OR end_date > ?", at).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
@@ -0,0 +1,165 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/pricing/domain"
+)
+
+type PricingService struct {
+	pricingRepo domain.PricingRepository
+}
+
+func NewPricingService(pricingRepo domain.PricingRepository) *PricingService {
+	return &PricingService{pricingRepo}
+}
+
+// Cotiza los servicios en el momento indicado aplicando la mejor promocion de cada uno
+// y luego el porcentaje del cupon (0 si no hay cupon) sobre el precio promocional.
+func (s *PricingService) Quote(ctx context.Context, serviceIDs []uint, at time.Time, couponPercentage float64) (*domain.Quote, error) {
+
+	if len(serviceIDs) == 0 {
+		return nil, errors.New("debe seleccionar al menos un servicio")
+	}
+
+	if couponPercentage < 0 || couponPercentage > 100 {
+		return nil, errors.New("el porcentaje del cupón es invalido")
+	}
+
+	// 1. Recuperar los servicios
+	svcs, err := s.pricingRepo.ServicesByIDs(ctx, serviceIDs)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar los servicios")
+	}
+
+	byID := make(map[uint64]domain.Service, len(svcs))
+	for _, svc := range svcs {
+		byID[svc.ID] = svc
+	}
+
+	for _, id := range serviceIDs {
+		if _, ok := byID[uint64(id)]; !ok {
+			return nil, errors.New("alguno de los servicios seleccionados no existe")
+		}
+	}
+
+	// 2. Recuperar las promociones vigentes
+	promos, err := s.pricingRepo.ActivePromotions(ctx, serviceIDs, at)
+	if err != nil {
+		return nil, errors.New("no fue posible recuperar las promociones")
+	}
+
+	promosBySvc := make(map[uint64][]domain.Promotion)
+	for _, p := range promos {
+		promosBySvc[p.ServiceID] = append(promosBySvc[p.ServiceID], p)
+	}
+
+	// 3. Armar el desglose
+	quote := &domain.Quote{
+		Items:    make([]domain.LineItem, 0, len(serviceIDs)),
+		PricedAt: at,
+	}
+
+	for _, id := range serviceIDs {
+		svc := byID[uint64(id)]
+
+		item := domain.LineItem{
+			ServiceID: svc.ID,
+			Name:      svc.Name,
+			Duration:  svc.Duration,
+			ListPrice: svc.Price,
+		}
+
+		if best, discount := BestPromotion(svc.Price, promosBySvc[svc.ID]); best != nil {
+			item.Promotion = best
+			item.PromoDiscount = discount
+		}
+
+		afterPromo := item.ListPrice - item.PromoDiscount
+		item.CouponDiscount = Percentage(afterPromo, couponPercentage)
+		item.FinalPrice = round(afterPromo - item.CouponDiscount)
+
+		quote.Items = append(quote.Items, item)
+		quote.ListTotal += item.ListPrice
+		quote.PromoDiscount += item.PromoDiscount
+		quote.CouponDiscount += item.CouponDiscount
+		quote.Total += item.FinalPrice
+		quote.Duration += item.Duration
+	}
+
+	quote.ListTotal = round(quote.ListTotal)
+	quote.PromoDiscount = round(quote.PromoDiscount)
+	quote.CouponDiscount = round(quote.CouponDiscount)
+	quote.Total = round(quote.Total)
+
+	return quote, nil
+}
+
+// Devuelve la mejor promocion vigente de un servicio en el momento indicado
+func (s *PricingService) ActivePromotion(ctx context.Context, serviceID uint, at time.Time) (*domain.LineItem, error) {
+
+	quote, err := s.Quote(ctx, []uint{serviceID}, at, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quote.Items[0], nil
+}
+
+// Monto de un recargo calculado como porcentaje de lo abonado, en el mismo formato de cotizacion
+func (s *PricingService) Surcharge(name string, base float64, percentage float64) *domain.Quote {
+
+	amount := Percentage(base, percentage)
+
+	return &domain.Quote{
+		Items: []domain.LineItem{
+			{
+				Name:       name,
+				ListPrice:  amount,
+				FinalPrice: amount,
+			},
+		},
+		ListTotal: amount,
+		Total:     amount,
+		PricedAt:  time.Now(),
+	}
+}
+
+// Elige la promocion que mayor descuento genera sobre el precio, nunca por encima del precio
+func BestPromotion(price float64, promos []domain.Promotion) (*domain.Promotion, float64) {
+
+	var (
+		best     *domain.Promotion
+		discount float64
+	)
+
+	for i := range promos {
+		var d float64
+		switch promos[i].Type {
+		case "fixed":
+			d = promos[i].Discount
+		default:
+			d = Percentage(price, promos[i].Discount)
+		}
+
+		d = round(math.Min(math.Max(d, 0), price))
+		if d > discount {
+			best = &promos[i]
+			discount = d
+		}
+	}
+
+	return best, discount
+}
+
+// Porcentaje de un monto redondeado a centavos
+func Percentage(amount, percentage float64) float64 {
+	return round(amount * percentage / 100)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+
 	"github.com/cloudinary/cloudinary-go/v2"
 
 	analyticsRouter "github.com/ezep02/rodeo/internal/analytics/delivery"
@@ -8,6 +10,7 @@ import (
 	apptRouter "github.com/ezep02/rodeo/internal/booking/delivery"
 	calendarRouter "github.com/ezep02/rodeo/internal/calendar/delivery"
 	catalogRouter "github.com/ezep02/rodeo/internal/catalog/delivery"
+	policyRouter "github.com/ezep02/rodeo/internal/policy/delivery"
 	slotRouter "github.com/ezep02/rodeo/internal/slots/delivery"
 	userRouter "github.com/ezep02/rodeo/internal/users/delivery"
 
@@ -17,7 +20,8 @@ import (
 	"gorm.io/gorm"
 )
 
-func NewRouter(db *gorm.DB, cloud *cloudinary.Cloudinary, redis *redis.Client) *gin.Engine {
+// ctx limita la vida de los jobs en segundo plano, se cancela al apagar el servidor
+func NewRouter(ctx context.Context, db *gorm.DB, cloud *cloudinary.Cloudinary, redis *redis.Client) *gin.Engine {
 
 	r := gin.Default()
 
@@ -38,13 +42,14 @@ func NewRouter(db *gorm.DB, cloud *cloudinary.Cloudinary, redis *redis.Client) *
 
 	// Inicializa los controladores y rutas
 	bookingRouter.NewAuthRoutes(api, db)
-	apptRouter.NewAppointmentRoutes(api, db, redis)
+	bookingSvc := apptRouter.NewAppointmentRoutes(ctx, api, db, redis, cloud)
 	analyticsRouter.NewAnalyticsRoutes(api, db, redis)
 	calendarRouter.NewCalendarRouter(api, db)
 	userRouter.NewUserRouter(api, db, redis, cloud)
 	userRouter.NewCloudRouter(api, db, redis, cloud)
 	catalogRouter.NewCatalogRoutes(api, db, redis)
-	slotRouter.NewSlotRouter(api, db, redis)
+	slotRouter.NewSlotRouter(ctx, api, db, redis, bookingSvc)
+	policyRouter.NewPolicyRouter(api, db, redis)
 
 	return r
 }
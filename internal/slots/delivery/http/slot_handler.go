@@ -1,11 +1,12 @@
 package http
 
 import (
-	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/slots/domain"
@@ -52,45 +53,125 @@ func (h *SlotHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// 4. Si todo fue bien, preparar los objetos con el barber id
-	allSlots := []domain.Slot{}
-	batchSlots := []domain.Slot{}
-	batchLimit := 100
-
-	for _, slot := range req.Batch {
-		s := domain.Slot{
-			BarberID: authorized_user.ID,
-			Start:    slot.Start,
-			End:      slot.End,
+	// 4. Validar y crear el lote (?mode=all por defecto, ?mode=skip para saltear los invalidos)
+	result, err := h.slotSvc.CreateBatch(c.Request.Context(), authorized_user.ID, req.Batch, domain.BatchMode(c.Query("mode")))
+	if err != nil {
+		if errors.Is(err, domain.ErrBatchInvalid) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "errors": result.Errors})
+			return
 		}
+		log.Println("[SLOT BATCH]", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		batchSlots = append(batchSlots, s)
-		allSlots = append(allSlots, s)
+	c.JSON(http.StatusOK, result)
+}
 
-		if len(batchSlots) == batchLimit {
-			// Insertar batch y actualizar IDs en batchSlots
-			h.slotSvc.CreateInBatches(context.Background(), &batchSlots)
+type UpdateSlotReq struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
 
-			// Actualizar los IDs en allSlots
-			copy(allSlots[len(allSlots)-batchLimit:], batchSlots)
+// Mueve o redimensiona un turno (?cascade=reprogramar|cancelar para turnos con reservas activas)
+func (h *SlotHandler) Update(c *gin.Context) {
 
-			// Reiniciar batchSlots
-			batchSlots = []domain.Slot{}
-		}
+	var (
+		req        UpdateSlotReq
+		idStr      = c.Param("id")
+		cascade    = domain.Cascade(c.Query("cascade"))
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion del barbero
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Insertar cualquier batch restante
-	if len(batchSlots) > 0 {
-		log.Println("Batch slot", batchSlots)
-		h.slotSvc.CreateInBatches(context.Background(), &batchSlots)
-		copy(allSlots[len(allSlots)-len(batchSlots):], batchSlots)
+	if !authorized_user.IsBarber {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
 	}
 
-	c.JSON(http.StatusOK, allSlots)
+	// 2. Parsing de datos
+	parsedId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error en parametros de la consulta"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println("Error binding JSON:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Objeto invalido"})
+		return
+	}
+
+	// 3. Actualizar turno
+	change, err := h.slotSvc.Update(c.Request.Context(), &domain.Slot{Start: req.Start, End: req.End}, uint(parsedId), authorized_user.ID, cascade)
+	if err != nil {
+		respondSlotError(c, err, change)
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
 }
 
-func (h *SlotHandler) Update(c *gin.Context) {
+// Elimina un turno (?cascade=cancelar para turnos con reservas activas)
+func (h *SlotHandler) Delete(c *gin.Context) {
+
+	var (
+		idStr      = c.Param("id")
+		cascade    = domain.Cascade(c.Query("cascade"))
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion del barbero
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
 
+	if !authorized_user.IsBarber {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
+	}
+
+	// 2. Parsing de datos
+	parsedId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error en parametros de la consulta"})
+		return
+	}
+
+	// 3. Eliminar turno
+	change, err := h.slotSvc.Delete(c.Request.Context(), uint(parsedId), authorized_user.ID, cascade)
+	if err != nil {
+		respondSlotError(c, err, change)
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// Traduce los errores de turnos a su status http, incluyendo las reservas afectadas si las hay
+func respondSlotError(c *gin.Context, err error, change *domain.SlotChange) {
+	switch {
+	case errors.Is(err, domain.ErrSlotNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrSlotHasBookings), errors.Is(err, domain.ErrSlotLocked), errors.Is(err, domain.ErrCascadeFailed), errors.Is(err, domain.ErrCascadeUnsupported):
+		var affected []domain.AffectedBooking
+		if change != nil {
+			affected = change.AffectedBookings
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "affected_bookings": affected})
+	case errors.Is(err, domain.ErrSlotOverlap):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
 }
 
 func (h *SlotHandler) GetByDateRange(c *gin.Context) {
@@ -134,7 +215,14 @@ func (h *SlotHandler) GetByDateRange(c *gin.Context) {
 		return
 	}
 
-	slotRange, err := h.slotSvc.GetByDateRange(c.Request.Context(), uint(parsedId), startDateParsed, endDateParsed)
+	// 4. Servicios seleccionados (opcional, ?services=1,2) para ocultar horarios sin tiempo suficiente
+	serviceIDs, err := parseServiceIDs(c.Query("services"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slotRange, err := h.slotSvc.GetByDateRange(c.Request.Context(), uint(parsedId), startDateParsed, endDateParsed, serviceIDs)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "error recuperando los slots"})
 		return
@@ -142,3 +230,354 @@ func (h *SlotHandler) GetByDateRange(c *gin.Context) {
 
 	c.JSON(http.StatusOK, slotRange)
 }
+
+type SetScheduleReq struct {
+	Schedules []domain.Schedule `json:"schedules"`
+}
+
+type SetScheduleRes struct {
+	Schedules  []domain.Schedule        `json:"schedules"`
+	Generation *domain.GenerationResult `json:"generation"`
+}
+
+// Horario semanal del barbero autenticado
+func (h *SlotHandler) GetSchedule(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion del barbero
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorized_user.IsBarber {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
+	}
+
+	schedules, err := h.slotSvc.GetSchedules(c.Request.Context(), authorized_user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error recuperando el horario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// Reemplaza el horario semanal del barbero y regenera sus slots
+func (h *SlotHandler) SetSchedule(c *gin.Context) {
+
+	var (
+		req        SetScheduleReq
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion del barbero
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorized_user.IsBarber {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
+	}
+
+	// 2. Recuperar datos de la request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println("Error binding JSON:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Objeto invalido"})
+		return
+	}
+
+	// 3. Guardar horario
+	if err := h.slotSvc.SetSchedules(c.Request.Context(), authorized_user.ID, req.Schedules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 4. Regenerar slots con el nuevo horario
+	generation, err := h.slotSvc.Generate(c.Request.Context(), authorized_user.ID, time.Now(), usecase.DefaultHorizonWeeks)
+	if err != nil {
+		log.Println("[SLOT GENERATION]", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "horario guardado, pero no fue posible generar los turnos"})
+		return
+	}
+
+	schedules, err := h.slotSvc.GetSchedules(c.Request.Context(), authorized_user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error recuperando el horario"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SetScheduleRes{Schedules: schedules, Generation: generation})
+}
+
+// Fuerza la generacion de slots del barbero (?weeks=8 para indicar el horizonte)
+func (h *SlotHandler) Generate(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		weeksStr   = c.DefaultQuery("weeks", strconv.Itoa(usecase.DefaultHorizonWeeks))
+	)
+
+	// 1. Validar sesion del barbero
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorized_user.IsBarber {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
+	}
+
+	// 2. Parsing de datos
+	weeks, err := strconv.Atoi(weeksStr)
+	if err != nil || weeks <= 0 || weeks > 52 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cantidad de semanas invalida"})
+		return
+	}
+
+	generation, err := h.slotSvc.Generate(c.Request.Context(), authorized_user.ID, time.Now(), weeks)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error generando los turnos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, generation)
+}
+
+type CreateTimeOffReq struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Reason   string    `json:"reason"`
+	ShopWide bool      `json:"shop_wide"` // cierre del local para todos los barberos (solo administradores)
+}
+
+type CreateTimeOffRes struct {
+	TimeOff          *domain.TimeOff          `json:"time_off"`
+	AffectedBookings []domain.AffectedBooking `json:"affected_bookings"`
+}
+
+// Registra una ausencia del barbero o un cierre del local
+func (h *SlotHandler) CreateTimeOff(c *gin.Context) {
+
+	var (
+		req        CreateTimeOffReq
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Recuperar datos de la request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Println("Error binding JSON:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Objeto invalido"})
+		return
+	}
+
+	// 3. Verificar permisos segun el tipo de ausencia
+	timeOff := &domain.TimeOff{
+		Start:  req.Start,
+		End:    req.End,
+		Reason: req.Reason,
+	}
+
+	if req.ShopWide {
+		if !authorized_user.IsAdmin {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+			return
+		}
+	} else {
+		if !authorized_user.IsBarber {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+			return
+		}
+		barberID := authorized_user.ID
+		timeOff.BarberID = &barberID
+	}
+
+	// 4. Crear ausencia y recuperar las reservas afectadas
+	affected, err := h.slotSvc.CreateTimeOff(c.Request.Context(), timeOff)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, CreateTimeOffRes{TimeOff: timeOff, AffectedBookings: affected})
+}
+
+// Ausencias del barbero y cierres del local dentro del rango de fechas
+func (h *SlotHandler) ListTimeOff(c *gin.Context) {
+
+	var (
+		startDateStr = c.Param("start")
+		endDateStr   = c.Param("end")
+		auth_token   = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion del barbero
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorized_user.IsBarber {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
+	}
+
+	// 2. Parsing de fechas
+	startDateParsed, err := time.ParseInLocation("2006-01-02", startDateStr, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando fecha de inicio en parametros de la consulta"})
+		return
+	}
+
+	endDateParsed, err := time.ParseInLocation("2006-01-02", endDateStr, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando fecha de fin en parametros de la consulta"})
+		return
+	}
+
+	timeOffs, err := h.slotSvc.ListTimeOff(c.Request.Context(), authorized_user.ID, startDateParsed, endDateParsed.AddDate(0, 0, 1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error recuperando las ausencias"})
+		return
+	}
+
+	c.JSON(http.StatusOK, timeOffs)
+}
+
+func (h *SlotHandler) DeleteTimeOff(c *gin.Context) {
+
+	var (
+		idStr      = c.Param("id")
+		auth_token = os.Getenv("AUTH_TOKEN")
+	)
+
+	// 1. Validar sesion
+	authorized_user, err := jwt.VerifyUserSession(c, auth_token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorized_user.IsBarber && !authorized_user.IsAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "usted no tiene acceso"})
+		return
+	}
+
+	// 2. Parsing de datos
+	parsedId, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error en parametros de la consulta"})
+		return
+	}
+
+	if err := h.slotSvc.DeleteTimeOff(c.Request.Context(), uint(parsedId), authorized_user.ID, authorized_user.IsAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "ausencia eliminada correctamente"})
+}
+
+// Busca los primeros turnos libres entre todos los barberos.
+// Parametros: from y to (YYYY-MM-DD, por defecto los proximos 14 dias), services=1,2,
+// time_from y time_to (HH:MM), limit y offset para paginar.
+func (h *SlotHandler) Search(c *gin.Context) {
+
+	var (
+		auth_token = os.Getenv("AUTH_TOKEN")
+		today      = time.Now().Format("2006-01-02")
+		fromStr    = c.DefaultQuery("from", today)
+		toStr      = c.DefaultQuery("to", time.Now().AddDate(0, 0, 14).Format("2006-01-02"))
+	)
+
+	// 1. Validar sesion
+	if _, err := jwt.VerifyUserSession(c, auth_token); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. Parsing de fechas
+	from, err := time.ParseInLocation("2006-01-02", fromStr, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando fecha de inicio en parametros de la consulta"})
+		return
+	}
+
+	to, err := time.ParseInLocation("2006-01-02", toStr, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error parseando fecha de fin en parametros de la consulta"})
+		return
+	}
+
+	// 3. Parsing de servicios y paginacion
+	serviceIDs, err := parseServiceIDs(c.Query("services"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limite invalido"})
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset invalido"})
+		return
+	}
+
+	result, err := h.slotSvc.Search(c.Request.Context(), domain.SlotSearch{
+		From:       from,
+		To:         to,
+		ServiceIDs: serviceIDs,
+		TimeFrom:   c.Query("time_from"),
+		TimeTo:     c.Query("time_to"),
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Convierte "1,2,3" en ids de servicios
+func parseServiceIDs(value string) ([]uint, error) {
+
+	var serviceIDs []uint
+	if value == "" {
+		return serviceIDs, nil
+	}
+
+	for _, raw := range strings.Split(value, ",") {
+		svcID, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, errors.New("error parseando servicios en parametros de la consulta")
+		}
+		serviceIDs = append(serviceIDs, uint(svcID))
+	}
+
+	return serviceIDs, nil
+}
@@ -1,9 +1,12 @@
 package delivery
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/ezep02/rodeo/internal/slots/delivery/http"
+	"github.com/ezep02/rodeo/internal/slots/domain"
 	"github.com/ezep02/rodeo/internal/slots/repository"
 	"github.com/ezep02/rodeo/internal/slots/usecase"
 	"github.com/gin-gonic/gin"
@@ -11,13 +14,17 @@ import (
 	"gorm.io/gorm"
 )
 
-func NewSlotRouter(r *gin.RouterGroup, db *gorm.DB, redis *redis.Client) {
+// bookings aplica los flujos de reservas (cancelacion, reprogramacion) a las reservas de los turnos modificados
+func NewSlotRouter(ctx context.Context, r *gin.RouterGroup, db *gorm.DB, redis *redis.Client, bookings domain.BookingFlows) {
 
 	log.Println("[SLOT ROUTES] Setting up slot routes")
 
 	// Repositio u casos de uso de claudinary
 	slotRepo := repository.NewGormSlotsRepo(db, redis)
-	slotSvc := usecase.NewSlotUsecase(slotRepo)
+	slotSvc := usecase.NewSlotUsecase(slotRepo, bookings)
+
+	// Job para mantener generados los turnos de los horarios semanales
+	slotSvc.StartSlotGenerationJob(ctx, 6*time.Hour, usecase.DefaultHorizonWeeks)
 
 	// Rutas de usuario
 	slot := r.Group("/slot")
@@ -25,6 +32,20 @@ func NewSlotRouter(r *gin.RouterGroup, db *gorm.DB, redis *redis.Client) {
 		slotHandler := http.NewSlotHandler(slotSvc)
 		slot.POST("/", slotHandler.Create)
 		slot.PUT("/:id", slotHandler.Update)
+		slot.DELETE("/:id", slotHandler.Delete)
 		slot.GET("/range/:start/:end/:barber", slotHandler.GetByDateRange)
+
+		// Proximos turnos libres entre todos los barberos
+		slot.GET("/search", slotHandler.Search)
+
+		// Horario semanal del barbero
+		slot.GET("/schedule", slotHandler.GetSchedule)
+		slot.PUT("/schedule", slotHandler.SetSchedule)
+		slot.POST("/schedule/generate", slotHandler.Generate)
+
+		// Ausencias del barbero y cierres del local
+		slot.POST("/time-off", slotHandler.CreateTimeOff)
+		slot.GET("/time-off/:start/:end", slotHandler.ListTimeOff)
+		slot.DELETE("/time-off/:id", slotHandler.DeleteTimeOff)
 	}
 }
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+
+	"github.com/ezep02/rodeo/internal/booking/domain/booking"
+)
+
+var (
+	// El turno solicitado no existe
+	ErrSlotNotFound = errors.New("el turno no existe")
+
+	// El turno se superpone con otro turno del mismo barbero
+	ErrSlotOverlap = errors.New("el turno se superpone con otro turno del barbero")
+
+	// El turno tiene reservas activas y no se indico que hacer con ellas
+	ErrSlotHasBookings = errors.New("el turno tiene reservas activas, indique si desea reprogramarlas o cancelarlas")
+
+	// El turno tiene reservas en curso o ya atendidas, que no pueden moverse ni cancelarse
+	ErrSlotLocked = errors.New("el turno tiene reservas en curso o ya atendidas, no puede modificarse")
+
+	// Alguna reserva del turno no pudo cancelarse, el turno no se modifico
+	ErrCascadeFailed = errors.New("no fue posible cancelar todas las reservas del turno, el turno no se modifico")
+
+	// Solo se reprograma junto al turno una reserva de un unico turno y si el turno conserva su duracion,
+	// de lo contrario la reserva quedaria repartida en horarios no consecutivos
+	ErrCascadeUnsupported = errors.New("el turno tiene reservas de varios turnos o cambia de duracion, cancelelas o reprogramelas desde la reserva")
+
+	// Accion sobre las reservas activas no soportada
+	ErrInvalidCascade = errors.New("accion invalida sobre las reservas del turno")
+
+	// El lote tiene turnos invalidos y se pidio crearlo completo o nada
+	ErrBatchInvalid = errors.New("el lote tiene turnos invalidos, no se creo ningun turno")
+)
+
+// Como tratar los turnos invalidos de un lote
+type BatchMode string
+
+const (
+	// Si algun turno es invalido no se crea ninguno
+	BatchAllOrNothing BatchMode = "all"
+
+	// Se crean los turnos validos y se informan los invalidos
+	BatchSkipInvalid BatchMode = "skip"
+)
+
+// Que hacer con las reservas activas de un turno que se modifica o elimina
+type Cascade string
+
+const (
+	// Rechazar el cambio si el turno tiene reservas activas
+	CascadeNone Cascade = ""
+
+	// Las reservas acompañan al turno y quedan como reprogramadas (solo al modificar)
+	CascadeReschedule Cascade = "reprogramar"
+
+	// Las reservas se cancelan y el turno queda libre
+	CascadeCancel Cascade = "cancelar"
+)
+
+// Estados en los que una reserva bloquea cambios sobre su turno, los mismos en los que lo ocupa
+var ActiveBookingStatuses = booking.ActiveStatuses
@@ -7,9 +7,44 @@ import (
 
 type SlotRepository interface {
 	CreateInBatches(ctx context.Context, slot *[]Slot) error
-	Update(ctx context.Context, slot *Slot, slot_id uint) error
-	// Delete(ctx context.Context, id uint) error
+	Update(ctx context.Context, slot *Slot, slot_id uint, cascade Cascade) error
+	Delete(ctx context.Context, id uint) error
 	ListByDateRange(ctx context.Context, barber_id uint, start, end time.Time) ([]SlotWithStatus, error)
-	// GetByID(ctx context.Context, id uint) (*Slot, error)
+	GetByID(ctx context.Context, id uint) (*Slot, error)
+	HasOverlap(ctx context.Context, barber_id uint, start, end time.Time, except_id uint) (bool, error)
+	ListOverlapping(ctx context.Context, barber_id uint, start, end time.Time) ([]Slot, error)
+	SearchAvailable(ctx context.Context, start, end time.Time, time_from, time_to string, limit, offset int) ([]AvailableSlot, error)
+	ActiveBookingsBySlot(ctx context.Context, slot_id uint) ([]AffectedBooking, error)
+	ServicesDuration(ctx context.Context, service_ids []uint) (int, error)
+
+	// Horarios semanales
+	ListSchedules(ctx context.Context, barber_id uint) ([]Schedule, error)
+	ReplaceSchedules(ctx context.Context, barber_id uint, schedules []Schedule) error
+	BarbersWithSchedule(ctx context.Context) ([]uint, error)
+
+	// Generacion de slots
+	ListByBarber(ctx context.Context, barber_id uint, start, end time.Time) ([]Slot, error)
+	CreateGenerated(ctx context.Context, slots []Slot) (int, error)
+	DeleteUnbookedGenerated(ctx context.Context, ids []uint) (int, error)
+
+	// Ausencias y cierres
+	CreateTimeOff(ctx context.Context, timeOff *TimeOff) error
+	DeleteTimeOff(ctx context.Context, id uint) error
+	GetTimeOff(ctx context.Context, id uint) (*TimeOff, error)
+	ListTimeOff(ctx context.Context, barber_id uint, start, end time.Time) ([]TimeOff, error)
+	ActiveBookingsInRange(ctx context.Context, barber_id *uint, start, end time.Time) ([]AffectedBooking, error)
 	// GetByUserID(ctx context.Context, id uint, offset int) ([]Slot, error)
 }
+
+// Flujos del modulo de reservas que se aplican a las reservas de un turno modificado o eliminado,
+// asi cada reserva pasa por la maquina de estados, sus devoluciones y los avisos al cliente
+type BookingFlows interface {
+	// Cancela la reserva por decision de la barberia, sin ofrecer todavia el turno a la lista de espera
+	CancelForSlot(ctx context.Context, booking_id, barber_id uint, reason string) error
+
+	// Registra que la reserva acompaño a su turno, que comenzaba en from, a su nuevo horario
+	SlotMoved(ctx context.Context, booking_id, barber_id uint, from time.Time, reason string) error
+
+	// Ofrece el turno liberado a la lista de espera
+	OfferSlot(ctx context.Context, slot_id uint)
+}
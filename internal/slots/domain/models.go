@@ -1,15 +1,21 @@
 package domain
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Modelo enviado por el barbero para luego generar los horarios
 type Slot struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	BarberID  uint      `json:"barber_id"`
-	Start     time.Time `json:"start"`
-	End       time.Time `json:"end"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	BarberID      uint           `json:"barber_id"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	AutoGenerated bool           `gorm:"default:false" json:"auto_generated"` // generado a partir del horario semanal
+	CreatedAt     time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"` // los turnos con historial de reservas se eliminan logicamente
 }
 
 // Modelo que devuelve si el horario esta ocupado o no
@@ -19,6 +25,109 @@ type SlotWithStatus struct {
 	Start     time.Time `json:"start"`
 	End       time.Time `json:"end"`
 	IsBooked  bool      `json:"is_booked"`
+	IsBlocked bool      `json:"is_blocked"` // dentro de una ausencia del barbero o un cierre del local
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// Horario semanal de un barbero para un dia de la semana, a partir del cual se generan los slots
+type Schedule struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	BarberID    uint            `gorm:"not null" json:"barber_id"`
+	Weekday     time.Weekday    `gorm:"not null" json:"weekday"`                 // 0 = domingo ... 6 = sabado
+	StartTime   string          `gorm:"type:char(5);not null" json:"start_time"` // HH:MM
+	EndTime     string          `gorm:"type:char(5);not null" json:"end_time"`   // HH:MM
+	SlotMinutes int             `gorm:"not null;default:30" json:"slot_minutes"`
+	Breaks      []ScheduleBreak `gorm:"foreignKey:ScheduleID;constraint:OnDelete:CASCADE" json:"breaks"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Descanso dentro del horario de un dia, no se generan slots que se superpongan con el
+type ScheduleBreak struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	ScheduleID uint   `gorm:"not null" json:"schedule_id"`
+	StartTime  string `gorm:"type:char(5);not null" json:"start_time"` // HH:MM
+	EndTime    string `gorm:"type:char(5);not null" json:"end_time"`   // HH:MM
+}
+
+// Resultado de materializar los horarios semanales de un barbero
+type GenerationResult struct {
+	BarberID uint      `json:"barber_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Created  int       `json:"created"`
+	Removed  int       `json:"removed"`
+}
+
+// Ausencia de un barbero (vacaciones, licencia) o cierre del local cuando BarberID es nil (feriados)
+type TimeOff struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BarberID  *uint     `gorm:"default:null" json:"barber_id"`
+	Start     time.Time `gorm:"not null" json:"start"`
+	End       time.Time `gorm:"not null" json:"end"`
+	Reason    string    `gorm:"size:255" json:"reason"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Reserva activa que cae dentro de una ausencia y debe reprogramarse
+type AffectedBooking struct {
+	BookingID uint      `json:"booking_id"`
+	ClientID  uint      `json:"client_id"`
+	BarberID  uint      `json:"barber_id"`
+	SlotID    uint      `json:"slot_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Status    string    `json:"status"`
+	SlotCount int       `json:"slot_count"`      // turnos que ocupa la reserva, incluido el inicial
+	Error     string    `json:"error,omitempty"` // el flujo de la reserva fallo al aplicar la cascada
+}
+
+// Resultado de modificar o eliminar un turno junto a las reservas activas que tenia
+type SlotChange struct {
+	Slot             *Slot             `json:"slot,omitempty"`
+	Cascade          Cascade           `json:"cascade"`
+	AffectedBookings []AffectedBooking `json:"affected_bookings"`
+}
+
+// Error de validacion de un turno dentro de un lote
+type BatchItemError struct {
+	Index int       `json:"index"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error"`
+}
+
+// Resultado de crear un lote de turnos
+type BatchResult struct {
+	Mode    BatchMode        `json:"mode"`
+	Created []Slot           `json:"created"`
+	Errors  []BatchItemError `json:"errors"`
+}
+
+// Turno libre devuelto por la busqueda entre todos los barberos
+type AvailableSlot struct {
+	SlotWithStatus
+	BarberName    string `json:"barber_name"`
+	BarberSurname string `json:"barber_surname"`
+	BarberAvatar  string `json:"barber_avatar"`
+}
+
+// Parametros de la busqueda de turnos libres entre todos los barberos
+type SlotSearch struct {
+	From       time.Time // inicio de la ventana (dia completo)
+	To         time.Time // fin de la ventana (dia completo, inclusive)
+	ServiceIDs []uint    // servicios a realizar, se exige tiempo libre suficiente desde el turno
+	TimeFrom   string    // franja horaria preferida HH:MM (opcional)
+	TimeTo     string    // HH:MM (opcional)
+	Limit      int
+	Offset     int
+}
+
+// Pagina de resultados de la busqueda
+type SlotSearchResult struct {
+	Items   []AvailableSlot `json:"items"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	HasMore bool            `json:"has_more"`
+}
@@ -2,14 +2,49 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/slots/domain"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Condicion compartida para saber si un turno esta ocupado por una reserva activa, ya sea como
+// turno inicial (bookings.slot_id) o consecutivo (booking_slots), o retenido por una oferta vigente
+// de la lista de espera. Todas las ramas usan indices por slot_id.
+var slotBookedSQL = `(
+		EXISTS (
+			SELECT 1 FROM bookings b
+			WHERE b.slot_id = slots.id
+			AND b.status IN (` + sqlList(domain.ActiveBookingStatuses) + `)
+		) OR EXISTS (
+			SELECT 1 FROM booking_slots bs
+			JOIN bookings b ON b.id = bs.booking_id
+			WHERE bs.slot_id = slots.id
+			AND b.status IN (` + sqlList(domain.ActiveBookingStatuses) + `)
+		) OR EXISTS (
+			SELECT 1 FROM waitlist_offers wo
+			WHERE wo.slot_id = slots.id
+			AND wo.status = 'ofrecido' AND wo.expires_at > NOW()
+		)
+	)`
+
+// Lista SQL de valores fijos, para las condiciones que se arman como texto
+func sqlList(values []string) string {
+	return "'" + strings.Join(values, "', '") + "'"
+}
+
+// Condicion compartida para saber si un turno cae en una ausencia del barbero o un cierre del local
+const slotBlockedSQL = `EXISTS (
+		SELECT 1 FROM time_offs t
+		WHERE (t.barber_id = slots.barber_id OR t.barber_id IS NULL)
+		AND t.start < slots.end AND t.end > slots.start
+	)`
+
 type GormSlotRepository struct {
 	db    *gorm.DB
 	redis *redis.Client
@@ -28,10 +63,180 @@ func (r *GormSlotRepository) CreateInBatches(ctx context.Context, slot *[]domain
 	return r.db.WithContext(ctx).CreateInBatches(slot, batchSize).Error
 }
 
-func (r *GormSlotRepository) Update(ctx context.Context, slot *domain.Slot, slot_id uint) error {
+// Mueve o redimensiona el turno. Las reservas activas solo pueden quedar en el turno si lo acompañan
+// (CascadeReschedule), las cancelaciones las aplica antes el modulo de reservas con sus propios flujos
+func (r *GormSlotRepository) Update(ctx context.Context, slot *domain.Slot, slot_id uint, cascade domain.Cascade) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		// 1. Bloquear el turno y verificar que no le queden reservas activas
+		if err := lockSlot(tx, slot_id); err != nil {
+			return err
+		}
+
+		if cascade != domain.CascadeReschedule {
+			if err := ensureNoActiveBookings(tx, slot_id); err != nil {
+				return err
+			}
+		}
+
+		// 2. Actualizar horario
+		res := tx.Model(&domain.Slot{}).
+			Where("id = ?", slot_id).
+			Updates(map[string]any{
+				"start": slot.Start,
+				"end":   slot.End,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return domain.ErrSlotNotFound
+		}
+
+		return nil
+	})
+}
+
+// Elimina el turno. Si tiene historial de reservas, o fue generado por el horario semanal
+// (para que la generacion no lo vuelva a crear), se elimina logicamente. Las reservas activas
+// deben haberse cancelado antes con los flujos del modulo de reservas.
+func (r *GormSlotRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var slot domain.Slot
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Take(&slot).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrSlotNotFound
+			}
+			return err
+		}
+
+		// 1. Una reserva pudo haber tomado el turno despues de cancelar las anteriores
+		if err := ensureNoActiveBookings(tx, id); err != nil {
+			return err
+		}
+
+		// 2. Verificar si alguna reserva (de cualquier estado) referencia el turno
+		var referenced int64
+		if err := tx.Table("bookings b").
+			Where("b.slot_id = ? OR EXISTS (SELECT 1 FROM booking_slots bs WHERE bs.booking_id = b.id AND bs.slot_id = ?)", id, id).
+			Count(&referenced).Error; err != nil {
+			return err
+		}
+
+		query := tx
+		if referenced == 0 && !slot.AutoGenerated {
+			query = tx.Unscoped()
+		}
+
+		res := query.Where("id = ?", id).Delete(&domain.Slot{})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return domain.ErrSlotNotFound
+		}
+
+		return nil
+	})
+}
+
+// Bloquea el turno hasta el fin de la transaccion, el checkout bloquea la misma fila al reservarlo
+func lockSlot(tx *gorm.DB, slot_id uint) error {
+
+	var slot domain.Slot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", slot_id).Take(&slot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ErrSlotNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Rechaza el cambio si alguna reserva activa ocupa el turno, como turno inicial o consecutivo
+func ensureNoActiveBookings(tx *gorm.DB, slot_id uint) error {
+
+	var active int64
+	if err := tx.Table("bookings").
+		Where("status IN ?", domain.ActiveBookingStatuses).
+		Where("(slot_id = ? OR EXISTS (SELECT 1 FROM booking_slots bs WHERE bs.booking_id = bookings.id AND bs.slot_id = ?))", slot_id, slot_id).
+		Count(&active).Error; err != nil {
+		return err
+	}
+
+	if active > 0 {
+		return domain.ErrSlotHasBookings
+	}
+
 	return nil
 }
 
+func (r *GormSlotRepository) GetByID(ctx context.Context, id uint) (*domain.Slot, error) {
+
+	var slot domain.Slot
+
+	if err := r.db.WithContext(ctx).Where("id = ?", id).Take(&slot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrSlotNotFound
+		}
+		return nil, err
+	}
+
+	return &slot, nil
+}
+
+// Indica si el barbero tiene otro turno que se superpone con el rango
+func (r *GormSlotRepository) HasOverlap(ctx context.Context, barber_id uint, start, end time.Time, except_id uint) (bool, error) {
+
+	var overlapping int64
+
+	if err := r.db.WithContext(ctx).
+		Model(&domain.Slot{}).
+		Where("barber_id = ? AND id <> ? AND start < ? AND end > ?", barber_id, except_id, end, start).
+		Count(&overlapping).Error; err != nil {
+		return false, err
+	}
+
+	return overlapping > 0, nil
+}
+
+// Turnos del barbero que se superponen con el rango
+func (r *GormSlotRepository) ListOverlapping(ctx context.Context, barber_id uint, start, end time.Time) ([]domain.Slot, error) {
+
+	var slots []domain.Slot
+
+	if err := r.db.WithContext(ctx).
+		Where("barber_id = ? AND start < ? AND end > ?", barber_id, end, start).
+		Order("start ASC").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// Reservas activas que ocupan el turno, como turno inicial o consecutivo
+func (r *GormSlotRepository) ActiveBookingsBySlot(ctx context.Context, slot_id uint) ([]domain.AffectedBooking, error) {
+
+	var affected []domain.AffectedBooking
+
+	if err := r.db.WithContext(ctx).
+		Table("bookings b").
+		Select("b.id AS booking_id, b.client_id, s.barber_id, s.id AS slot_id, s.start, s.end, b.status, (SELECT COUNT(*) FROM booking_slots bs WHERE bs.booking_id = b.id) AS slot_count").
+		Joins("JOIN slots s ON s.id = b.slot_id").
+		Where("b.status IN ?", domain.ActiveBookingStatuses).
+		Where("(b.slot_id = ? OR EXISTS (SELECT 1 FROM booking_slots bs WHERE bs.booking_id = b.id AND bs.slot_id = ?))", slot_id, slot_id).
+		Scan(&affected).Error; err != nil {
+		return nil, err
+	}
+
+	return affected, nil
+}
+
 func (r *GormSlotRepository) ListByDateRange(ctx context.Context, barber_id uint, start, end time.Time) ([]domain.SlotWithStatus, error) {
 
 	var (
@@ -58,17 +263,11 @@ func (r *GormSlotRepository) ListByDateRange(ctx context.Context, barber_id uint
 		slots.barber_id,
 		slots.start,
 		slots.end,
-		CASE 
-			WHEN b.id IS NULL THEN FALSE 
-			WHEN b.status IN ('pendiente_pago', 'confirmado', 'completado', 'reprogramado') THEN TRUE
-			ELSE FALSE 
-		END AS is_booked
+		`+slotBookedSQL+` AS is_booked,
+		`+slotBlockedSQL+` AS is_blocked
 	`).
-		Joins(`
-		LEFT JOIN bookings b
-		ON b.slot_id = slots.id
-	`).
-		Where("slots.barber_id = ? AND slots.start BETWEEN ? AND ?", barber_id, parsedStart, parsedEnd).
+		Where("slots.barber_id = ? AND slots.start BETWEEN ? AND ? AND slots.deleted_at IS NULL", barber_id, parsedStart, parsedEnd).
+		Order("slots.start ASC").
 		Scan(&slotList).Error; err != nil {
 		log.Println("List by range err", err)
 		return nil, err
@@ -84,3 +283,230 @@ func (r *GormSlotRepository) ListByDateRange(ctx context.Context, barber_id uint
 
 	return slotList, nil
 }
+
+// Suma la duracion en minutos de los servicios indicados
+func (r *GormSlotRepository) ServicesDuration(ctx context.Context, service_ids []uint) (int, error) {
+
+	var duration int
+
+	if err := r.db.WithContext(ctx).
+		Table("services").
+		Select("COALESCE(SUM(duration_minutes), 0)").
+		Where("id IN ?", service_ids).
+		Scan(&duration).Error; err != nil {
+		return 0, err
+	}
+
+	return duration, nil
+}
+
+// Horarios semanales del barbero con sus descansos
+func (r *GormSlotRepository) ListSchedules(ctx context.Context, barber_id uint) ([]domain.Schedule, error) {
+
+	var schedules []domain.Schedule
+
+	if err := r.db.WithContext(ctx).
+		Preload("Breaks").
+		Where("barber_id = ?", barber_id).
+		Order("weekday ASC").
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Reemplaza el horario semanal completo del barbero en una transaccion
+func (r *GormSlotRepository) ReplaceSchedules(ctx context.Context, barber_id uint, schedules []domain.Schedule) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		// 1. Eliminar descansos y horarios anteriores
+		if err := tx.Where("schedule_id IN (?)", tx.Model(&domain.Schedule{}).Select("id").Where("barber_id = ?", barber_id)).
+			Delete(&domain.ScheduleBreak{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("barber_id = ?", barber_id).Delete(&domain.Schedule{}).Error; err != nil {
+			return err
+		}
+
+		if len(schedules) == 0 {
+			return nil
+		}
+
+		// 2. Crear los nuevos horarios (gorm crea los descansos asociados)
+		return tx.Create(&schedules).Error
+	})
+}
+
+// Barberos que tienen al menos un horario semanal cargado
+func (r *GormSlotRepository) BarbersWithSchedule(ctx context.Context) ([]uint, error) {
+
+	var barberIDs []uint
+
+	if err := r.db.WithContext(ctx).
+		Model(&domain.Schedule{}).
+		Distinct("barber_id").
+		Pluck("barber_id", &barberIDs).Error; err != nil {
+		return nil, err
+	}
+
+	return barberIDs, nil
+}
+
+// Slots del barbero que comienzan dentro del rango [start, end)
+func (r *GormSlotRepository) ListByBarber(ctx context.Context, barber_id uint, start, end time.Time) ([]domain.Slot, error) {
+
+	var slots []domain.Slot
+
+	if err := r.db.WithContext(ctx).
+		Where("barber_id = ? AND start >= ? AND start < ?", barber_id, start, end).
+		Order("start ASC").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// Inserta los slots generados ignorando los que ya existen (indice unico barber_id + start),
+// por lo que volver a generar el mismo rango no duplica turnos
+func (r *GormSlotRepository) CreateGenerated(ctx context.Context, slots []domain.Slot) (int, error) {
+
+	if len(slots) == 0 {
+		return 0, nil
+	}
+
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&slots, 100)
+
+	return int(res.RowsAffected), res.Error
+}
+
+// Elimina slots generados por un horario que no tienen ninguna reserva asociada (ni historica),
+// los turnos con reservas nunca se borran
+func (r *GormSlotRepository) DeleteUnbookedGenerated(ctx context.Context, ids []uint) (int, error) {
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res := r.db.WithContext(ctx).
+		Where("id IN ? AND auto_generated = ?", ids, true).
+		Where("NOT EXISTS (SELECT 1 FROM bookings b WHERE b.slot_id = slots.id)").
+		Where("NOT EXISTS (SELECT 1 FROM booking_slots bs WHERE bs.slot_id = slots.id)").
+		Unscoped().
+		Delete(&domain.Slot{})
+
+	return int(res.RowsAffected), res.Error
+}
+
+func (r *GormSlotRepository) CreateTimeOff(ctx context.Context, timeOff *domain.TimeOff) error {
+	return r.db.WithContext(ctx).Create(timeOff).Error
+}
+
+func (r *GormSlotRepository) DeleteTimeOff(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&domain.TimeOff{}, id).Error
+}
+
+func (r *GormSlotRepository) GetTimeOff(ctx context.Context, id uint) (*domain.TimeOff, error) {
+
+	var timeOff domain.TimeOff
+
+	if err := r.db.WithContext(ctx).Where("id = ?", id).Take(&timeOff).Error; err != nil {
+		return nil, err
+	}
+
+	return &timeOff, nil
+}
+
+// Ausencias del barbero y cierres del local que se superponen con el rango
+func (r *GormSlotRepository) ListTimeOff(ctx context.Context, barber_id uint, start, end time.Time) ([]domain.TimeOff, error) {
+
+	var timeOffs []domain.TimeOff
+
+	if err := r.db.WithContext(ctx).
+		Where("(barber_id = ? OR barber_id IS NULL) AND start < ? AND end > ?", barber_id, end, start).
+		Order("start ASC").
+		Find(&timeOffs).Error; err != nil {
+		return nil, err
+	}
+
+	return timeOffs, nil
+}
+
+// Reservas activas cuyos turnos se superponen con el rango, de un barbero o de todos si barber_id es nil
+func (r *GormSlotRepository) ActiveBookingsInRange(ctx context.Context, barber_id *uint, start, end time.Time) ([]domain.AffectedBooking, error) {
+
+	var affected []domain.AffectedBooking
+
+	query := r.db.WithContext(ctx).
+		Table("bookings b").
+		Select("DISTINCT b.id AS booking_id, b.client_id, s.barber_id, s.id AS slot_id, s.start, s.end, b.status").
+		Joins("JOIN slots s ON s.id = b.slot_id").
+		Where("b.status IN ?", domain.ActiveBookingStatuses).
+		Where(`EXISTS (
+			SELECT 1 FROM slots rs
+			LEFT JOIN booking_slots bs ON bs.slot_id = rs.id
+			WHERE (rs.id = b.slot_id OR bs.booking_id = b.id)
+			AND rs.start < ? AND rs.end > ?
+		)`, end, start)
+
+	if barber_id != nil {
+		query = query.Where("s.barber_id = ?", *barber_id)
+	}
+
+	if err := query.Order("s.start ASC").Scan(&affected).Error; err != nil {
+		return nil, err
+	}
+
+	return affected, nil
+}
+
+// Turnos libres de todos los barberos que comienzan dentro de [start, end), ordenados por inicio.
+// El rango sobre slots.start usa el indice idx_slot_start, la franja horaria y la disponibilidad
+// se evaluan sobre ese rango. limit <= 0 devuelve todos los turnos.
+func (r *GormSlotRepository) SearchAvailable(ctx context.Context, start, end time.Time, time_from, time_to string, limit, offset int) ([]domain.AvailableSlot, error) {
+
+	var available []domain.AvailableSlot
+
+	query := r.db.WithContext(ctx).
+		Table("slots").
+		Select(`
+		slots.id,
+		slots.barber_id,
+		slots.start,
+		slots.end,
+		FALSE AS is_booked,
+		FALSE AS is_blocked,
+		u.name AS barber_name,
+		u.surname AS barber_surname,
+		u.avatar AS barber_avatar
+	`).
+		Joins("JOIN users u ON u.id = slots.barber_id").
+		Where("slots.start >= ? AND slots.start < ? AND slots.deleted_at IS NULL", start, end).
+		Where("NOT " + slotBookedSQL).
+		Where("NOT " + slotBlockedSQL)
+
+	if time_from != "" {
+		query = query.Where("TIME(slots.start) >= ?", time_from+":00")
+	}
+
+	if time_to != "" {
+		query = query.Where("TIME(slots.start) < ?", time_to+":00")
+	}
+
+	query = query.Order("slots.start ASC, slots.barber_id ASC")
+
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+
+	if err := query.Scan(&available).Error; err != nil {
+		log.Println("Search available err", err)
+		return nil, err
+	}
+
+	return available, nil
+}
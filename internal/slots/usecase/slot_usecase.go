@@ -2,6 +2,11 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/ezep02/rodeo/internal/slots/domain"
@@ -9,22 +14,857 @@ import (
 
 type SlotUsecase struct {
 	slotRepo domain.SlotRepository
+	bookings domain.BookingFlows
 }
 
-func NewSlotUsecase(slotRepo domain.SlotRepository) *SlotUsecase {
-	return &SlotUsecase{slotRepo}
+func NewSlotUsecase(slotRepo domain.SlotRepository, bookings domain.BookingFlows) *SlotUsecase {
+	return &SlotUsecase{slotRepo, bookings}
 }
 
 func (s *SlotUsecase) CreateInBatches(ctx context.Context, slot *[]domain.Slot) error {
 	return s.slotRepo.CreateInBatches(ctx, slot)
 }
 
-func (s *SlotUsecase) Update(ctx context.Context, slot *domain.Slot, id uint) error {
-	return s.slotRepo.Update(ctx, slot, id)
+// Valida el lote completo (contra si mismo y contra los turnos existentes del barbero) y lo crea
+// segun el modo: todo o nada, o salteando los turnos invalidos. Los errores se informan por item.
+func (s *SlotUsecase) CreateBatch(ctx context.Context, barber_id uint, batch []domain.Slot, mode domain.BatchMode) (*domain.BatchResult, error) {
+
+	if mode == "" {
+		mode = domain.BatchAllOrNothing
+	}
+
+	if mode != domain.BatchAllOrNothing && mode != domain.BatchSkipInvalid {
+		return nil, errors.New("modo de lote invalido, debe ser all o skip")
+	}
+
+	if len(batch) == 0 {
+		return nil, errors.New("el lote no tiene turnos")
+	}
+
+	var (
+		now     = time.Now()
+		result  = &domain.BatchResult{Mode: mode, Created: []domain.Slot{}, Errors: []domain.BatchItemError{}}
+		invalid = make(map[int]bool)
+		reject  = func(i int, msg string) {
+			if invalid[i] {
+				return
+			}
+			invalid[i] = true
+			result.Errors = append(result.Errors, domain.BatchItemError{Index: i, Start: batch[i].Start, End: batch[i].End, Error: msg})
+		}
+	)
+
+	// 1. Validaciones individuales
+	var rangeStart, rangeEnd time.Time
+	for i, slot := range batch {
+		switch {
+		case slot.Start.IsZero() || slot.End.IsZero():
+			reject(i, "el turno debe tener inicio y fin")
+		case !slot.End.After(slot.Start):
+			reject(i, "el fin del turno debe ser posterior al inicio")
+		case slot.Start.Before(now):
+			reject(i, "el turno no puede comenzar en el pasado")
+		default:
+			if rangeStart.IsZero() || slot.Start.Before(rangeStart) {
+				rangeStart = slot.Start
+			}
+			if slot.End.After(rangeEnd) {
+				rangeEnd = slot.End
+			}
+		}
+	}
+
+	// 2. Superposiciones dentro del lote (se rechaza el que aparece despues)
+	for i := range batch {
+		if invalid[i] {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if invalid[j] {
+				continue
+			}
+			if batch[i].Start.Before(batch[j].End) && batch[j].Start.Before(batch[i].End) {
+				reject(i, fmt.Sprintf("se superpone con el turno %d del lote", j))
+				break
+			}
+		}
+	}
+
+	// 3. Superposiciones con los turnos existentes del barbero
+	if !rangeStart.IsZero() {
+		existing, err := s.slotRepo.ListOverlapping(ctx, barber_id, rangeStart, rangeEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, slot := range batch {
+			if invalid[i] {
+				continue
+			}
+			for _, e := range existing {
+				if slot.Start.Before(e.End) && e.Start.Before(slot.End) {
+					reject(i, fmt.Sprintf("se superpone con el turno existente %d", e.ID))
+					break
+				}
+			}
+		}
+	}
+
+	sort.Slice(result.Errors, func(a, b int) bool { return result.Errors[a].Index < result.Errors[b].Index })
+
+	if len(result.Errors) > 0 && mode == domain.BatchAllOrNothing {
+		return result, domain.ErrBatchInvalid
+	}
+
+	// 4. Crear los turnos validos en una sola operacion
+	toCreate := make([]domain.Slot, 0, len(batch)-len(result.Errors))
+	for i, slot := range batch {
+		if invalid[i] {
+			continue
+		}
+		toCreate = append(toCreate, domain.Slot{
+			BarberID: barber_id,
+			Start:    slot.Start,
+			End:      slot.End,
+		})
+	}
+
+	if len(toCreate) > 0 {
+		if err := s.slotRepo.CreateInBatches(ctx, &toCreate); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Created = toCreate
+	return result, nil
+}
+
+// Mueve o redimensiona un turno del barbero. Si el turno tiene reservas activas el cambio se
+// rechaza con ErrSlotHasBookings, salvo que se indique reprogramarlas o cancelarlas. En ambos casos
+// cada reserva pasa por los flujos del modulo de reservas: al cancelar se cancelan antes de mover el
+// turno, y al reprogramar se mueve el turno y luego se registra el cambio en cada reserva. Solo se
+// reprograman reservas de un unico turno y sin cambiar su duracion (ErrCascadeUnsupported).
+func (s *SlotUsecase) Update(ctx context.Context, slot *domain.Slot, id, barber_id uint, cascade domain.Cascade) (*domain.SlotChange, error) {
+
+	if cascade != domain.CascadeNone && cascade != domain.CascadeReschedule && cascade != domain.CascadeCancel {
+		return nil, domain.ErrInvalidCascade
+	}
+
+	if !slot.End.After(slot.Start) {
+		return nil, errors.New("el fin del turno debe ser posterior al inicio")
+	}
+
+	// 1. Recuperar turno y verificar que sea del barbero
+	existing, err := s.slotRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.BarberID != barber_id {
+		return nil, errors.New("el turno pertenece a otro barbero")
+	}
+
+	// 2. Rechazar superposiciones con otros turnos del barbero
+	overlap, err := s.slotRepo.HasOverlap(ctx, barber_id, slot.Start, slot.End, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if overlap {
+		return nil, domain.ErrSlotOverlap
+	}
+
+	// 3. Reservas activas del turno
+	affected, err := s.slotRepo.ActiveBookingsBySlot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := checkCascade(affected, cascade)
+	if err != nil {
+		return change, err
+	}
+
+	if change.Cascade == domain.CascadeReschedule && !canMoveWithSlot(change.AffectedBookings, existing, slot, id) {
+		return change, domain.ErrCascadeUnsupported
+	}
+
+	// 4. Cancelar las reservas antes de mover el turno
+	if change.Cascade == domain.CascadeCancel {
+		if err := s.cancelBookings(ctx, change, barber_id, "el barbero modifico el turno"); err != nil {
+			return change, err
+		}
+	}
+
+	// 5. Aplicar el cambio
+	if err := s.slotRepo.Update(ctx, slot, id, change.Cascade); err != nil {
+		return change, err
+	}
+
+	from := existing.Start
+	existing.Start = slot.Start
+	existing.End = slot.End
+	change.Slot = existing
+
+	// 6. Las reservas acompañan al turno, si alguna no puede registrarse se informa en su item
+	if change.Cascade == domain.CascadeReschedule {
+		for i := range change.AffectedBookings {
+			b := &change.AffectedBookings[i]
+			if err := s.bookings.SlotMoved(ctx, b.BookingID, barber_id, from, "el barbero movio el turno"); err != nil {
+				log.Printf("[SLOT CASCADE] la reserva %d no pudo reprogramarse: %v", b.BookingID, err)
+				b.Error = err.Error()
+			}
+		}
+	}
+
+	if change.Cascade == domain.CascadeCancel {
+		s.offerFreed(ctx, change.AffectedBookings, id, false)
+	}
+
+	return change, nil
+}
+
+// Elimina un turno del barbero. Si tiene reservas activas solo se permite cancelandolas.
+func (s *SlotUsecase) Delete(ctx context.Context, id, barber_id uint, cascade domain.Cascade) (*domain.SlotChange, error) {
+
+	if cascade == domain.CascadeReschedule {
+		return nil, errors.New("para reprogramar las reservas mueva el turno en lugar de eliminarlo")
+	}
+
+	if cascade != domain.CascadeNone && cascade != domain.CascadeCancel {
+		return nil, domain.ErrInvalidCascade
+	}
+
+	// 1. Recuperar turno y verificar que sea del barbero
+	existing, err := s.slotRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.BarberID != barber_id {
+		return nil, errors.New("el turno pertenece a otro barbero")
+	}
+
+	// 2. Reservas activas del turno
+	affected, err := s.slotRepo.ActiveBookingsBySlot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := checkCascade(affected, cascade)
+	if err != nil {
+		return change, err
+	}
+
+	// 3. Cancelar las reservas con los flujos del modulo de reservas
+	if change.Cascade == domain.CascadeCancel {
+		if err := s.cancelBookings(ctx, change, barber_id, "el barbero elimino el turno"); err != nil {
+			return change, err
+		}
+	}
+
+	// 4. Eliminar
+	if err := s.slotRepo.Delete(ctx, id); err != nil {
+		return change, err
+	}
+
+	// Los demas turnos de las reservas canceladas quedan libres
+	s.offerFreed(ctx, change.AffectedBookings, id, true)
+
+	return change, nil
+}
+
+// Estados en los que la reserva ya no puede moverse ni cancelarse junto a su turno
+var lockedBookingStatuses = []string{"en_curso", "completado", "ausente"}
+
+// Valida la accion pedida sobre las reservas activas del turno
+func checkCascade(affected []domain.AffectedBooking, cascade domain.Cascade) (*domain.SlotChange, error) {
+
+	change := &domain.SlotChange{Cascade: cascade, AffectedBookings: affected}
+
+	if len(affected) == 0 {
+		change.Cascade = domain.CascadeNone
+		return change, nil
+	}
+
+	if cascade == domain.CascadeNone {
+		return change, domain.ErrSlotHasBookings
+	}
+
+	for _, b := range affected {
+		if slices.Contains(lockedBookingStatuses, b.Status) {
+			return change, domain.ErrSlotLocked
+		}
+	}
+
+	return change, nil
+}
+
+// Mover el turno solo mueve esa fila: las reservas lo acompañan si lo ocupan solas y la duracion no cambia
+func canMoveWithSlot(affected []domain.AffectedBooking, existing, slot *domain.Slot, slot_id uint) bool {
+
+	if slot.End.Sub(slot.Start) != existing.End.Sub(existing.Start) {
+		return false
+	}
+
+	for _, b := range affected {
+		if b.SlotID != slot_id || b.SlotCount > 1 {
+			return false
+		}
+	}
+
+	return true
 }
 
-func (s *SlotUsecase) GetByDateRange(ctx context.Context, barber_id uint, start, end time.Time) ([]domain.SlotWithStatus, error) {
+// Cancela cada reserva del turno como una cancelacion de la barberia (devolucion y aviso al cliente).
+// Si alguna falla el turno no se modifica, las que ya se cancelaron quedan canceladas
+func (s *SlotUsecase) cancelBookings(ctx context.Context, change *domain.SlotChange, barber_id uint, reason string) error {
+
+	failed := false
+	for i := range change.AffectedBookings {
+		b := &change.AffectedBookings[i]
+		if err := s.bookings.CancelForSlot(ctx, b.BookingID, barber_id, reason); err != nil {
+			log.Printf("[SLOT CASCADE] la reserva %d no pudo cancelarse: %v", b.BookingID, err)
+			b.Error = err.Error()
+			failed = true
+			continue
+		}
+		b.Status = "cancelado"
+	}
+
+	if failed {
+		return domain.ErrCascadeFailed
+	}
+
+	return nil
+}
+
+// Ofrece a la lista de espera el turno modificado y los turnos iniciales de las reservas canceladas.
+// Un turno eliminado no se ofrece
+func (s *SlotUsecase) offerFreed(ctx context.Context, affected []domain.AffectedBooking, slot_id uint, deleted bool) {
+
+	offered := map[uint]bool{slot_id: true}
+	if !deleted {
+		s.bookings.OfferSlot(ctx, slot_id)
+	}
+
+	for _, b := range affected {
+		if b.Error != "" || offered[b.SlotID] {
+			continue
+		}
+		offered[b.SlotID] = true
+		s.bookings.OfferSlot(ctx, b.SlotID)
+	}
+}
+
+func (s *SlotUsecase) GetByDateRange(ctx context.Context, barber_id uint, start, end time.Time, service_ids []uint) ([]domain.SlotWithStatus, error) {
 
 	// 1. validar que exista un barber id
-	return s.slotRepo.ListByDateRange(ctx, barber_id, start, end)
+	slotList, err := s.slotRepo.ListByDateRange(ctx, barber_id, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Ocultar los turnos libres que caen en una ausencia o cierre del local
+	available := make([]domain.SlotWithStatus, 0, len(slotList))
+	for _, slot := range slotList {
+		if slot.IsBlocked && !slot.IsBooked {
+			continue
+		}
+		available = append(available, slot)
+	}
+	slotList = available
+
+	// 3. Sin servicios seleccionados no hay duracion que cubrir
+	if len(service_ids) == 0 {
+		return slotList, nil
+	}
+
+	duration, err := s.slotRepo.ServicesDuration(ctx, service_ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return fitDuration(slotList, time.Duration(duration)*time.Minute), nil
+}
+
+// Oculta los horarios libres desde los que no se llega a cubrir la duracion con turnos libres
+// consecutivos, los turnos ocupados se mantienen para que se sigan mostrando como tales.
+// Espera los turnos ordenados por inicio.
+func fitDuration(slotList []domain.SlotWithStatus, needed time.Duration) []domain.SlotWithStatus {
+
+	filtered := make([]domain.SlotWithStatus, 0, len(slotList))
+
+	for i, slot := range slotList {
+		if slot.IsBooked || fitsFrom(slotList, i, needed) {
+			filtered = append(filtered, slot)
+		}
+	}
+
+	return filtered
+}
+
+// Indica si desde el turno i se cubre la duracion con turnos libres consecutivos
+func fitsFrom(slotList []domain.SlotWithStatus, i int, needed time.Duration) bool {
+
+	covered := slotList[i].End.Sub(slotList[i].Start)
+	cursor := slotList[i].End
+
+	for j := i + 1; j < len(slotList) && covered < needed; j++ {
+		next := slotList[j]
+		if next.IsBooked || !next.Start.Equal(cursor) {
+			break
+		}
+		covered += next.End.Sub(next.Start)
+		cursor = next.End
+	}
+
+	return covered >= needed
+}
+
+// Cantidad de semanas hacia adelante que se mantienen generadas a partir de los horarios semanales
+const DefaultHorizonWeeks = 8
+
+func (s *SlotUsecase) GetSchedules(ctx context.Context, barber_id uint) ([]domain.Schedule, error) {
+	return s.slotRepo.ListSchedules(ctx, barber_id)
+}
+
+// Reemplaza el horario semanal del barbero, un horario por dia de la semana
+func (s *SlotUsecase) SetSchedules(ctx context.Context, barber_id uint, schedules []domain.Schedule) error {
+
+	seen := make(map[time.Weekday]bool)
+
+	for i := range schedules {
+		sch := &schedules[i]
+
+		if sch.Weekday < time.Sunday || sch.Weekday > time.Saturday {
+			return errors.New("dia de la semana invalido, debe estar entre 0 (domingo) y 6 (sabado)")
+		}
+
+		if seen[sch.Weekday] {
+			return fmt.Errorf("el dia %d esta repetido en el horario", sch.Weekday)
+		}
+		seen[sch.Weekday] = true
+
+		open, err := parseClock(sch.StartTime)
+		if err != nil {
+			return err
+		}
+
+		closeAt, err := parseClock(sch.EndTime)
+		if err != nil {
+			return err
+		}
+
+		if closeAt <= open {
+			return errors.New("el horario de cierre debe ser posterior al de apertura")
+		}
+
+		if sch.SlotMinutes <= 0 || time.Duration(sch.SlotMinutes)*time.Minute > closeAt-open {
+			return errors.New("la duracion de los turnos no entra en el horario")
+		}
+
+		for _, b := range sch.Breaks {
+			breakStart, err := parseClock(b.StartTime)
+			if err != nil {
+				return err
+			}
+
+			breakEnd, err := parseClock(b.EndTime)
+			if err != nil {
+				return err
+			}
+
+			if breakEnd <= breakStart || breakStart < open || breakEnd > closeAt {
+				return errors.New("los descansos deben estar dentro del horario")
+			}
+		}
+
+		sch.ID = 0
+		sch.BarberID = barber_id
+		for j := range sch.Breaks {
+			sch.Breaks[j].ID = 0
+			sch.Breaks[j].ScheduleID = 0
+		}
+	}
+
+	return s.slotRepo.ReplaceSchedules(ctx, barber_id, schedules)
+}
+
+// Materializa los horarios semanales del barbero en slots para las proximas semanas.
+// Es idempotente: no crea turnos que se superpongan con slots existentes y solo elimina
+// slots generados a futuro que ya no corresponden al horario y nunca fueron reservados.
+func (s *SlotUsecase) Generate(ctx context.Context, barber_id uint, from time.Time, weeks int) (*domain.GenerationResult, error) {
+
+	if weeks <= 0 {
+		weeks = DefaultHorizonWeeks
+	}
+
+	var (
+		now   = time.Now()
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+		end   = start.AddDate(0, 0, 7*weeks)
+	)
+
+	schedules, err := s.slotRepo.ListSchedules(ctx, barber_id)
+	if err != nil {
+		return nil, err
+	}
+
+	byWeekday := make(map[time.Weekday]domain.Schedule, len(schedules))
+	for _, sch := range schedules {
+		byWeekday[sch.Weekday] = sch
+	}
+
+	// 1. Turnos que deberian existir segun el horario
+	var desired []domain.Slot
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if sch, ok := byWeekday[day.Weekday()]; ok {
+			desired = append(desired, daySlots(barber_id, sch, day)...)
+		}
+	}
+
+	// Las ausencias y cierres no eliminan turnos, solo evitan crearlos
+	timeOffs, err := s.slotRepo.ListTimeOff(ctx, barber_id, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[int64]time.Time, len(desired))
+	for _, slot := range desired {
+		wanted[slot.Start.Unix()] = slot.End
+	}
+
+	// 2. Eliminar los slots generados a futuro que ya no corresponden al horario
+	existing, err := s.slotRepo.ListByBarber(ctx, barber_id, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []uint
+	for _, slot := range existing {
+		if !slot.AutoGenerated || !slot.Start.After(now) {
+			continue
+		}
+		if slotEnd, ok := wanted[slot.Start.Unix()]; !ok || !slotEnd.Equal(slot.End) {
+			stale = append(stale, slot.ID)
+		}
+	}
+
+	removed, err := s.slotRepo.DeleteUnbookedGenerated(ctx, stale)
+	if err != nil {
+		return nil, err
+	}
+
+	if removed > 0 {
+		if existing, err = s.slotRepo.ListByBarber(ctx, barber_id, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Crear los turnos futuros que no se superponen con slots existentes
+	var toCreate []domain.Slot
+	for _, slot := range desired {
+		if slot.Start.Before(now) || overlapsAny(slot, existing) || duringTimeOff(slot, timeOffs) {
+			continue
+		}
+		toCreate = append(toCreate, slot)
+	}
+
+	created, err := s.slotRepo.CreateGenerated(ctx, toCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.GenerationResult{
+		BarberID: barber_id,
+		From:     start,
+		To:       end,
+		Created:  created,
+		Removed:  removed,
+	}, nil
+}
+
+// Genera los slots de todos los barberos con horario semanal
+func (s *SlotUsecase) GenerateAll(ctx context.Context, weeks int) ([]domain.GenerationResult, error) {
+
+	barberIDs, err := s.slotRepo.BarbersWithSchedule(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]domain.GenerationResult, 0, len(barberIDs))
+	for _, barberID := range barberIDs {
+		res, err := s.Generate(ctx, barberID, time.Now(), weeks)
+		if err != nil {
+			log.Printf("[SLOT GENERATION] error generando slots del barbero %d: %v", barberID, err)
+			continue
+		}
+		results = append(results, *res)
+	}
+
+	return results, nil
+}
+
+// Proceso en segundo plano que mantiene generados los slots de las proximas semanas,
+// se ejecuta al iniciar y luego en cada intervalo
+func (s *SlotUsecase) StartSlotGenerationJob(ctx context.Context, interval time.Duration, weeks int) {
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			results, err := s.GenerateAll(ctx, weeks)
+			if err != nil {
+				log.Println("Error generando slots:", err)
+			}
+			log.Printf("[GENERATING SLOTS] %d barberos procesados", len(results))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Turnos de un dia segun el horario, salteando los descansos
+func daySlots(barber_id uint, sch domain.Schedule, day time.Time) []domain.Slot {
+
+	var (
+		slots  []domain.Slot
+		length = time.Duration(sch.SlotMinutes) * time.Minute
+	)
+
+	open, err := parseClock(sch.StartTime)
+	if err != nil || length <= 0 {
+		return nil
+	}
+
+	closeAt, err := parseClock(sch.EndTime)
+	if err != nil {
+		return nil
+	}
+
+	breaks := make([][2]time.Time, 0, len(sch.Breaks))
+	for _, b := range sch.Breaks {
+		breakStart, err1 := parseClock(b.StartTime)
+		breakEnd, err2 := parseClock(b.EndTime)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		breaks = append(breaks, [2]time.Time{day.Add(breakStart), day.Add(breakEnd)})
+	}
+
+	closing := day.Add(closeAt)
+
+next:
+	for start := day.Add(open); !start.Add(length).After(closing); {
+		end := start.Add(length)
+
+		// Si el turno pisa un descanso se retoma al terminar el descanso
+		for _, b := range breaks {
+			if start.Before(b[1]) && b[0].Before(end) {
+				start = b[1]
+				continue next
+			}
+		}
+
+		slots = append(slots, domain.Slot{
+			BarberID:      barber_id,
+			Start:         start,
+			End:           end,
+			AutoGenerated: true,
+		})
+		start = end
+	}
+
+	return slots
+}
+
+func overlapsAny(slot domain.Slot, existing []domain.Slot) bool {
+	for _, e := range existing {
+		if slot.Start.Before(e.End) && e.Start.Before(slot.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func duringTimeOff(slot domain.Slot, timeOffs []domain.TimeOff) bool {
+	for _, t := range timeOffs {
+		if slot.Start.Before(t.End) && t.Start.Before(slot.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convierte un horario HH:MM en la duracion desde el inicio del dia
+func parseClock(value string) (time.Duration, error) {
+
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("horario invalido %q, el formato debe ser HH:MM", value)
+	}
+
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// Registra una ausencia del barbero (o un cierre del local si BarberID es nil) y devuelve las
+// reservas activas que quedan dentro del periodo para que puedan reprogramarse
+func (s *SlotUsecase) CreateTimeOff(ctx context.Context, timeOff *domain.TimeOff) ([]domain.AffectedBooking, error) {
+
+	if timeOff.Start.IsZero() || timeOff.End.IsZero() {
+		return nil, errors.New("el periodo debe tener inicio y fin")
+	}
+
+	if !timeOff.End.After(timeOff.Start) {
+		return nil, errors.New("el fin del periodo debe ser posterior al inicio")
+	}
+
+	if err := s.slotRepo.CreateTimeOff(ctx, timeOff); err != nil {
+		return nil, err
+	}
+
+	affected, err := s.slotRepo.ActiveBookingsInRange(ctx, timeOff.BarberID, timeOff.Start, timeOff.End)
+	if err != nil {
+		return nil, err
+	}
+
+	return affected, nil
+}
+
+func (s *SlotUsecase) ListTimeOff(ctx context.Context, barber_id uint, start, end time.Time) ([]domain.TimeOff, error) {
+	return s.slotRepo.ListTimeOff(ctx, barber_id, start, end)
+}
+
+// Elimina una ausencia, los cierres del local solo los puede eliminar un administrador
+func (s *SlotUsecase) DeleteTimeOff(ctx context.Context, id, barber_id uint, is_admin bool) error {
+
+	timeOff, err := s.slotRepo.GetTimeOff(ctx, id)
+	if err != nil {
+		return errors.New("la ausencia no existe")
+	}
+
+	if timeOff.BarberID == nil && !is_admin {
+		return errors.New("solo un administrador puede eliminar un cierre del local")
+	}
+
+	if timeOff.BarberID != nil && *timeOff.BarberID != barber_id && !is_admin {
+		return errors.New("la ausencia pertenece a otro barbero")
+	}
+
+	return s.slotRepo.DeleteTimeOff(ctx, id)
+}
+
+// Limite de dias de la ventana de busqueda entre barberos
+const MaxSearchDays = 31
+
+// Busca los primeros turnos libres entre todos los barberos dentro de la ventana de fechas,
+// opcionalmente en una franja horaria y con tiempo suficiente para los servicios indicados.
+// Los resultados se ordenan por inicio (y barbero ante empate) y se paginan.
+func (s *SlotUsecase) Search(ctx context.Context, search domain.SlotSearch) (*domain.SlotSearchResult, error) {
+
+	if search.Limit <= 0 || search.Limit > 100 {
+		search.Limit = 20
+	}
+
+	if search.Offset < 0 {
+		search.Offset = 0
+	}
+
+	// 1. Validar ventana de fechas
+	var (
+		now   = time.Now()
+		start = time.Date(search.From.Year(), search.From.Month(), search.From.Day(), 0, 0, 0, 0, time.Local)
+		end   = time.Date(search.To.Year(), search.To.Month(), search.To.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+	)
+
+	if !end.After(start) {
+		return nil, errors.New("la fecha de fin debe ser posterior a la de inicio")
+	}
+
+	if end.Sub(start) > MaxSearchDays*24*time.Hour {
+		return nil, fmt.Errorf("la ventana de busqueda no puede superar los %d dias", MaxSearchDays)
+	}
+
+	if start.Before(now) {
+		start = now
+	}
+
+	// 2. Validar franja horaria
+	for _, clock := range []string{search.TimeFrom, search.TimeTo} {
+		if clock == "" {
+			continue
+		}
+		if _, err := parseClock(clock); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &domain.SlotSearchResult{Limit: search.Limit, Offset: search.Offset, Items: []domain.AvailableSlot{}}
+
+	// 3. Sin servicios se pagina directamente en la base de datos (se pide uno extra para saber si hay mas)
+	var needed time.Duration
+	if len(search.ServiceIDs) > 0 {
+		duration, err := s.slotRepo.ServicesDuration(ctx, search.ServiceIDs)
+		if err != nil {
+			return nil, err
+		}
+		needed = time.Duration(duration) * time.Minute
+	}
+
+	if needed == 0 {
+		items, err := s.slotRepo.SearchAvailable(ctx, start, end, search.TimeFrom, search.TimeTo, search.Limit+1, search.Offset)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(items) > search.Limit {
+			result.HasMore = true
+			items = items[:search.Limit]
+		}
+		result.Items = items
+
+		return result, nil
+	}
+
+	// 4. Con servicios hay que ver los turnos siguientes de cada barbero, incluso fuera de la franja
+	candidates, err := s.slotRepo.SearchAvailable(ctx, start, end, search.TimeFrom, search.TimeTo, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := s.slotRepo.SearchAvailable(ctx, start, end.Add(needed), "", "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	byBarber := make(map[uint][]domain.SlotWithStatus)
+	position := make(map[uint]int, len(free))
+	for _, slot := range free {
+		position[slot.ID] = len(byBarber[slot.BarberID])
+		byBarber[slot.BarberID] = append(byBarber[slot.BarberID], slot.SlotWithStatus)
+	}
+
+	matched := 0
+	for _, slot := range candidates {
+		i, ok := position[slot.ID]
+		if !ok || !fitsFrom(byBarber[slot.BarberID], i, needed) {
+			continue
+		}
+
+		if matched >= search.Offset {
+			if len(result.Items) == search.Limit {
+				result.HasMore = true
+				break
+			}
+			result.Items = append(result.Items, slot)
+		}
+		matched++
+	}
+
+	return result, nil
 }
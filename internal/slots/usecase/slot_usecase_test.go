@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ezep02/rodeo/internal/slots/domain"
+)
+
+// Repositorio en memoria con lo necesario para modificar y eliminar un turno
+type fakeSlotRepo struct {
+	domain.SlotRepository
+
+	slot     domain.Slot
+	affected []domain.AffectedBooking
+	calls    *[]string
+}
+
+func (r *fakeSlotRepo) GetByID(ctx context.Context, id uint) (*domain.Slot, error) {
+	slot := r.slot
+	return &slot, nil
+}
+
+func (r *fakeSlotRepo) HasOverlap(ctx context.Context, barber_id uint, start, end time.Time, except_id uint) (bool, error) {
+	return false, nil
+}
+
+func (r *fakeSlotRepo) ActiveBookingsBySlot(ctx context.Context, slot_id uint) ([]domain.AffectedBooking, error) {
+	return append([]domain.AffectedBooking(nil), r.affected...), nil
+}
+
+func (r *fakeSlotRepo) Update(ctx context.Context, slot *domain.Slot, slot_id uint, cascade domain.Cascade) error {
+	*r.calls = append(*r.calls, "update")
+	return nil
+}
+
+func (r *fakeSlotRepo) Delete(ctx context.Context, id uint) error {
+	*r.calls = append(*r.calls, "delete")
+	return nil
+}
+
+// Registra el orden en que se aplican los flujos de reservas
+type fakeFlows struct {
+	calls  *[]string
+	failOn uint
+}
+
+func (f *fakeFlows) CancelForSlot(ctx context.Context, booking_id, barber_id uint, reason string) error {
+	if booking_id == f.failOn {
+		return errors.New("el proveedor rechazo la devolucion")
+	}
+	*f.calls = append(*f.calls, "cancel")
+	return nil
+}
+
+func (f *fakeFlows) SlotMoved(ctx context.Context, booking_id, barber_id uint, from time.Time, reason string) error {
+	*f.calls = append(*f.calls, "moved")
+	return nil
+}
+
+func (f *fakeFlows) OfferSlot(ctx context.Context, slot_id uint) {
+	*f.calls = append(*f.calls, "offer")
+}
+
+func newCascadeCase(status string, failOn uint) (*SlotUsecase, *[]string) {
+
+	start := time.Now().Add(48 * time.Hour)
+	calls := &[]string{}
+
+	repo := &fakeSlotRepo{
+		slot:     domain.Slot{ID: 1, BarberID: 7, Start: start, End: start.Add(30 * time.Minute)},
+		affected: []domain.AffectedBooking{{BookingID: 10, SlotID: 1, Status: status, SlotCount: 1}},
+		calls:    calls,
+	}
+
+	return NewSlotUsecase(repo, &fakeFlows{calls: calls, failOn: failOn}), calls
+}
+
+func moved() *domain.Slot {
+	start := time.Now().Add(72 * time.Hour)
+	return &domain.Slot{Start: start, End: start.Add(30 * time.Minute)}
+}
+
+func assertCalls(t *testing.T, got *[]string, want ...string) {
+	t.Helper()
+
+	if len(*got) != len(want) {
+		t.Fatalf("se esperaban %v, se obtuvo %v", want, *got)
+	}
+	for i := range want {
+		if (*got)[i] != want[i] {
+			t.Fatalf("se esperaban %v, se obtuvo %v", want, *got)
+		}
+	}
+}
+
+func TestUpdateCancelsBookingsBeforeMovingSlot(t *testing.T) {
+
+	svc, calls := newCascadeCase("pagado", 0)
+
+	change, err := svc.Update(context.Background(), moved(), 1, 7, domain.CascadeCancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalls(t, calls, "cancel", "update", "offer")
+
+	if change.AffectedBookings[0].Status != "cancelado" {
+		t.Fatalf("la reserva deberia informarse cancelada, se obtuvo %q", change.AffectedBookings[0].Status)
+	}
+}
+
+func TestUpdateKeepsSlotWhenCancelFails(t *testing.T) {
+
+	svc, calls := newCascadeCase("pagado", 10)
+
+	change, err := svc.Update(context.Background(), moved(), 1, 7, domain.CascadeCancel)
+	if !errors.Is(err, domain.ErrCascadeFailed) {
+		t.Fatalf("se esperaba ErrCascadeFailed, se obtuvo %v", err)
+	}
+
+	assertCalls(t, calls)
+
+	if change.AffectedBookings[0].Error == "" {
+		t.Fatal("la reserva deberia informar el error de la cancelacion")
+	}
+}
+
+func TestUpdateReschedulesBookingsAfterMovingSlot(t *testing.T) {
+
+	svc, calls := newCascadeCase("confirmado", 0)
+
+	if _, err := svc.Update(context.Background(), moved(), 1, 7, domain.CascadeReschedule); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalls(t, calls, "update", "moved")
+}
+
+// Mover una sola fila dejaria la reserva repartida en horarios no consecutivos
+func TestRescheduleRejectsMultiSlotBookingsAndResizes(t *testing.T) {
+
+	cases := []struct {
+		name     string
+		affected domain.AffectedBooking
+		slot     func() *domain.Slot
+	}{
+		{"turno consecutivo de otra reserva", domain.AffectedBooking{BookingID: 10, SlotID: 2, Status: "confirmado", SlotCount: 2}, moved},
+		{"reserva de varios turnos", domain.AffectedBooking{BookingID: 10, SlotID: 1, Status: "confirmado", SlotCount: 2}, moved},
+		{"cambio de duracion", domain.AffectedBooking{BookingID: 10, SlotID: 1, Status: "confirmado", SlotCount: 1}, func() *domain.Slot {
+			slot := moved()
+			slot.End = slot.End.Add(15 * time.Minute)
+			return slot
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, calls := newCascadeCase("confirmado", 0)
+			svc.slotRepo.(*fakeSlotRepo).affected = []domain.AffectedBooking{tc.affected}
+
+			if _, err := svc.Update(context.Background(), tc.slot(), 1, 7, domain.CascadeReschedule); !errors.Is(err, domain.ErrCascadeUnsupported) {
+				t.Fatalf("se esperaba ErrCascadeUnsupported, se obtuvo %v", err)
+			}
+
+			assertCalls(t, calls)
+		})
+	}
+}
+
+func TestCascadeRejectsAttendedBookings(t *testing.T) {
+
+	for _, status := range []string{"en_curso", "completado", "ausente"} {
+		svc, calls := newCascadeCase(status, 0)
+
+		if _, err := svc.Update(context.Background(), moved(), 1, 7, domain.CascadeReschedule); !errors.Is(err, domain.ErrSlotLocked) {
+			t.Fatalf("%s: se esperaba ErrSlotLocked al modificar, se obtuvo %v", status, err)
+		}
+
+		if _, err := svc.Delete(context.Background(), 1, 7, domain.CascadeCancel); !errors.Is(err, domain.ErrSlotLocked) {
+			t.Fatalf("%s: se esperaba ErrSlotLocked al eliminar, se obtuvo %v", status, err)
+		}
+
+		assertCalls(t, calls)
+	}
+}
+
+func TestDeleteDoesNotOfferDeletedSlot(t *testing.T) {
+
+	svc, calls := newCascadeCase("confirmado", 0)
+
+	if _, err := svc.Delete(context.Background(), 1, 7, domain.CascadeCancel); err != nil {
+		t.Fatal(err)
+	}
+
+	assertCalls(t, calls, "cancel", "delete")
+}
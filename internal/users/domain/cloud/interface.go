@@ -12,4 +12,5 @@ type CloudinaryRepository interface {
 	Video(ctx context.Context) ([]api.BriefAssetResult, error)
 	Upload(ctx context.Context, file io.Reader, filename string) error
 	UploadAvatar(ctx context.Context, file io.Reader, filename string) (string, error)
+	UploadReceipt(ctx context.Context, file io.Reader, filename string) (string, error)
 }
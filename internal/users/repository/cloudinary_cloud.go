@@ -136,3 +136,20 @@ func (r *CloudinaryRepository) UploadAvatar(ctx context.Context, file io.Reader,
 	log.Printf("Avatar subido correctamente a %s\n", resp.SecureURL)
 	return resp.SecureURL, nil
 }
+
+// Sube el comprobante de una transferencia a la carpeta de comprobantes
+func (r *CloudinaryRepository) UploadReceipt(ctx context.Context, file io.Reader, filename string) (string, error) {
+
+	resp, err := r.cloud.Upload.Upload(ctx, file, uploader.UploadParams{
+		PublicID:     filename,
+		Folder:       "rodeo_img_container/receipts",
+		Overwrite:    api.Bool(true),
+		ResourceType: "image",
+	})
+	if err != nil {
+		return "", fmt.Errorf("error subiendo comprobante a Cloudinary: %w", err)
+	}
+
+	log.Printf("Comprobante subido correctamente a %s\n", resp.SecureURL)
+	return resp.SecureURL, nil
+}
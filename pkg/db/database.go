@@ -12,7 +12,8 @@ import (
 func DB_Connection(dbConn string) (*gorm.DB, error) {
 
 	// Establecer conexión a la base de datos
-	connection, err := gorm.Open(mysql.Open(dbConn), &gorm.Config{})
+	// TranslateError traduce los errores del driver (ej. clave duplicada) a los errores de gorm
+	connection, err := gorm.Open(mysql.Open(dbConn), &gorm.Config{TranslateError: true})
 
 	if err != nil {
 		return nil, fmt.Errorf("[DB] error al conectar: %w", err) // Retornar el error sin terminar el programa